@@ -101,7 +101,7 @@ func (rep *Reporter) BuildRequest(now time.Time, r metrics.Registry) (batch Batc
 	}
 	batch.Measurements = make([]Measurement, 0)
 	histogramMeasurementCount := 1 + len(rep.Percentiles)
-	r.Each(func(name string, metric interface{}) {
+	r.Snapshot().Each(func(name string, metric interface{}) {
 		// if whitelist is set (non-nil), only upload runtime.* metrics
 		// from the list.
 		if strings.HasPrefix(name, "runtime.") &&
@@ -113,6 +113,18 @@ func (rep *Reporter) BuildRequest(now time.Time, r metrics.Registry) (batch Batc
 		name = rep.Prefix + name
 		measurement := Measurement{}
 		measurement[Period] = rep.Interval.Seconds()
+		// The labels of the metric, i.e those of an Info, tag every
+		// measurement appended for it.
+		start := len(batch.Measurements)
+		if labels := metrics.MetricLabels(metric); len(labels) > 0 {
+			defer func() {
+				for _, m := range batch.Measurements[start:] {
+					if m != nil {
+						m[Tags] = labels
+					}
+				}
+			}()
+		}
 		switch m := metric.(type) {
 		case metrics.Counter:
 			if m.Count() <= 0 {
@@ -134,8 +146,12 @@ func (rep *Reporter) BuildRequest(now time.Time, r metrics.Registry) (batch Batc
 			measurement[Name] = name
 			measurement[Value] = m.Value()
 			batch.Measurements = append(batch.Measurements, measurement)
+		case metrics.Info:
+			measurement[Name] = name
+			measurement[Value] = float64(m.Value())
+			batch.Measurements = append(batch.Measurements, measurement)
 		case metrics.Histogram:
-			s := m.Snapshot().Sample()
+			s := m.Sample()
 			if s.Count() <= 0 {
 				return
 			}
@@ -163,14 +179,13 @@ func (rep *Reporter) BuildRequest(now time.Time, r metrics.Registry) (batch Batc
 			}
 			batch.Measurements = append(batch.Measurements, measurements...)
 		case metrics.Meter:
-			s := m.Snapshot()
 			measurement[Name] = name
-			measurement[Value] = float64(s.Count())
+			measurement[Value] = float64(m.Count())
 			batch.Measurements = append(batch.Measurements, measurement)
 			batch.Measurements = append(batch.Measurements,
 				Measurement{
 					Name:   fmt.Sprintf("%s.%s", name, "1min"),
-					Value:  s.Rate1(),
+					Value:  m.Rate1(),
 					Period: int64(rep.Interval.Seconds()),
 					Attributes: map[string]interface{}{
 						DisplayUnitsLong:  Operations,
@@ -180,7 +195,7 @@ func (rep *Reporter) BuildRequest(now time.Time, r metrics.Registry) (batch Batc
 				},
 				Measurement{
 					Name:   fmt.Sprintf("%s.%s", name, "5min"),
-					Value:  s.Rate5(),
+					Value:  m.Rate5(),
 					Period: int64(rep.Interval.Seconds()),
 					Attributes: map[string]interface{}{
 						DisplayUnitsLong:  Operations,
@@ -190,7 +205,7 @@ func (rep *Reporter) BuildRequest(now time.Time, r metrics.Registry) (batch Batc
 				},
 				Measurement{
 					Name:   fmt.Sprintf("%s.%s", name, "15min"),
-					Value:  s.Rate15(),
+					Value:  m.Rate15(),
 					Period: int64(rep.Interval.Seconds()),
 					Attributes: map[string]interface{}{
 						DisplayUnitsLong:  Operations,
@@ -200,9 +215,8 @@ func (rep *Reporter) BuildRequest(now time.Time, r metrics.Registry) (batch Batc
 				},
 			)
 		case metrics.Timer:
-			s := m.Snapshot()
 			measurement[Name] = name
-			measurement[Value] = float64(s.Count())
+			measurement[Value] = float64(m.Count())
 			batch.Measurements = append(batch.Measurements, measurement)
 			if m.Count() <= 0 {
 				return
@@ -211,11 +225,11 @@ func (rep *Reporter) BuildRequest(now time.Time, r metrics.Registry) (batch Batc
 			measurements := make([]Measurement, histogramMeasurementCount)
 			measurements[0] = Measurement{
 				Name:       appOpticsName,
-				Count:      uint64(s.Count()),
-				Sum:        s.Mean() * float64(s.Count()),
-				Max:        float64(s.Max()),
-				Min:        float64(s.Min()),
-				StdDev:     float64(s.StdDev()),
+				Count:      uint64(m.Count()),
+				Sum:        m.Mean() * float64(m.Count()),
+				Max:        float64(m.Max()),
+				Min:        float64(m.Min()),
+				StdDev:     float64(m.StdDev()),
 				Period:     int64(rep.Interval.Seconds()),
 				Attributes: rep.TimerAttributes,
 			}
@@ -231,7 +245,7 @@ func (rep *Reporter) BuildRequest(now time.Time, r metrics.Registry) (batch Batc
 			batch.Measurements = append(batch.Measurements,
 				Measurement{
 					Name:   fmt.Sprintf("%s.%s", name, "rate.1min"),
-					Value:  s.Rate1(),
+					Value:  m.Rate1(),
 					Period: int64(rep.Interval.Seconds()),
 					Attributes: map[string]interface{}{
 						DisplayUnitsLong:  Operations,
@@ -241,7 +255,7 @@ func (rep *Reporter) BuildRequest(now time.Time, r metrics.Registry) (batch Batc
 				},
 				Measurement{
 					Name:   fmt.Sprintf("%s.%s", name, "rate.5min"),
-					Value:  s.Rate5(),
+					Value:  m.Rate5(),
 					Period: int64(rep.Interval.Seconds()),
 					Attributes: map[string]interface{}{
 						DisplayUnitsLong:  Operations,
@@ -251,7 +265,7 @@ func (rep *Reporter) BuildRequest(now time.Time, r metrics.Registry) (batch Batc
 				},
 				Measurement{
 					Name:   fmt.Sprintf("%s.%s", name, "rate.15min"),
-					Value:  s.Rate15(),
+					Value:  m.Rate15(),
 					Period: int64(rep.Interval.Seconds()),
 					Attributes: map[string]interface{}{
 						DisplayUnitsLong:  Operations,
@@ -0,0 +1,298 @@
+package metrics
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// CardinalityLimitError is the error returned by LimitedRegistry.Register
+// when registering a metric would exceed a cardinality limit.
+type CardinalityLimitError struct {
+	Name   string // Name of the rejected metric.
+	Prefix string // Prefix whose limit was reached, or empty for the global limit.
+	Limit  int    // The limit that was reached.
+}
+
+func (err *CardinalityLimitError) Error() string {
+	if err.Prefix == "" {
+		return fmt.Sprintf("cardinality limit of %d metrics reached: %s",
+			err.Limit, err.Name)
+	}
+	return fmt.Sprintf("cardinality limit of %d metrics with prefix %q reached: %s",
+		err.Limit, err.Prefix, err.Name)
+}
+
+// CardinalityLimits configures a LimitedRegistry.
+type CardinalityLimits struct {
+	Max      int            // Maximum number of metrics, 0 for unlimited.
+	Prefixes map[string]int // Maximum number of metrics per name prefix, i.e "customer.".
+	Overflow string         // Name prefix of the overflow metrics, or empty to drop excess metrics.
+}
+
+// LimitedRegistry wraps a Registry and enforces a maximum number of metrics,
+// globally and per name prefix, to protect the process from a bug or an
+// attacker registering an unbounded number of distinct names.
+//
+// Register returns a *CardinalityLimitError for metrics beyond a limit.
+// GetOrRegister cannot fail, so it instead returns a metric of the requested
+// type that is shared by every excess registration: the metric registered
+// under the Overflow name followed by its type, i.e overflow.counter. If
+// Overflow is empty, the requested metric is returned but not registered, so
+// it is not exported. A name counts towards the most specific prefix that it
+// starts with.
+//
+// Only metrics registered through the LimitedRegistry are counted; metrics
+// which were registered in the underlying registry directly, and the
+// overflow metrics, are not. Metrics which leave the underlying registry
+// without going through the LimitedRegistry, i.e because they expire, stop
+// being counted through a subscription to the underlying registry, which
+// lasts until Close is called.
+type LimitedRegistry struct {
+	underlying  Registry
+	limits      CardinalityLimits
+	rejections  Counter
+	unsubscribe func()
+	mutex       sync.Mutex // Held while registering or unregistering a metric.
+
+	// The counted names have their own mutex, since the underlying registry
+	// sends its events while mutex is held.
+	countsMutex sync.Mutex
+	names       map[string]string // Registered names to their limited prefix.
+	counts      map[string]int    // Number of registered names per prefix.
+}
+
+// NewLimitedRegistry creates a new LimitedRegistry which registers metrics
+// in r, or DefaultRegistry if r is nil.
+func NewLimitedRegistry(r Registry, limits CardinalityLimits) *LimitedRegistry {
+	if r == nil {
+		r = DefaultRegistry
+	}
+	l := &LimitedRegistry{
+		underlying: r,
+		limits:     limits,
+		rejections: NewCounter(),
+		names:      map[string]string{},
+		counts:     map[string]int{},
+	}
+	l.unsubscribe = r.Subscribe(func(e RegistryEvent) {
+		if e.Type != MetricUnregistered {
+			return
+		}
+		l.countsMutex.Lock()
+		defer l.countsMutex.Unlock()
+		// The name may have been registered again since.
+		if _, ok := l.names[e.Name]; ok && r.Get(e.Name) == nil {
+			l.release(e.Name)
+		}
+	})
+	return l
+}
+
+// Close ends the subscription to the underlying registry, after which the
+// metrics which leave it without going through the LimitedRegistry stay
+// counted.
+func (r *LimitedRegistry) Close() {
+	r.unsubscribe()
+}
+
+// Rejections returns the number of registrations that exceeded a limit. It is
+// not registered.
+func (r *LimitedRegistry) Rejections() Counter {
+	return r.rejections
+}
+
+// Cardinality returns the number of metrics registered through the registry
+// per name prefix, for debugging. Names are grouped by their first depth
+// dot-separated segments, i.e with depth 1, customer.1.latency and
+// customer.2.latency are both counted under "customer.".
+func (r *LimitedRegistry) Cardinality(depth int) map[string]int {
+	r.countsMutex.Lock()
+	defer r.countsMutex.Unlock()
+	counts := map[string]int{}
+	for name := range r.names {
+		prefix := name
+		for i, n := 0, 0; i < len(name) && n < depth; i++ {
+			if name[i] == '.' {
+				if n++; n == depth {
+					prefix = name[:i+1]
+				}
+			}
+		}
+		counts[prefix]++
+	}
+	return counts
+}
+
+// Each calls the given function for each registered metric.
+func (r *LimitedRegistry) Each(f func(string, interface{})) {
+	r.underlying.Each(f)
+}
+
+// Get the metric by the given name or nil if none is registered.
+func (r *LimitedRegistry) Get(name string) interface{} {
+	return r.underlying.Get(name)
+}
+
+// GetAll metrics in the Registry.
+func (r *LimitedRegistry) GetAll() map[string]map[string]interface{} {
+	return r.underlying.GetAll()
+}
+
+// GetOrRegister gets an existing metric or registers the given one. If the
+// registration would exceed a limit, the overflow metric of the same type
+// is returned instead.
+func (r *LimitedRegistry) GetOrRegister(name string, i interface{}) interface{} {
+	if metric := r.underlying.Get(name); metric != nil {
+		return metric
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if metric := r.underlying.Get(name); metric != nil {
+		return metric
+	}
+	if v := reflect.ValueOf(i); v.Kind() == reflect.Func {
+		i = v.Call(nil)[0].Interface()
+	}
+	if err := r.reserve(name); err != nil {
+		if r.limits.Overflow == "" {
+			return i
+		}
+		return r.underlying.GetOrRegister(r.limits.Overflow+"."+metricKind(i), i)
+	}
+	return r.underlying.GetOrRegister(name, i)
+}
+
+// Register the given metric under the given name. Returns a
+// *CardinalityLimitError if the registration would exceed a limit.
+func (r *LimitedRegistry) Register(name string, i interface{}) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.underlying.Get(name) != nil {
+		return DuplicateMetric(name)
+	}
+	if err := r.reserve(name); err != nil {
+		return err
+	}
+	if err := r.underlying.Register(name, i); err != nil {
+		r.countsMutex.Lock()
+		r.release(name)
+		r.countsMutex.Unlock()
+		return err
+	}
+	return nil
+}
+
+// SinkOnce enqueues the given metric without registering it, allowing it to be
+// picked up by Each() only once.
+func (r *LimitedRegistry) SinkOnce(name string, i interface{}) {
+	r.underlying.SinkOnce(name, i)
+}
+
+// RunHealthchecks runs all registered healthchecks.
+func (r *LimitedRegistry) RunHealthchecks() {
+	r.underlying.RunHealthchecks()
+}
+
+// Unregister the metric with the given name.
+func (r *LimitedRegistry) Unregister(name string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.underlying.Unregister(name)
+	r.countsMutex.Lock()
+	r.release(name)
+	r.countsMutex.Unlock()
+}
+
+// UnregisterAll unregisters all metrics.  (Mostly for testing.)
+func (r *LimitedRegistry) UnregisterAll() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.underlying.UnregisterAll()
+	r.countsMutex.Lock()
+	r.names = map[string]string{}
+	r.counts = map[string]int{}
+	r.countsMutex.Unlock()
+}
+
+// Subscribe calls f with every subsequent registration and unregistration of
+// a metric in the underlying registry.
+func (r *LimitedRegistry) Subscribe(f func(RegistryEvent)) func() {
+	return r.underlying.Subscribe(f)
+}
+
+func (r *LimitedRegistry) underlyingRegistry(name string) (Registry, string) {
+	return r.underlying, name
+}
+
+// Counts name towards its limits, or returns a *CardinalityLimitError if a
+// limit was reached. Must be called with the mutex held.
+func (r *LimitedRegistry) reserve(name string) error {
+	r.countsMutex.Lock()
+	defer r.countsMutex.Unlock()
+	if _, ok := r.names[name]; ok {
+		return nil
+	}
+	prefix, limit := r.prefixLimit(name)
+	if r.limits.Max > 0 && len(r.names) >= r.limits.Max {
+		r.rejections.Inc(1)
+		return &CardinalityLimitError{Name: name, Limit: r.limits.Max}
+	}
+	if prefix != "" && r.counts[prefix] >= limit {
+		r.rejections.Inc(1)
+		return &CardinalityLimitError{Name: name, Prefix: prefix, Limit: limit}
+	}
+	r.names[name] = prefix
+	if prefix != "" {
+		r.counts[prefix]++
+	}
+	return nil
+}
+
+// Stops counting name. Must be called with countsMutex held.
+func (r *LimitedRegistry) release(name string) {
+	prefix, ok := r.names[name]
+	if !ok {
+		return
+	}
+	delete(r.names, name)
+	if prefix != "" {
+		r.counts[prefix]--
+	}
+}
+
+// Returns the longest limited prefix of name and its limit.
+func (r *LimitedRegistry) prefixLimit(name string) (string, int) {
+	var prefix string
+	var limit int
+	for p, l := range r.limits.Prefixes {
+		if strings.HasPrefix(name, p) && len(p) > len(prefix) {
+			prefix, limit = p, l
+		}
+	}
+	return prefix, limit
+}
+
+// Returns the name of the type of a metric, i.e "counter".
+func metricKind(i interface{}) string {
+	switch i.(type) {
+	case Counter:
+		return "counter"
+	case Gauge:
+		return "gauge"
+	case GaugeFloat64:
+		return "gauge_float64"
+	case Healthcheck:
+		return "healthcheck"
+	case Histogram:
+		return "histogram"
+	case Info:
+		return "info"
+	case Meter:
+		return "meter"
+	case Timer:
+		return "timer"
+	}
+	return "unknown"
+}
@@ -0,0 +1,130 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestLimitedRegistryMax(t *testing.T) {
+	r := NewLimitedRegistry(NewRegistry(), CardinalityLimits{Max: 2})
+	if err := r.Register("a", NewCounter()); err != nil {
+		t.Fatal(err)
+	}
+	GetOrRegisterCounter("b", r)
+	// Existing metrics are not counted twice.
+	GetOrRegisterCounter("b", r)
+
+	err := r.Register("c", NewCounter())
+	var limitErr *CardinalityLimitError
+	if !errors.As(err, &limitErr) || limitErr.Limit != 2 || limitErr.Name != "c" {
+		t.Fatalf("Register(): expected *CardinalityLimitError, got %v", err)
+	}
+	c := GetOrRegisterCounter("d", r)
+	c.Inc(1)
+	if r.Get("d") != nil {
+		t.Error("GetOrRegister(): registered a metric beyond the limit")
+	}
+	if n := r.Rejections().Count(); n != 2 {
+		t.Errorf("Rejections(): 2 != %d", n)
+	}
+
+	// Unregistering frees capacity.
+	r.Unregister("a")
+	if err := r.Register("c", NewCounter()); err != nil {
+		t.Errorf("Register(): %s", err)
+	}
+}
+
+func TestLimitedRegistryOverflow(t *testing.T) {
+	r := NewLimitedRegistry(NewRegistry(), CardinalityLimits{
+		Prefixes: map[string]int{"customer.": 2, "customer.vip.": 1},
+		Overflow: "overflow",
+	})
+	GetOrRegisterCounter("customer.1", r)
+	GetOrRegisterCounter("customer.2", r)
+	GetOrRegisterCounter("customer.3", r).Inc(1)
+	GetOrRegisterCounter("customer.4", r).Inc(2)
+	GetOrRegisterTimer("customer.5", r)
+	GetOrRegisterCounter("customer.vip.1", r)
+	GetOrRegisterCounter("other", r)
+
+	if c := r.Get("overflow.counter").(Counter).Count(); c != 3 {
+		t.Errorf("overflow.counter: 3 != %d", c)
+	}
+	if _, ok := r.Get("overflow.timer").(Timer); !ok {
+		t.Error("overflow.timer: not registered")
+	}
+	err := r.Register("customer.vip.2", NewCounter())
+	var limitErr *CardinalityLimitError
+	if !errors.As(err, &limitErr) || limitErr.Prefix != "customer.vip." {
+		t.Errorf("Register(): expected limit of customer.vip., got %v", err)
+	}
+
+	expect := map[string]int{"customer.": 3, "other": 1}
+	counts := r.Cardinality(1)
+	if len(counts) != len(expect) {
+		t.Errorf("Cardinality(): %v != %v", counts, expect)
+	}
+	for prefix, n := range expect {
+		if counts[prefix] != n {
+			t.Errorf("Cardinality()[%q]: %d != %d", prefix, counts[prefix], n)
+		}
+	}
+}
+
+func TestLimitedRegistryExpiry(t *testing.T) {
+	underlying := NewRegistry()
+	r := NewLimitedRegistry(underlying, CardinalityLimits{Max: 1})
+	GetOrRegisterCounter("a", r)
+	underlying.Unregister("a")
+	if err := r.Register("b", NewCounter()); err != nil {
+		t.Errorf("Register(): %s after the underlying registry dropped a", err)
+	}
+}
+
+// A registry which counts the calls to Get and GetAll.
+type countingRegistry struct {
+	*StandardRegistry
+	gets, getAlls int
+}
+
+func (r *countingRegistry) GetAll() map[string]map[string]interface{} {
+	r.getAlls++
+	return r.StandardRegistry.GetAll()
+}
+
+func (r *countingRegistry) Get(name string) interface{} {
+	r.gets++
+	return r.StandardRegistry.Get(name)
+}
+
+func TestLimitedRegistryClose(t *testing.T) {
+	underlying := NewRegistry()
+	r := NewLimitedRegistry(underlying, CardinalityLimits{Max: 1})
+	if err := r.Register("a", NewCounter()); err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	underlying.Unregister("a")
+	if err := r.Register("b", NewCounter()); err == nil {
+		t.Errorf("Register(): expected a limit error after Close")
+	}
+}
+
+func TestLimitedRegistryRejectionsDoNotRescan(t *testing.T) {
+	underlying := &countingRegistry{StandardRegistry: NewRegistry().(*StandardRegistry)}
+	r := NewLimitedRegistry(underlying, CardinalityLimits{Max: 1000})
+	for i := 0; i < 1000; i++ {
+		r.Register(fmt.Sprintf("m%d", i), NewCounter())
+	}
+	underlying.gets = 0
+	for i := 0; i < 100; i++ {
+		if err := r.Register(fmt.Sprintf("x%d", i), NewCounter()); err == nil {
+			t.Fatal("Register(): expected error beyond the limit")
+		}
+	}
+	if underlying.gets > 100 {
+		t.Errorf("Register(): %d calls to Get for 100 rejections", underlying.gets)
+	}
+}
@@ -0,0 +1,461 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// DefaultCgroupRoot is the mount point of the cgroup filesystem read by the
+// cgroup collector. Inside a container with its own cgroup namespace, this is
+// the container's cgroup.
+const DefaultCgroupRoot = "/sys/fs/cgroup"
+
+// Memory limits at or above this value mean the cgroup v1 memory controller
+// is unlimited; the kernel reports the page-aligned maximum of an int64.
+const cgroupV1Unlimited = 1 << 62
+
+// CgroupStats is the resource usage and limits of a cgroup. CPU times are in
+// microseconds and memory and IO values are in bytes. Limits are -1 if the
+// cgroup is unlimited.
+type CgroupStats struct {
+	Version             int     // Version of the cgroup hierarchy, 1 or 2.
+	CPUUsage            int64   // Total CPU time consumed.
+	CPUUser             int64   // User CPU time consumed.
+	CPUSystem           int64   // System CPU time consumed.
+	CPUPeriods          int64   // Number of enforcement periods elapsed.
+	CPUThrottledPeriods int64   // Number of periods in which the cgroup was throttled.
+	CPUThrottledTime    int64   // Total time the cgroup was throttled for.
+	CPULimit            float64 // CPU quota in cores.
+	MemoryUsage         int64   // Current memory usage.
+	MemoryLimit         int64   // Memory limit.
+	OOMEvents           int64   // Times the memory limit was reached and allocation failed.
+	OOMKillEvents       int64   // Processes killed by the OOM killer.
+	IOReadBytes         int64   // Bytes read from block devices.
+	IOWriteBytes        int64   // Bytes written to block devices.
+	IOReadOps           int64   // Read operations on block devices.
+	IOWriteOps          int64   // Write operations on block devices.
+	PIDs                int64   // Number of processes.
+	PIDsLimit           int64   // Maximum number of processes.
+}
+
+// ReadCgroupStats retrieves the resource usage of the cgroup mounted at root.
+// The cgroup v2 unified hierarchy is used when root contains
+// cgroup.controllers, otherwise the cgroup v1 controllers mounted under root
+// (i.e root/memory) are read. Controllers that are not enabled are skipped.
+// Every controller is read even if another could not be, so stats holds
+// whatever was available; the returned error joins the errors of the others.
+func ReadCgroupStats(root string, stats *CgroupStats) error {
+	var errs []error
+	for _, read := range cgroupReaders(root, stats) {
+		if err := read(); !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Returns the readers of the cpu, memory, io and pids controllers, in order.
+// A reader returns an error satisfying errors.Is(err, os.ErrNotExist) if its
+// controller is not enabled.
+func cgroupReaders(root string, stats *CgroupStats) []func() error {
+	if _, err := os.Stat(filepath.Join(root, "cgroup.controllers")); err == nil {
+		stats.Version = 2
+		return []func() error{
+			func() error { return readCgroupV2CPU(root, stats) },
+			func() error { return readCgroupV2Memory(root, stats) },
+			func() error { return readCgroupV2IO(root, stats) },
+			func() error { return readCgroupPIDs(root, stats) },
+		}
+	}
+	stats.Version = 1
+	return []func() error{
+		func() error { return readCgroupV1CPU(root, stats) },
+		func() error { return readCgroupV1Memory(root, stats) },
+		func() error { return readCgroupV1IO(root, stats) },
+		func() error { return readCgroupPIDs(filepath.Join(root, "pids"), stats) },
+	}
+}
+
+func readCgroupV2CPU(root string, stats *CgroupStats) error {
+	kv, err := readCgroupKeyValues(filepath.Join(root, "cpu.stat"))
+	if err != nil {
+		return err
+	}
+	stats.CPUUsage = kv["usage_usec"]
+	stats.CPUUser = kv["user_usec"]
+	stats.CPUSystem = kv["system_usec"]
+	stats.CPUPeriods = kv["nr_periods"]
+	stats.CPUThrottledPeriods = kv["nr_throttled"]
+	stats.CPUThrottledTime = kv["throttled_usec"]
+
+	// cpu.max holds "$MAX $PERIOD" and is absent in the root cgroup.
+	stats.CPULimit = -1
+	data, err := os.ReadFile(filepath.Join(root, "cpu.max"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) != 2 {
+		return fmt.Errorf("%s: malformed cpu.max", root)
+	}
+	if fields[0] == "max" {
+		return nil
+	}
+	quota, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return err
+	}
+	period, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil || period <= 0 {
+		return fmt.Errorf("%s: malformed cpu.max", root)
+	}
+	stats.CPULimit = quota / period
+	return nil
+}
+
+func readCgroupV2Memory(root string, stats *CgroupStats) error {
+	var err error
+	if stats.MemoryUsage, err = readCgroupInt(filepath.Join(root, "memory.current")); err != nil {
+		return err
+	}
+	stats.MemoryLimit, err = readCgroupInt(filepath.Join(root, "memory.max"))
+	if errors.Is(err, os.ErrNotExist) {
+		stats.MemoryLimit = -1
+	} else if err != nil {
+		return err
+	}
+	kv, err := readCgroupKeyValues(filepath.Join(root, "memory.events"))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	stats.OOMEvents = kv["oom"]
+	stats.OOMKillEvents = kv["oom_kill"]
+	return nil
+}
+
+// Sums io.stat over every device. Lines look like
+// "8:0 rbytes=1 wbytes=2 rios=3 wios=4 dbytes=0 dios=0".
+func readCgroupV2IO(root string, stats *CgroupStats) error {
+	data, err := os.ReadFile(filepath.Join(root, "io.stat"))
+	if err != nil {
+		return err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		for _, field := range fields[1:] {
+			key, value, ok := strings.Cut(field, "=")
+			if !ok {
+				continue
+			}
+			v, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return fmt.Errorf("%s: %s", root, err)
+			}
+			switch key {
+			case "rbytes":
+				stats.IOReadBytes += v
+			case "wbytes":
+				stats.IOWriteBytes += v
+			case "rios":
+				stats.IOReadOps += v
+			case "wios":
+				stats.IOWriteOps += v
+			}
+		}
+	}
+	return nil
+}
+
+// Reads pids.current and pids.max from dir, which is the same for both
+// versions.
+func readCgroupPIDs(dir string, stats *CgroupStats) error {
+	var err error
+	if stats.PIDs, err = readCgroupInt(filepath.Join(dir, "pids.current")); err != nil {
+		return err
+	}
+	stats.PIDsLimit, err = readCgroupInt(filepath.Join(dir, "pids.max"))
+	if errors.Is(err, os.ErrNotExist) {
+		stats.PIDsLimit = -1
+		return nil
+	}
+	return err
+}
+
+func readCgroupV1CPU(root string, stats *CgroupStats) error {
+	dir := cgroupV1Dir(root, "cpu,cpuacct", "cpuacct", "cpu")
+	usage, err := readCgroupInt(filepath.Join(dir, "cpuacct.usage"))
+	if err != nil {
+		return err
+	}
+	stats.CPUUsage = usage / 1000
+
+	// cpuacct.stat is in USER_HZ ticks.
+	kv, err := readCgroupKeyValues(filepath.Join(dir, "cpuacct.stat"))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	stats.CPUUser = kv["user"] * 1000000 / userHZ
+	stats.CPUSystem = kv["system"] * 1000000 / userHZ
+
+	dir = cgroupV1Dir(root, "cpu,cpuacct", "cpu")
+	kv, err = readCgroupKeyValues(filepath.Join(dir, "cpu.stat"))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	stats.CPUPeriods = kv["nr_periods"]
+	stats.CPUThrottledPeriods = kv["nr_throttled"]
+	stats.CPUThrottledTime = kv["throttled_time"] / 1000
+
+	stats.CPULimit = -1
+	quota, err := readCgroupInt(filepath.Join(dir, "cpu.cfs_quota_us"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	period, err := readCgroupInt(filepath.Join(dir, "cpu.cfs_period_us"))
+	if err != nil {
+		return err
+	}
+	if quota > 0 && period > 0 {
+		stats.CPULimit = float64(quota) / float64(period)
+	}
+	return nil
+}
+
+func readCgroupV1Memory(root string, stats *CgroupStats) error {
+	dir := filepath.Join(root, "memory")
+	var err error
+	if stats.MemoryUsage, err = readCgroupInt(filepath.Join(dir, "memory.usage_in_bytes")); err != nil {
+		return err
+	}
+	if stats.MemoryLimit, err = readCgroupInt(filepath.Join(dir, "memory.limit_in_bytes")); err != nil {
+		return err
+	}
+	if stats.MemoryLimit >= cgroupV1Unlimited {
+		stats.MemoryLimit = -1
+	}
+	// cgroup v1 has no count of failed allocations besides failcnt, which
+	// counts every time the limit was hit.
+	if stats.OOMEvents, err = readCgroupInt(filepath.Join(dir, "memory.failcnt")); err != nil &&
+		!errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	kv, err := readCgroupKeyValues(filepath.Join(dir, "memory.oom_control"))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	stats.OOMKillEvents = kv["oom_kill"]
+	return nil
+}
+
+// Sums blkio.throttle.io_service_bytes and io_serviced over every device.
+// Lines look like "8:0 Read 4096", followed by a "Total" line.
+func readCgroupV1IO(root string, stats *CgroupStats) error {
+	dir := filepath.Join(root, "blkio")
+	for _, f := range []struct {
+		name        string
+		read, write *int64
+	}{
+		{"blkio.throttle.io_service_bytes", &stats.IOReadBytes, &stats.IOWriteBytes},
+		{"blkio.throttle.io_serviced", &stats.IOReadOps, &stats.IOWriteOps},
+	} {
+		data, err := os.ReadFile(filepath.Join(dir, f.name))
+		if err != nil {
+			return err
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			fields := strings.Fields(line)
+			if len(fields) != 3 {
+				continue
+			}
+			v, err := strconv.ParseInt(fields[2], 10, 64)
+			if err != nil {
+				return fmt.Errorf("%s: %s", f.name, err)
+			}
+			switch fields[1] {
+			case "Read":
+				*f.read += v
+			case "Write":
+				*f.write += v
+			}
+		}
+	}
+	return nil
+}
+
+// Returns the first cgroup v1 controller directory under root which exists,
+// as controllers may be co-mounted, i.e cpu,cpuacct.
+func cgroupV1Dir(root string, names ...string) string {
+	for _, name := range names {
+		dir := filepath.Join(root, name)
+		if _, err := os.Stat(dir); err == nil {
+			return dir
+		}
+	}
+	return filepath.Join(root, names[0])
+}
+
+// Reads a file holding a single integer or "max", which is returned as -1.
+func readCgroupInt(path string) (int64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	value := strings.TrimSpace(string(data))
+	if value == "max" {
+		return -1, nil
+	}
+	v, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %s", path, err)
+	}
+	return v, nil
+}
+
+// Reads a flat keyed file, i.e cpu.stat. The returned map is never nil.
+func readCgroupKeyValues(path string) (map[string]int64, error) {
+	kv := map[string]int64{}
+	err := scanProcFile(path, func(key, value string) error {
+		v, err := strconv.ParseInt(value, 10, 64)
+		kv[key] = v
+		return err
+	})
+	return kv, err
+}
+
+// CgroupCollector captures the resource usage exported in CgroupStats into
+// the metrics of a single registry. The metrics are named by their
+// fully-qualified Go symbols, i.e cgroup.CgroupStats.MemoryUsage. Besides
+// the raw stats, it exports the utilization of each limit as a ratio:
+// cgroup.MemoryUtilization, cgroup.PIDsUtilization and
+// cgroup.CPUThrottledRatio, the share of periods that were throttled.
+type CgroupCollector struct {
+	root     string
+	gauges   map[string]Gauge
+	counters map[string]Counter
+	floats   map[string]GaugeFloat64
+}
+
+// NewCgroupCollector constructs a new CgroupCollector and registers its
+// metrics in r. The cgroup filesystem is read from root, or
+// DefaultCgroupRoot if root is empty.
+func NewCgroupCollector(r Registry, root string) *CgroupCollector {
+	if r == nil {
+		r = DefaultRegistry
+	}
+	if root == "" {
+		root = DefaultCgroupRoot
+	}
+	c := &CgroupCollector{
+		root:     root,
+		gauges:   map[string]Gauge{},
+		counters: map[string]Counter{},
+		floats:   map[string]GaugeFloat64{},
+	}
+	for _, name := range []string{"MemoryUsage", "MemoryLimit", "PIDs",
+		"PIDsLimit"} {
+		c.gauges[name] = GetOrRegisterGauge("cgroup.CgroupStats."+name, r)
+	}
+	for _, name := range []string{"CPUUsage", "CPUUser", "CPUSystem",
+		"CPUPeriods", "CPUThrottledPeriods", "CPUThrottledTime", "OOMEvents",
+		"OOMKillEvents", "IOReadBytes", "IOWriteBytes", "IOReadOps",
+		"IOWriteOps"} {
+		c.counters[name] = GetOrRegisterCounter("cgroup.CgroupStats."+name, r)
+	}
+	c.floats["CPULimit"] = GetOrRegisterGaugeFloat64("cgroup.CgroupStats.CPULimit", r)
+	for _, name := range []string{"MemoryUtilization", "PIDsUtilization",
+		"CPUThrottledRatio"} {
+		c.floats[name] = GetOrRegisterGaugeFloat64("cgroup."+name, r)
+	}
+	return c
+}
+
+// Capture reads the cgroup stats and updates their metrics. Metrics of
+// controllers that are not enabled or could not be read keep their previous
+// values; read failures are returned as a *CollectorError.
+func (c *CgroupCollector) Capture() error {
+	var stats CgroupStats
+	readers := cgroupReaders(c.root, &stats)
+	var errs []error
+	update := func(err error, gauges, counters map[string]int64,
+		floats map[string]float64) {
+		if errors.Is(err, os.ErrNotExist) {
+			return
+		} else if err != nil {
+			errs = append(errs, err)
+			return
+		}
+		for name, v := range gauges {
+			c.gauges[name].Update(v)
+		}
+		for name, v := range counters {
+			counter := c.counters[name]
+			counter.Inc(v - counter.Count())
+		}
+		for name, v := range floats {
+			c.floats[name].Update(v)
+		}
+	}
+
+	err := readers[0]()
+	update(err, nil, map[string]int64{
+		"CPUUsage":            stats.CPUUsage,
+		"CPUUser":             stats.CPUUser,
+		"CPUSystem":           stats.CPUSystem,
+		"CPUPeriods":          stats.CPUPeriods,
+		"CPUThrottledPeriods": stats.CPUThrottledPeriods,
+		"CPUThrottledTime":    stats.CPUThrottledTime,
+	}, map[string]float64{
+		"CPULimit":          stats.CPULimit,
+		"CPUThrottledRatio": ratio(stats.CPUThrottledPeriods, stats.CPUPeriods),
+	})
+	err = readers[1]()
+	update(err, map[string]int64{
+		"MemoryUsage": stats.MemoryUsage,
+		"MemoryLimit": stats.MemoryLimit,
+	}, map[string]int64{
+		"OOMEvents":     stats.OOMEvents,
+		"OOMKillEvents": stats.OOMKillEvents,
+	}, map[string]float64{
+		"MemoryUtilization": ratio(stats.MemoryUsage, stats.MemoryLimit),
+	})
+	err = readers[2]()
+	update(err, nil, map[string]int64{
+		"IOReadBytes":  stats.IOReadBytes,
+		"IOWriteBytes": stats.IOWriteBytes,
+		"IOReadOps":    stats.IOReadOps,
+		"IOWriteOps":   stats.IOWriteOps,
+	}, nil)
+	err = readers[3]()
+	update(err, map[string]int64{
+		"PIDs":      stats.PIDs,
+		"PIDsLimit": stats.PIDsLimit,
+	}, nil, map[string]float64{
+		"PIDsUtilization": ratio(stats.PIDs, stats.PIDsLimit),
+	})
+	return collected("cgroup", errors.Join(errs...))
+}
+
+// Collect implements Collector.
+func (c *CgroupCollector) Collect(ctx context.Context) error {
+	return c.Capture()
+}
+
+// Returns n/d, or 0 if d is not positive, i.e an unlimited limit.
+func ratio(n, d int64) float64 {
+	if d <= 0 {
+		return 0
+	}
+	return float64(n) / float64(d)
+}
@@ -0,0 +1,107 @@
+package metrics
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadCgroupStatsV2(t *testing.T) {
+	var stats CgroupStats
+	if err := ReadCgroupStats("testdata/cgroup/v2", &stats); err != nil {
+		t.Fatalf("ReadCgroupStats(): %s", err)
+	}
+	expect := CgroupStats{
+		Version:             2,
+		CPUUsage:            5000000,
+		CPUUser:             3000000,
+		CPUSystem:           2000000,
+		CPUPeriods:          100,
+		CPUThrottledPeriods: 25,
+		CPUThrottledTime:    400000,
+		CPULimit:            1.5,
+		MemoryUsage:         268435456,
+		MemoryLimit:         536870912,
+		OOMEvents:           2,
+		OOMKillEvents:       1,
+		IOReadBytes:         1500,
+		IOWriteBytes:        2000,
+		IOReadOps:           15,
+		IOWriteOps:          20,
+		PIDs:                12,
+		PIDsLimit:           -1,
+	}
+	if stats != expect {
+		t.Errorf("ReadCgroupStats():\n%+v !=\n%+v", stats, expect)
+	}
+}
+
+func TestReadCgroupStatsV1(t *testing.T) {
+	var stats CgroupStats
+	if err := ReadCgroupStats("testdata/cgroup/v1", &stats); err != nil {
+		t.Fatalf("ReadCgroupStats(): %s", err)
+	}
+	expect := CgroupStats{
+		Version:             1,
+		CPUUsage:            5000000,
+		CPUUser:             3000000,
+		CPUSystem:           2000000,
+		CPUPeriods:          100,
+		CPUThrottledPeriods: 25,
+		CPUThrottledTime:    400000,
+		CPULimit:            0.5,
+		MemoryUsage:         268435456,
+		MemoryLimit:         -1,
+		OOMEvents:           3,
+		OOMKillEvents:       1,
+		IOReadBytes:         1000,
+		IOWriteBytes:        2000,
+		IOReadOps:           10,
+		IOWriteOps:          20,
+		PIDs:                12,
+		PIDsLimit:           100,
+	}
+	if stats != expect {
+		t.Errorf("ReadCgroupStats():\n%+v !=\n%+v", stats, expect)
+	}
+}
+
+func TestCgroupCollector(t *testing.T) {
+	r := NewRegistry()
+	if err := NewCgroupCollector(r, "testdata/cgroup/v2").Capture(); err != nil {
+		t.Fatalf("Capture(): %s", err)
+	}
+	if v := r.Get("cgroup.MemoryUtilization").(GaugeFloat64).Value(); v != 0.5 {
+		t.Errorf("cgroup.MemoryUtilization: %v != 0.5", v)
+	}
+	if v := r.Get("cgroup.CPUThrottledRatio").(GaugeFloat64).Value(); v != 0.25 {
+		t.Errorf("cgroup.CPUThrottledRatio: %v != 0.25", v)
+	}
+	if v := r.Get("cgroup.CgroupStats.OOMKillEvents").(Counter).Count(); v != 1 {
+		t.Errorf("cgroup.CgroupStats.OOMKillEvents: %d != 1", v)
+	}
+	if v := r.Get("cgroup.PIDsUtilization").(GaugeFloat64).Value(); v != 0 {
+		t.Errorf("cgroup.PIDsUtilization: %v != 0 for unlimited pids", v)
+	}
+}
+
+func TestCgroupCollectorDisabledController(t *testing.T) {
+	// A cgroup v2 tree without the io controller enabled.
+	root := t.TempDir()
+	for _, name := range []string{"cgroup.controllers", "memory.current"} {
+		data, err := os.ReadFile(filepath.Join("testdata/cgroup/v2", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(root, name), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r := NewRegistry()
+	if err := NewCgroupCollector(r, root).Capture(); err != nil {
+		t.Fatalf("Capture(): %s", err)
+	}
+	if v := r.Get("cgroup.CgroupStats.MemoryLimit").(Gauge).Value(); v != -1 {
+		t.Errorf("cgroup.CgroupStats.MemoryLimit: %d != -1", v)
+	}
+}
@@ -0,0 +1,325 @@
+package metrics
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ErrReadOnlyRegistry is the error returned by CompositeRegistry.Register.
+var ErrReadOnlyRegistry = errors.New("registry is read-only")
+
+// CompositeRegistry is a read-only view which merges several registries, i.e
+// one per worker pool, so that they can be exported together without
+// registering their metrics twice. It either namespaces the metrics by
+// source, or aggregates the metrics with the same name.
+//
+// Register returns ErrReadOnlyRegistry, GetOrRegister returns the given metric
+// without registering it unless the metric exists, and SinkOnce, Unregister
+// and UnregisterAll are no-ops: metrics must be registered in the sources.
+// RunHealthchecks runs the healthchecks of every source.
+type CompositeRegistry struct {
+	namespaces []string // Namespace of each source, or nil to aggregate.
+	sources    []Registry
+}
+
+// NewCompositeRegistry creates a new CompositeRegistry which reports the
+// metrics of each source under its namespace, i.e the metric foo of the
+// source "pool1" is reported as pool1.foo.
+func NewCompositeRegistry(sources map[string]Registry) *CompositeRegistry {
+	r := &CompositeRegistry{}
+	for ns := range sources {
+		r.namespaces = append(r.namespaces, ns)
+	}
+	sort.Strings(r.namespaces)
+	for _, ns := range r.namespaces {
+		r.sources = append(r.sources, sources[ns])
+	}
+	return r
+}
+
+// NewAggregateRegistry creates a new CompositeRegistry which reports the
+// metrics of the same name and labels in the sources as one metric: counters,
+// gauges and the counts and rates of meters and timers are summed, the samples
+// of histograms and timers are combined, and healthchecks are unhealthy if any
+// of them is. Since gauges are summed, gauges which do not add up across
+// sources, i.e a temperature, should be namespaced instead. The samples of
+// timers other than StandardTimers cannot be read, so only their counts are
+// kept. The first source's metric is reported if the metrics have different
+// types, and for Infos.
+func NewAggregateRegistry(sources ...Registry) *CompositeRegistry {
+	return &CompositeRegistry{sources: sources}
+}
+
+// Each calls the given function for each metric. Aggregated metrics are
+// snapshots.
+func (r *CompositeRegistry) Each(f func(string, interface{})) {
+	if r.namespaces == nil {
+		r.Snapshot().Each(f)
+		return
+	}
+	for i, src := range r.sources {
+		ns := r.namespaces[i] + "."
+		src.Each(func(name string, metric interface{}) {
+			f(ns+name, metric)
+		})
+	}
+}
+
+// Get the metric by the given name or nil if none is registered. Aggregated
+// metrics are snapshots.
+func (r *CompositeRegistry) Get(name string) interface{} {
+	if r.namespaces == nil {
+		var s RegistrySnapshot
+		for _, src := range r.sources {
+			if metric := src.Get(name); metric != nil {
+				s = append(s, MetricSnapshot{Name: name, Metric: snapshotMetric(metric)})
+			}
+		}
+		return s.aggregate().Get(name)
+	}
+	for i, src := range r.sources {
+		if rest := strings.TrimPrefix(name, r.namespaces[i]+"."); rest != name {
+			if metric := src.Get(rest); metric != nil {
+				return metric
+			}
+		}
+	}
+	return nil
+}
+
+// GetAll metrics in the Registry. Like Snapshot, it dequeues the metrics
+// stored with SinkOnce in the sources.
+func (r *CompositeRegistry) GetAll() map[string]map[string]interface{} {
+	return r.Snapshot().GetAll()
+}
+
+// GetOrRegister returns an existing metric, or the given one without
+// registering it, so that updates to it are discarded.
+func (r *CompositeRegistry) GetOrRegister(name string, i interface{}) interface{} {
+	if metric := r.Get(name); metric != nil {
+		return metric
+	}
+	if v := reflect.ValueOf(i); v.Kind() == reflect.Func {
+		i = v.Call(nil)[0].Interface()
+	}
+	return i
+}
+
+// Register returns ErrReadOnlyRegistry.
+func (r *CompositeRegistry) Register(string, interface{}) error {
+	return ErrReadOnlyRegistry
+}
+
+// SinkOnce is a no-op.
+func (r *CompositeRegistry) SinkOnce(string, interface{}) {}
+
+// RunHealthchecks runs the healthchecks of every source.
+func (r *CompositeRegistry) RunHealthchecks() {
+	for _, src := range r.sources {
+		src.RunHealthchecks()
+	}
+}
+
+// Unregister is a no-op.
+func (r *CompositeRegistry) Unregister(string) {}
+
+// UnregisterAll is a no-op.
+func (r *CompositeRegistry) UnregisterAll() {}
+
+// Snapshot returns a RegistrySnapshot of the metrics of every source.
+func (r *CompositeRegistry) Snapshot() RegistrySnapshot {
+	var all RegistrySnapshot
+	for i, src := range r.sources {
+		for _, m := range src.Snapshot() {
+			if r.namespaces != nil {
+				m.Name = r.namespaces[i] + "." + m.Name
+			}
+			all = append(all, m)
+		}
+	}
+	if r.namespaces == nil {
+		return all.aggregate()
+	}
+	sort.SliceStable(all, func(i, j int) bool { return all[i].Name < all[j].Name })
+	return all
+}
+
+// Subscribe calls f with every subsequent registration and unregistration of
+// a metric in a source. When aggregating, a registration is only reported
+// if no other source has the metric, and an unregistration if no source has
+// it anymore.
+func (r *CompositeRegistry) Subscribe(f func(RegistryEvent)) func() {
+	unsubscribes := make([]func(), len(r.sources))
+	for i, src := range r.sources {
+		handler := func(e RegistryEvent) {
+			if r.namespaces == nil {
+				n := 0
+				for _, src := range r.sources {
+					if Lookup(src, e.Name) != nil {
+						n++
+					}
+				}
+				if (e.Type == MetricRegistered && n != 1) ||
+					(e.Type == MetricUnregistered && n != 0) {
+					return
+				}
+			}
+			f(e)
+		}
+		if r.namespaces != nil {
+			ns := r.namespaces[i] + "."
+			handler = func(e RegistryEvent) {
+				e.Name = ns + e.Name
+				f(e)
+			}
+		}
+		unsubscribes[i] = src.Subscribe(handler)
+	}
+	return func() {
+		for _, unsubscribe := range unsubscribes {
+			unsubscribe()
+		}
+	}
+}
+
+// Only the metrics of namespaced sources are registered under the names which
+// the CompositeRegistry reports.
+func (r *CompositeRegistry) underlyingRegistry(name string) (Registry, string) {
+	if r.namespaces == nil {
+		return nil, ""
+	}
+	for i, src := range r.sources {
+		if rest := strings.TrimPrefix(name, r.namespaces[i]+"."); rest != name {
+			if base, name := resolve(src, rest); base != nil && base.Get(name) != nil {
+				return base, name
+			}
+		}
+	}
+	return nil, ""
+}
+
+// Returns a sorted snapshot in which the metrics with the same name and
+// labels are aggregated.
+func (s RegistrySnapshot) aggregate() RegistrySnapshot {
+	var aggregated RegistrySnapshot
+	index := map[string]int{}
+	for _, m := range s {
+		labels := MetricLabels(m.Metric)
+		key := m.Name
+		if _, ok := m.Metric.(Info); !ok && len(labels) > 0 {
+			key += formatLabels(labels)
+		}
+		i, ok := index[key]
+		if !ok {
+			index[key] = len(aggregated)
+			aggregated = append(aggregated, m)
+			continue
+		}
+		if _, ok := m.Metric.(Info); ok {
+			continue
+		}
+		metric := aggregateMetrics(unlabeled(aggregated[i].Metric), unlabeled(m.Metric))
+		aggregated[i].Metric = WithLabels(metric, labels)
+	}
+	sort.SliceStable(aggregated, func(i, j int) bool { return aggregated[i].Name < aggregated[j].Name })
+	return aggregated
+}
+
+// Returns the aggregate of two metric snapshots, or a if they cannot be
+// aggregated. Gauges are summed.
+func aggregateMetrics(a, b interface{}) interface{} {
+	switch a := a.(type) {
+	case Counter:
+		if b, ok := b.(Counter); ok {
+			return CounterSnapshot{count: a.Count() + b.Count()}
+		}
+	case Gauge:
+		if b, ok := b.(Gauge); ok {
+			return GaugeSnapshot{value: a.Value() + b.Value()}
+		}
+	case GaugeFloat64:
+		if b, ok := b.(GaugeFloat64); ok {
+			return GaugeFloat64Snapshot{value: a.Value() + b.Value()}
+		}
+	case Healthcheck:
+		if b, ok := b.(Healthcheck); ok {
+			return HealthcheckSnapshot{err: errors.Join(a.Error(), b.Error())}
+		}
+	case Histogram:
+		if b, ok := b.(Histogram); ok {
+			return &HistogramSnapshot{sample: mergeSamples(a.Sample(), b.Sample())}
+		}
+	case Meter:
+		if b, ok := b.(Meter); ok {
+			return mergeMeters(a, b)
+		}
+	case Timer:
+		if b, ok := b.(Timer); ok {
+			return &TimerSnapshot{
+				histogram: &HistogramSnapshot{
+					sample: mergeSamples(timerSample(a), timerSample(b)),
+				},
+				meter: mergeMeters(a, b),
+			}
+		}
+	}
+	return a
+}
+
+// Returns the sample of a timer snapshot, or one with only its count if the
+// timer is not a StandardTimer.
+func timerSample(t Timer) Sample {
+	if t, ok := t.(*TimerSnapshot); ok {
+		return t.histogram.sample
+	}
+	return NewSampleSnapshot(t.Count(), nil)
+}
+
+// The methods which meters and timers have in common.
+type rates interface {
+	Count() int64
+	Rate1() float64
+	Rate5() float64
+	Rate15() float64
+	RateMean() float64
+}
+
+func mergeMeters(a, b rates) *MeterSnapshot {
+	return &MeterSnapshot{
+		count:    a.Count() + b.Count(),
+		rate1:    a.Rate1() + b.Rate1(),
+		rate5:    a.Rate5() + b.Rate5(),
+		rate15:   a.Rate15() + b.Rate15(),
+		rateMean: a.RateMean() + b.RateMean(),
+	}
+}
+
+// Returns a sample snapshot with the values of a and b. Bucket samples are
+// combined if they have the same bounds.
+func mergeSamples(a, b Sample) Sample {
+	if a, ok := a.(*BucketSampleSnapshot); ok {
+		if b, ok := b.(*BucketSampleSnapshot); ok && equalFloats(a.bounds, b.bounds) {
+			counts := make([]int64, len(a.counts))
+			for i := range counts {
+				counts[i] = a.counts[i] + b.counts[i]
+			}
+			return &BucketSampleSnapshot{bounds: a.bounds, counts: counts}
+		}
+	}
+	values := append(append([]int64{}, a.Values()...), b.Values()...)
+	return NewSampleSnapshot(a.Count()+b.Count(), values)
+}
+
+func equalFloats(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
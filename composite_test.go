@@ -0,0 +1,193 @@
+package metrics
+
+import (
+	"errors"
+	"sort"
+	"testing"
+)
+
+func TestCompositeRegistry(t *testing.T) {
+	pool1, pool2 := NewRegistry(), NewRegistry()
+	GetOrRegisterCounter("jobs", pool1).Inc(1)
+	GetOrRegisterCounter("jobs", pool2).Inc(2)
+	GetOrRegisterGauge("workers", pool2).Update(4)
+
+	r := NewCompositeRegistry(map[string]Registry{"pool1": pool1, "pool2": pool2})
+	var names []string
+	r.Each(func(name string, i interface{}) { names = append(names, name) })
+	sort.Strings(names)
+	if len(names) != 3 || names[0] != "pool1.jobs" || names[1] != "pool2.jobs" || names[2] != "pool2.workers" {
+		t.Errorf("Each(): %v != [pool1.jobs pool2.jobs pool2.workers]", names)
+	}
+	if c, ok := r.Get("pool2.jobs").(Counter); !ok || c.Count() != 2 {
+		t.Errorf("Get(pool2.jobs): %v", r.Get("pool2.jobs"))
+	}
+	if m := r.Get("pool1.workers"); m != nil {
+		t.Errorf("Get(pool1.workers): %v != nil", m)
+	}
+	if all := r.GetAll(); len(all) != 3 || all["pool1.jobs"]["count"] != int64(1) {
+		t.Errorf("GetAll(): %v", all)
+	}
+	if s := r.Snapshot(); len(s) != 3 || s.Get("pool2.workers").(Gauge).Value() != 4 {
+		t.Errorf("Snapshot(): %v", s)
+	}
+	if c, ok := Lookup(r, "pool1.jobs").(Counter); !ok || c.Count() != 1 {
+		t.Errorf("Lookup(pool1.jobs): %v", Lookup(r, "pool1.jobs"))
+	}
+
+	var events []RegistryEvent
+	unsubscribe := r.Subscribe(func(e RegistryEvent) { events = append(events, e) })
+	GetOrRegisterMeter("rate", pool1)
+	unsubscribe()
+	GetOrRegisterMeter("rate", pool2)
+	if len(events) != 1 || events[0].Name != "pool1.rate" {
+		t.Errorf("Subscribe(): %v", events)
+	}
+}
+
+func TestCompositeRegistryReadOnly(t *testing.T) {
+	pool := NewRegistry()
+	GetOrRegisterCounter("jobs", pool)
+	r := NewAggregateRegistry(pool)
+	if err := r.Register("foo", NewCounter()); err != ErrReadOnlyRegistry {
+		t.Errorf("Register(): %v != %v", err, ErrReadOnlyRegistry)
+	}
+	if c := GetOrRegisterCounter("jobs", r); c == nil {
+		t.Error("GetOrRegisterCounter(): nil")
+	}
+	GetOrRegisterCounter("bar", r).Inc(1)
+	if r.Get("bar") != nil || pool.Get("bar") != nil {
+		t.Error("GetOrRegisterCounter(): registered bar")
+	}
+	r.Unregister("jobs")
+	r.UnregisterAll()
+	if all := pool.GetAll(); len(all) != 1 || all["jobs"] == nil {
+		t.Errorf("GetAll(): %v", all)
+	}
+}
+
+func TestAggregateRegistry(t *testing.T) {
+	pool1, pool2 := NewRegistry(), NewRegistry()
+	GetOrRegisterCounter("jobs", pool1).Inc(1)
+	GetOrRegisterCounter("jobs", pool2).Inc(2)
+	GetOrRegisterGauge("workers", pool1).Update(3)
+	GetOrRegisterGauge("workers", pool2).Update(4)
+	GetOrRegisterGaugeFloat64("load", pool2).Update(0.5)
+	h1 := GetOrRegisterHistogram("size", pool1, NewUniformSample(100))
+	h2 := GetOrRegisterHistogram("size", pool2, NewUniformSample(100))
+	h1.Update(1)
+	h2.Update(2)
+	h2.Update(3)
+	GetOrRegisterMeter("rate", pool1).Mark(5)
+	GetOrRegisterMeter("rate", pool2).Mark(6)
+	GetOrRegisterTimer("latency", pool1).Update(10)
+	GetOrRegisterTimer("latency", pool2).Update(20)
+	pool1.Register("health", NewHealthcheck(func(h Healthcheck) { h.Healthy() }))
+	pool2.Register("health", NewHealthcheck(func(h Healthcheck) { h.Unhealthy(errors.New("down")) }))
+	GetOrRegisterCounter("mixed", pool1).Inc(7)
+	GetOrRegisterGauge("mixed", pool2).Update(8)
+
+	r := NewAggregateRegistry(pool1, pool2)
+	r.RunHealthchecks()
+	s := r.Snapshot()
+	if len(s) != 8 {
+		t.Fatalf("Snapshot(): %v", s)
+	}
+	if c := s.Get("jobs").(Counter); c.Count() != 3 {
+		t.Errorf("jobs.Count(): %v != 3", c.Count())
+	}
+	if g := s.Get("workers").(Gauge); g.Value() != 7 {
+		t.Errorf("workers.Value(): %v != 7", g.Value())
+	}
+	if g := s.Get("load").(GaugeFloat64); g.Value() != 0.5 {
+		t.Errorf("load.Value(): %v != 0.5", g.Value())
+	}
+	if h := s.Get("size").(Histogram); h.Count() != 3 || h.Sum() != 6 || h.Max() != 3 {
+		t.Errorf("size: %v, %v, %v != 3, 6, 3", h.Count(), h.Sum(), h.Max())
+	}
+	if m := s.Get("rate").(Meter); m.Count() != 11 {
+		t.Errorf("rate.Count(): %v != 11", m.Count())
+	}
+	if tm := s.Get("latency").(Timer); tm.Count() != 2 || tm.Sum() != 30 {
+		t.Errorf("latency: %v, %v != 2, 30", tm.Count(), tm.Sum())
+	}
+	if h := s.Get("health").(Healthcheck); h.Error() == nil || h.Error().Error() != "down" {
+		t.Errorf("health.Error(): %v != down", h.Error())
+	}
+	if c, ok := s.Get("mixed").(Counter); !ok || c.Count() != 7 {
+		t.Errorf("mixed: %v", s.Get("mixed"))
+	}
+	if c, ok := r.Get("jobs").(Counter); !ok || c.Count() != 3 {
+		t.Errorf("Get(jobs): %v", r.Get("jobs"))
+	}
+	if all := r.GetAll(); len(all) != 8 || all["jobs"]["count"] != int64(3) {
+		t.Errorf("GetAll(): %v", all)
+	}
+
+	var events []RegistryEvent
+	unsubscribe := r.Subscribe(func(e RegistryEvent) { events = append(events, e) })
+	defer unsubscribe()
+	GetOrRegisterCounter("new", pool1)
+	GetOrRegisterCounter("new", pool2)
+	pool1.Unregister("new")
+	pool2.Unregister("new")
+	if len(events) != 2 || events[0].Type != MetricRegistered || events[1].Type != MetricUnregistered {
+		t.Errorf("Subscribe(): %v", events)
+	}
+}
+
+func TestAggregateRegistryLabels(t *testing.T) {
+	pool1, pool2 := NewRegistry(), NewRegistry()
+	GetOrRegisterCounter("http.GET", pool1).Inc(1)
+	GetOrRegisterCounter("http.GET", pool2).Inc(2)
+	GetOrRegisterCounter("http.POST", pool2).Inc(4)
+	rules := []RewriteRule{{Template: "http.{method}"}}
+	r1, _ := NewRewriteRegistry(pool1, rules)
+	r2, _ := NewRewriteRegistry(pool2, rules)
+
+	r := NewAggregateRegistry(r1, r2)
+	if all := r.GetAll(); len(all) != 2 || all[`http{method="GET"}`]["count"] != int64(3) {
+		t.Errorf("GetAll(): %v", all)
+	}
+	s := r.Snapshot()
+	if len(s) != 2 {
+		t.Fatalf("Snapshot(): %v", s)
+	}
+	for _, m := range s {
+		want := map[string]int64{"GET": 3, "POST": 4}[MetricLabels(m.Metric)["method"]]
+		if c := m.Metric.(Counter); c.Count() != want {
+			t.Errorf("%s%v: %v != %v", m.Name, MetricLabels(m.Metric), c.Count(), want)
+		}
+	}
+}
+
+func TestAggregateBucketSamples(t *testing.T) {
+	pool1, pool2 := NewRegistry(), NewRegistry()
+	bounds := []float64{1, 10}
+	GetOrRegisterHistogram("size", pool1, NewBucketSample(bounds)).Update(5)
+	GetOrRegisterHistogram("size", pool2, NewBucketSample(bounds)).Update(50)
+
+	h := NewAggregateRegistry(pool1, pool2).Get("size").(Histogram)
+	if _, ok := h.Sample().(*BucketSampleSnapshot); !ok || h.Count() != 2 {
+		t.Errorf("Sample(): %T, Count(): %v != *BucketSampleSnapshot, 2", h.Sample(), h.Count())
+	}
+}
+
+// A Timer which is not a StandardTimer.
+type customTimer struct{ Timer }
+
+func (t customTimer) Snapshot() Timer { return t }
+
+func TestAggregateRegistryCustomTimers(t *testing.T) {
+	pool1, pool2 := NewRegistry(), NewRegistry()
+	t1, t2 := NewTimer(), NewTimer()
+	t1.Update(10)
+	t2.Update(20)
+	t2.Update(30)
+	pool1.Register("latency", customTimer{t1.Snapshot()})
+	pool2.Register("latency", customTimer{t2.Snapshot()})
+	tm, ok := NewAggregateRegistry(pool1, pool2).Get("latency").(Timer)
+	if !ok || tm.Count() != 3 {
+		t.Errorf("Get(latency): %v", tm)
+	}
+}
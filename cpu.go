@@ -17,62 +17,170 @@
 package metrics
 
 import (
-	"time"
+	"context"
+	"errors"
+	"runtime"
 	"sync"
+	"time"
 )
 
 var (
-	cpuStats CPUStats
-	cpuMetrics struct {
-		GlobalTime GaugeFloat64
-		GlobalWait GaugeFloat64
-		LocalTime GaugeFloat64
-	}
-	registerCPUMetricsOnce = sync.Once{}
+	cpuCollectors = map[Registry]*CPUCollector{}
+	cpuMutex      sync.Mutex
 )
 
 // CPUStats is the system and process CPU stats.
 // All values are in seconds.
 type CPUStats struct {
-	GlobalTime float64 // Time spent by the CPU working on all processes.
-	GlobalWait float64 // Time spent by waiting on disk for all processes.
-	LocalTime  float64 // Time spent by the CPU working on this process.
+	GlobalTime  float64 // Time spent by the CPU working on all processes.
+	GlobalWait  float64 // Time spent by waiting on disk for all processes.
+	GlobalTotal float64 // Time spent by the CPU in any state, including idle.
+	LocalTime   float64 // Time spent by the CPU working on this process.
+}
+
+// CPUCollector captures the Go process CPU usage statistics exported in
+// cpu.CPUStats into the metrics of a single registry.
+//
+// Besides the cumulative times, it exports the utilization between successive
+// captures as ratios between 0 and 1: cpu.GlobalUtilization and
+// cpu.GlobalWaitUtilization are the shares of the host's CPU time spent
+// working and waiting on disk, and cpu.LocalUtilization is the share of the
+// cores available to this process spent working on it. The available cores
+// are the cgroup CPU quota at DefaultCgroupRoot, if any, and otherwise
+// runtime.NumCPU. Ratios are zero until the second capture.
+type CPUCollector struct {
+	metrics struct {
+		GlobalTime            GaugeFloat64
+		GlobalWait            GaugeFloat64
+		LocalTime             GaugeFloat64
+		GlobalUtilization     GaugeFloat64
+		GlobalWaitUtilization GaugeFloat64
+		LocalUtilization      GaugeFloat64
+	}
+	mutex    sync.Mutex
+	last     *CPUStats
+	lastTime time.Time
+}
+
+// NewCPUCollector constructs a new CPUCollector and registers its metrics in r.
+// Metrics that already exist in r are reused.
+func NewCPUCollector(r Registry) *CPUCollector {
+	if r == nil {
+		r = DefaultRegistry
+	}
+	c := &CPUCollector{}
+	c.metrics.GlobalTime = GetOrRegisterGaugeFloat64("cpu.CPUStats.GlobalTime", r)
+	c.metrics.GlobalWait = GetOrRegisterGaugeFloat64("cpu.CPUStats.GlobalWait", r)
+	c.metrics.LocalTime = GetOrRegisterGaugeFloat64("cpu.CPUStats.LocalTime", r)
+	c.metrics.GlobalUtilization = GetOrRegisterGaugeFloat64("cpu.GlobalUtilization", r)
+	c.metrics.GlobalWaitUtilization = GetOrRegisterGaugeFloat64("cpu.GlobalWaitUtilization", r)
+	c.metrics.LocalUtilization = GetOrRegisterGaugeFloat64("cpu.LocalUtilization", r)
+	return c
+}
+
+// Capture captures new values for the Go process CPU usage statistics. A failed
+// read returns a *CollectorError.
+func (c *CPUCollector) Capture() error {
+	var stats CPUStats
+	if err := ReadCPUStats(&stats); err != nil {
+		return collected("cpu", err)
+	}
+	c.update(&stats, cpuCapacity(DefaultCgroupRoot), time.Now())
+	return collected("cpu", nil)
+}
+
+// Collect implements Collector.
+func (c *CPUCollector) Collect(ctx context.Context) error {
+	return c.Capture()
+}
+
+// Updates the metrics with stats read at now, when the process had the given
+// number of cores available.
+func (c *CPUCollector) update(stats *CPUStats, cores float64, now time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.metrics.GlobalTime.Update(stats.GlobalTime)
+	c.metrics.GlobalWait.Update(stats.GlobalWait)
+	c.metrics.LocalTime.Update(stats.LocalTime)
+	if c.last != nil {
+		if total := stats.GlobalTotal - c.last.GlobalTotal; total > 0 {
+			c.metrics.GlobalUtilization.Update((stats.GlobalTime - c.last.GlobalTime) / total)
+			c.metrics.GlobalWaitUtilization.Update((stats.GlobalWait - c.last.GlobalWait) / total)
+		}
+		if elapsed := now.Sub(c.lastTime).Seconds() * cores; elapsed > 0 {
+			c.metrics.LocalUtilization.Update((stats.LocalTime - c.last.LocalTime) / elapsed)
+		}
+	}
+	last := *stats
+	c.last, c.lastTime = &last, now
+}
+
+// Returns the number of cores available to the process: the CPU quota of the
+// cgroup mounted at root if it is lower than runtime.NumCPU.
+func cpuCapacity(root string) float64 {
+	cores := float64(runtime.NumCPU())
+	var stats CgroupStats
+	if err := cgroupReaders(root, &stats)[0](); err != nil {
+		return cores
+	}
+	if stats.CPULimit > 0 && stats.CPULimit < cores {
+		return stats.CPULimit
+	}
+	return cores
 }
 
-// CaptureCPUStats captures new values for the Go process CPU usage
-// statistics exported in cpu.CPUStats. This is designed to be called as a
-// goroutine.
+// CaptureCPUStats captures new values for the Go process CPU usage statistics
+// exported in cpu.CPUStats. This is designed to be called as a
+// goroutine. Errors are passed to the handler set by SetCollectorErrorHandler.
 func CaptureCPUStats(d time.Duration) {
 	for range time.Tick(d) {
-		CaptureCPUStatsOnce()
+		handleCollectorError(CaptureCPUStatsOnce())
 	}
 }
 
-// CaptureCPUStatsOnce captures new values for the Go process CPU usage
-// statistics exported in cpu.CPUStats. This is designed to be called in a
-// background goroutine.
-func CaptureCPUStatsOnce() {
-	err := ReadCPUStats(&cpuStats)
-	if err != nil {
-		panic(err)
+// CaptureCPUStatsOnce captures new values for the Go process CPU usage statistics
+// exported in cpu.CPUStats into every registry given to RegisterCPUStats. This
+// is designed to be called in a background goroutine. A failed read returns a
+// *CollectorError, which is counted by the metrics registered with
+// RegisterCollectorErrors.
+func CaptureCPUStatsOnce() error {
+	cpuMutex.Lock()
+	defer cpuMutex.Unlock()
+	if len(cpuCollectors) == 0 {
+		return collected("cpu", errors.New("stats not registered"))
 	}
-	cpuMetrics.GlobalTime.Update(cpuStats.GlobalTime)
-	cpuMetrics.GlobalWait.Update(cpuStats.GlobalWait)
-	cpuMetrics.LocalTime.Update(cpuStats.LocalTime)
+	var stats CPUStats
+	if err := ReadCPUStats(&stats); err != nil {
+		return collected("cpu", err)
+	}
+	cores, now := cpuCapacity(DefaultCgroupRoot), time.Now()
+	for _, c := range cpuCollectors {
+		c.update(&stats, cores, now)
+	}
+	return collected("cpu", nil)
 }
 
 // RegisterCPUStats registers metrics for the Go process CPU usage statistics
-// exported in cpu.CPUStats.
+// exported in cpu.CPUStats. Registering the same registry twice is a no-op.
+// The registry is held until it is given to UnregisterCPUStats.
 func RegisterCPUStats(r Registry) {
 	if r == nil {
 		r = DefaultRegistry
 	}
-	registerCPUMetricsOnce.Do(func() {
-		cpuMetrics.GlobalTime = NewGaugeFloat64()
-		cpuMetrics.GlobalWait = NewGaugeFloat64()
-		cpuMetrics.LocalTime = NewGaugeFloat64()
-		r.Register("cpu.CPUStats.GlobalTime", cpuMetrics.GlobalTime)
-		r.Register("cpu.CPUStats.GlobalWait", cpuMetrics.GlobalWait)
-		r.Register("cpu.CPUStats.LocalTime", cpuMetrics.LocalTime)
-	})
+	cpuMutex.Lock()
+	defer cpuMutex.Unlock()
+	if _, ok := cpuCollectors[r]; !ok {
+		cpuCollectors[r] = NewCPUCollector(r)
+	}
+}
+
+// UnregisterCPUStats stops CaptureCPUStatsOnce from updating the metrics of r
+// and releases r. Its metrics are left registered.
+func UnregisterCPUStats(r Registry) {
+	if r == nil {
+		r = DefaultRegistry
+	}
+	cpuMutex.Lock()
+	defer cpuMutex.Unlock()
+	delete(cpuCollectors, r)
 }
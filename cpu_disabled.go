@@ -19,6 +19,10 @@
 
 package metrics
 
+import "errors"
+
 // ReadCPUStats retrieves the current CPU stats. Internally this uses `gosigar`,
 // which is not supported on the platforms in this file.
-func ReadCPUStats(stats *CPUStats) {}
+func ReadCPUStats(stats *CPUStats) error {
+	return errors.New("not implemented")
+}
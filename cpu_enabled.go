@@ -43,6 +43,7 @@ func ReadCPUStats(stats *CPUStats) error {
 	}
 	stats.GlobalTime = timeStat.User + timeStat.Nice + timeStat.System
 	stats.GlobalWait = timeStat.Iowait
+	stats.GlobalTotal = timeStat.Total()
 	stats.LocalTime = localTime
 	return nil
 }
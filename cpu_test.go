@@ -0,0 +1,68 @@
+package metrics
+
+import (
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestCPUStatsPerRegistry(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skipf("skipping on %s", runtime.GOOS)
+	}
+	r1, r2 := NewRegistry(), NewRegistry()
+	RegisterCPUStats(r1)
+	RegisterCPUStats(r2)
+	RegisterCPUStats(r2)
+	defer UnregisterCPUStats(r1)
+	defer UnregisterCPUStats(r2)
+
+	for i := 0; i < 1e6; i++ {
+		_ = i * i
+	}
+	if err := CaptureCPUStatsOnce(); err != nil {
+		t.Fatalf("CaptureCPUStatsOnce(): %s", err)
+	}
+	for _, r := range []Registry{r1, r2} {
+		if v := r.Get("cpu.CPUStats.GlobalTime").(GaugeFloat64).Value(); v <= 0 {
+			t.Errorf("cpu.CPUStats.GlobalTime: %v <= 0", v)
+		}
+	}
+}
+
+func TestCPUUtilization(t *testing.T) {
+	r := NewRegistry()
+	c := NewCPUCollector(r)
+	now := time.Now()
+	c.update(&CPUStats{GlobalTime: 10, GlobalWait: 2, GlobalTotal: 40, LocalTime: 1}, 2, now)
+	if v := r.Get("cpu.LocalUtilization").(GaugeFloat64).Value(); v != 0 {
+		t.Errorf("cpu.LocalUtilization: %v != 0 after first capture", v)
+	}
+
+	// 10s of wall time on 2 cores is 20s of capacity.
+	c.update(&CPUStats{GlobalTime: 20, GlobalWait: 4, GlobalTotal: 80, LocalTime: 6}, 2, now.Add(10*time.Second))
+	for name, expect := range map[string]float64{
+		"cpu.GlobalUtilization":     0.25,
+		"cpu.GlobalWaitUtilization": 0.05,
+		"cpu.LocalUtilization":      0.25,
+	} {
+		if v := r.Get(name).(GaugeFloat64).Value(); v != expect {
+			t.Errorf("%s: %v != %v", name, v, expect)
+		}
+	}
+}
+
+func TestCPUCapacity(t *testing.T) {
+	cores := float64(runtime.NumCPU())
+	if v := cpuCapacity("testdata/missing"); v != cores {
+		t.Errorf("cpuCapacity(): %v != %v without cgroup", v, cores)
+	}
+	// The fixture limits the cgroup to 1.5 cores.
+	expect := 1.5
+	if cores < expect {
+		expect = cores
+	}
+	if v := cpuCapacity("testdata/cgroup/v2"); v != expect {
+		t.Errorf("cpuCapacity(): %v != %v", v, expect)
+	}
+}
@@ -0,0 +1,208 @@
+package datadog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// DefaultSeriesURI is the Datadog v2 series API endpoint for the US1 site.
+const DefaultSeriesURI = "https://api.datadoghq.com/api/v2/series"
+
+// Payload limits enforced by the series API.
+const (
+	MaxPayloadSize           = 5 << 20 // Maximum uncompressed payload size.
+	MaxCompressedPayloadSize = 500 << 10
+)
+
+// Metric types understood by the series API.
+const (
+	TypeUnspecified = 0
+	TypeCount       = 1
+	TypeRate        = 2
+	TypeGauge       = 3
+)
+
+// Point is a single timestamped value of a Series.
+type Point struct {
+	Timestamp int64   `json:"timestamp"`
+	Value     float64 `json:"value"`
+}
+
+// Resource associates a Series with a host or other resource.
+type Resource struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// Series is a named metric submitted to the series API.
+type Series struct {
+	Metric    string     `json:"metric"`
+	Type      int        `json:"type"`
+	Interval  int64      `json:"interval,omitempty"`
+	Points    []Point    `json:"points"`
+	Tags      []string   `json:"tags,omitempty"`
+	Resources []Resource `json:"resources,omitempty"`
+}
+
+// APIError is returned when the series API rejects a payload.
+type APIError struct {
+	StatusCode int
+	Body       string
+}
+
+func (err *APIError) Error() string {
+	return fmt.Sprintf("unable to post to Datadog: %d %s", err.StatusCode,
+		err.Body)
+}
+
+// Client submits series to the Datadog series API.
+type Client struct {
+	APIKey       string
+	SeriesURI    string
+	Compress     bool          // Gzip request bodies.
+	MaxRetries   int           // Retries for failed requests.
+	RetryBackoff time.Duration // Initial delay between retries, doubled each time.
+	MaxPayload   int           // Maximum uncompressed payload size.
+	HTTPClient   *http.Client
+}
+
+// NewClient creates a new client for interfacing with the series API.
+func NewClient(apiKey, seriesURI string) *Client {
+	if seriesURI == "" {
+		seriesURI = DefaultSeriesURI
+	}
+	return &Client{
+		APIKey:       apiKey,
+		SeriesURI:    seriesURI,
+		Compress:     true,
+		MaxRetries:   3,
+		RetryBackoff: time.Second,
+		MaxPayload:   MaxPayloadSize,
+		HTTPClient:   http.DefaultClient,
+	}
+}
+
+// PostSeries submits series to the series API, splitting them into as many
+// requests as needed to stay under the payload size limits. The callback sent
+// is invoked with each chunk of series once it has been accepted.
+func (c *Client) PostSeries(series []Series, sent func([]Series)) error {
+	for len(series) > 0 {
+		n, body, err := c.chunk(series)
+		if err != nil {
+			return err
+		}
+		if err := c.post(body); err != nil {
+			return err
+		}
+		if sent != nil {
+			sent(series[:n])
+		}
+		series = series[n:]
+	}
+	return nil
+}
+
+// Encodes the longest prefix of series that fits under the payload limits,
+// returning its length and the request body.
+func (c *Client) chunk(series []Series) (int, []byte, error) {
+	limit := c.MaxPayload
+	if limit <= 0 {
+		limit = MaxPayloadSize
+	}
+
+	// Size of the {"series":[]} envelope.
+	size := 13
+	n := 0
+	for ; n < len(series); n++ {
+		js, err := json.Marshal(series[n])
+		if err != nil {
+			return 0, nil, err
+		}
+		if n > 0 && size+len(js)+1 > limit {
+			break
+		}
+		size += len(js) + 1
+	}
+
+	for {
+		body, err := c.encode(series[:n])
+		if err != nil {
+			return 0, nil, err
+		}
+		if !c.Compress || len(body) <= MaxCompressedPayloadSize || n == 1 {
+			return n, body, nil
+		}
+		n /= 2
+	}
+}
+
+func (c *Client) encode(series []Series) ([]byte, error) {
+	js, err := json.Marshal(map[string][]Series{"series": series})
+	if err != nil || !c.Compress {
+		return js, err
+	}
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(js); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Posts a single payload, retrying on network errors, throttling and server
+// errors.
+func (c *Client) post(body []byte) (err error) {
+	backoff := c.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		var retry bool
+		if retry, err = c.try(body); err == nil || !retry ||
+			attempt >= c.MaxRetries {
+			return err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func (c *Client) try(body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, c.SeriesURI,
+		bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("DD-API-KEY", c.APIKey)
+	if c.Compress {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+
+	msg, err := io.ReadAll(resp.Body)
+	if err != nil {
+		msg = []byte(fmt.Sprintf("(could not fetch response body for error: %s)", err))
+	}
+	retry := resp.StatusCode == http.StatusRequestTimeout ||
+		resp.StatusCode == http.StatusTooManyRequests ||
+		resp.StatusCode >= 500
+	return retry, &APIError{StatusCode: resp.StatusCode, Body: string(msg)}
+}
@@ -0,0 +1,204 @@
+package datadog
+
+import (
+	"github.com/zeim839/go-metrics-plus"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Config provides a container with configuration parameters for
+// the Datadog exporter.
+type Config struct {
+	APIKey       string           // Datadog API key.
+	SeriesURI    string           // Series API endpoint, defaults to DefaultSeriesURI.
+	Host         string           // Host resource attached to every series.
+	Tags         []string         // Tags attached to every series, i.e "env:prod".
+	Registry     metrics.Registry // Registry to be exported.
+	DurationUnit time.Duration    // Time conversion unit for durations.
+	Prefix       string           // Prefix to be prepended to metric names.
+	Client       *Client          // Series API client, defaults to NewClient.
+}
+
+// Reporter converts registry metrics into Datadog series and submits them to
+// the series API when Once is called, i.e from a metrics.CollectorFunc run by
+// a metrics.Scheduler. Counters are reported as count series carrying the change
+// since the last successful submission, so a Reporter must be reused across
+// flushes. The first flush in which a counter appears only records its count
+// as a baseline, and the counts of metrics which are no longer in the
+// registry are forgotten. A count lower than the baseline means the counter
+// was reset, and is sent as is.
+type Reporter struct {
+	config Config
+	counts map[string]baseline
+	mutex  sync.Mutex
+}
+
+// The last count of a counter accepted by the series API, and when it was
+// taken.
+type baseline struct {
+	count int64
+	time  time.Time
+}
+
+// NewReporter creates a new reporter.
+func NewReporter(c Config) *Reporter {
+	if c.Registry == nil {
+		c.Registry = metrics.DefaultRegistry
+	}
+	if c.DurationUnit == 0 {
+		c.DurationUnit = time.Millisecond
+	}
+	if c.Client == nil {
+		c.Client = NewClient(c.APIKey, c.SeriesURI)
+	}
+	return &Reporter{config: c, counts: map[string]baseline{}}
+}
+
+// Once performs a single submission to the series API. Counter deltas are
+// only committed once the series that carry them have been accepted, so a
+// failed submission is folded into the next one.
+func (rep *Reporter) Once() error {
+	rep.mutex.Lock()
+	defer rep.mutex.Unlock()
+	now := time.Now()
+	series, counts := rep.BuildSeries(now)
+	for key := range rep.counts {
+		if _, ok := counts[key]; !ok {
+			delete(rep.counts, key)
+		}
+	}
+	for key, count := range counts {
+		if _, ok := rep.counts[key]; !ok {
+			rep.counts[key] = baseline{count, now}
+		}
+	}
+	return rep.config.Client.PostSeries(series, func(sent []Series) {
+		for _, s := range sent {
+			key := countKey(s.Metric, s.Tags)
+			if count, ok := counts[key]; ok {
+				rep.counts[key] = baseline{count, now}
+			}
+		}
+	})
+}
+
+// BuildSeries converts every metric in the registry into series timestamped
+// with now. It also returns the absolute counts backing each count series,
+// keyed by series name and tags. Counts without a previous count, which are
+// baselines, have no series. The interval of a count series is the time since
+// its baseline, in seconds. The labels of metrics, i.e those extracted by a
+// metrics.RewriteRegistry, are added to their tags.
+func (rep *Reporter) BuildSeries(now time.Time) ([]Series, map[string]int64) {
+	c := &rep.config
+	ts := now.Unix()
+	var resources []Resource
+	if c.Host != "" {
+		resources = []Resource{{Name: c.Host, Type: "host"}}
+	}
+	prefix := ""
+	if c.Prefix != "" {
+		prefix = c.Prefix + "."
+	}
+
+	var series []Series
+	var tags []string // Tags of the metric being exported.
+	counts := map[string]int64{}
+	gauge := func(name string, v float64) {
+		series = append(series, Series{
+			Metric:    name,
+			Type:      TypeGauge,
+			Points:    []Point{{ts, v}},
+			Tags:      tags,
+			Resources: resources,
+		})
+	}
+	count := func(name string, v int64) {
+		key := countKey(name, tags)
+		counts[key] = v
+		prev, ok := rep.counts[key]
+		if !ok {
+			return
+		}
+		delta := v - prev.count
+		if v < prev.count {
+			delta = v
+		}
+		interval := int64(now.Sub(prev.time).Round(time.Second) / time.Second)
+		if interval < 1 {
+			interval = 1
+		}
+		series = append(series, Series{
+			Metric:    name,
+			Type:      TypeCount,
+			Interval:  interval,
+			Points:    []Point{{ts, float64(delta)}},
+			Tags:      tags,
+			Resources: resources,
+		})
+	}
+	d := func(v float64) float64 { return v / float64(c.DurationUnit) }
+
+	c.Registry.Snapshot().Each(func(name string, i interface{}) {
+		name = prefix + name
+		tags = c.Tags
+		if labels := metrics.MetricLabels(i); len(labels) > 0 {
+			tags = append([]string{}, c.Tags...)
+			for k, v := range labels {
+				tags = append(tags, k+":"+v)
+			}
+			sort.Strings(tags)
+		}
+		switch metric := i.(type) {
+		case metrics.Counter:
+			count(name, metric.Count())
+		case metrics.Gauge:
+			gauge(name, float64(metric.Value()))
+		case metrics.GaugeFloat64:
+			gauge(name, metric.Value())
+		case metrics.Info:
+			gauge(name, float64(metric.Value()))
+		case metrics.Meter:
+			count(name+".count", metric.Count())
+			gauge(name+".rate.1min", metric.Rate1())
+			gauge(name+".rate.5min", metric.Rate5())
+			gauge(name+".rate.15min", metric.Rate15())
+			gauge(name+".rate.mean", metric.RateMean())
+		case metrics.Timer:
+			ps := metric.Percentiles([]float64{0.5, 0.75, 0.95, 0.99, 0.999})
+			count(name+".count", metric.Count())
+			gauge(name+".min", d(float64(metric.Min())))
+			gauge(name+".max", d(float64(metric.Max())))
+			gauge(name+".avg", d(metric.Mean()))
+			gauge(name+".stddev", d(metric.StdDev()))
+			gauge(name+".median", d(ps[0]))
+			gauge(name+".75percentile", d(ps[1]))
+			gauge(name+".95percentile", d(ps[2]))
+			gauge(name+".99percentile", d(ps[3]))
+			gauge(name+".999percentile", d(ps[4]))
+			gauge(name+".rate.1min", metric.Rate1())
+			gauge(name+".rate.5min", metric.Rate5())
+			gauge(name+".rate.15min", metric.Rate15())
+			gauge(name+".rate.mean", metric.RateMean())
+		case metrics.Histogram:
+			ps := metric.Percentiles([]float64{0.5, 0.75, 0.95, 0.99, 0.999})
+			count(name+".count", metric.Count())
+			gauge(name+".min", float64(metric.Min()))
+			gauge(name+".max", float64(metric.Max()))
+			gauge(name+".avg", metric.Mean())
+			gauge(name+".stddev", metric.StdDev())
+			gauge(name+".median", ps[0])
+			gauge(name+".75percentile", ps[1])
+			gauge(name+".95percentile", ps[2])
+			gauge(name+".99percentile", ps[3])
+			gauge(name+".999percentile", ps[4])
+		}
+	})
+	return series, counts
+}
+
+// Returns the key of the absolute count of a count series.
+func countKey(name string, tags []string) string {
+	return name + "|" + strings.Join(tags, ",")
+}
@@ -0,0 +1,281 @@
+package datadog
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/zeim839/go-metrics-plus"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func ExampleReporter() {
+	metrics.GetOrRegisterCounter("myCounter", nil)
+	metrics.GetOrRegisterTimer("myTimer", nil)
+
+	rep := NewReporter(Config{APIKey: "api-key", Host: "web01"})
+	s := metrics.NewScheduler()
+	s.Add("datadog", 10*time.Second, metrics.CollectorFunc(func(context.Context) error {
+		return rep.Once()
+	}))
+	s.Start(context.Background())
+}
+
+// A stand-in for the series API. Responds with the given status codes in
+// order, then with 202 Accepted.
+type seriesServer struct {
+	*httptest.Server
+	mutex    sync.Mutex
+	payloads [][]Series
+	statuses []int
+	requests int
+}
+
+func newSeriesServer(t *testing.T, statuses ...int) *seriesServer {
+	s := &seriesServer{statuses: statuses}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter,
+		r *http.Request) {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		s.requests++
+		if r.Header.Get("DD-API-KEY") != "key" {
+			t.Errorf("missing API key header")
+		}
+		if len(s.statuses) > 0 {
+			w.WriteHeader(s.statuses[0])
+			s.statuses = s.statuses[1:]
+			return
+		}
+		body := r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			gz, err := gzip.NewReader(r.Body)
+			if err != nil {
+				t.Errorf("bad gzip body: %s", err)
+				return
+			}
+			body = gz
+		}
+		var payload struct{ Series []Series }
+		if err := json.NewDecoder(body).Decode(&payload); err != nil {
+			t.Errorf("bad request body: %s", err)
+		}
+		s.payloads = append(s.payloads, payload.Series)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	return s
+}
+
+func newTestReporter(r metrics.Registry, uri string) *Reporter {
+	client := NewClient("key", uri)
+	client.RetryBackoff = time.Millisecond
+	return NewReporter(Config{
+		Host:     "web01",
+		Tags:     []string{"env:test"},
+		Registry: r,
+		Client:   client,
+	})
+}
+
+func TestCounterDeltas(t *testing.T) {
+	srv := newSeriesServer(t)
+	defer srv.Close()
+
+	r := metrics.NewRegistry()
+	c := metrics.GetOrRegisterCounter("foo", r)
+	metrics.GetOrRegisterGauge("bar", r).Update(3)
+	rep := newTestReporter(r, srv.URL)
+
+	c.Inc(1)
+	if err := rep.Once(); err != nil {
+		t.Fatalf("Once(): %s", err)
+	}
+	c.Inc(5)
+	if err := rep.Once(); err != nil {
+		t.Fatalf("Once(): %s", err)
+	}
+	c.Inc(2)
+	if err := rep.Once(); err != nil {
+		t.Fatalf("Once(): %s", err)
+	}
+
+	if len(srv.payloads) != 3 {
+		t.Fatalf("expected 3 payloads, got %d", len(srv.payloads))
+	}
+	for _, s := range srv.payloads[0] {
+		if s.Metric == "foo" {
+			t.Errorf("flush 0: foo sent before its baseline %+v", s)
+		}
+	}
+	for i, expect := range []float64{5, 2} {
+		found := false
+		for _, s := range srv.payloads[i+1] {
+			switch s.Metric {
+			case "foo":
+				found = true
+				if s.Type != TypeCount || s.Interval != 1 {
+					t.Errorf("foo: unexpected series %+v", s)
+				}
+				if v := s.Points[0].Value; v != expect {
+					t.Errorf("flush %d: foo %v != %v", i, v, expect)
+				}
+			case "bar":
+				if s.Type != TypeGauge || s.Points[0].Value != 3 {
+					t.Errorf("bar: unexpected series %+v", s)
+				}
+			}
+			if fmt.Sprint(s.Tags) != "[env:test]" ||
+				fmt.Sprint(s.Resources) != "[{web01 host}]" {
+				t.Errorf("%s: unexpected tags/resources %+v", s.Metric, s)
+			}
+		}
+		if !found {
+			t.Errorf("flush %d: missing foo", i)
+		}
+	}
+}
+
+func TestRetries(t *testing.T) {
+	srv := newSeriesServer(t, http.StatusInternalServerError,
+		http.StatusTooManyRequests)
+	defer srv.Close()
+
+	r := metrics.NewRegistry()
+	metrics.GetOrRegisterGauge("foo", r).Update(1)
+	if err := newTestReporter(r, srv.URL).Once(); err != nil {
+		t.Fatalf("Once(): %s", err)
+	}
+	if srv.requests != 3 || len(srv.payloads) != 1 {
+		t.Errorf("expected 3 requests and 1 payload, got %d and %d",
+			srv.requests, len(srv.payloads))
+	}
+}
+
+func TestFailedFlushIsCarriedOver(t *testing.T) {
+	srv := newSeriesServer(t, http.StatusBadRequest)
+	defer srv.Close()
+
+	r := metrics.NewRegistry()
+	c := metrics.GetOrRegisterCounter("foo", r)
+	rep := newTestReporter(r, srv.URL)
+	if err := rep.Once(); err != nil {
+		t.Fatalf("Once(): %s", err)
+	}
+
+	c.Inc(4)
+	if err := rep.Once(); err == nil {
+		t.Fatal("Once(): expected error on 400 response")
+	}
+	if srv.requests != 1 {
+		t.Errorf("Once(): retried a 400 response")
+	}
+	c.Inc(1)
+	if err := rep.Once(); err != nil {
+		t.Fatalf("Once(): %s", err)
+	}
+	if v := srv.payloads[0][0].Points[0].Value; v != 5 {
+		t.Errorf("foo: %v != 5", v)
+	}
+}
+
+func TestCounterPruning(t *testing.T) {
+	srv := newSeriesServer(t)
+	defer srv.Close()
+
+	r := metrics.NewRegistry()
+	metrics.GetOrRegisterCounter("foo", r).Inc(1)
+	rep := newTestReporter(r, srv.URL)
+	if err := rep.Once(); err != nil {
+		t.Fatalf("Once(): %s", err)
+	}
+	if len(rep.counts) != 1 {
+		t.Errorf("counts: %v", rep.counts)
+	}
+	r.Unregister("foo")
+	if err := rep.Once(); err != nil {
+		t.Fatalf("Once(): %s", err)
+	}
+	if len(rep.counts) != 0 {
+		t.Errorf("counts: %v != map[]", rep.counts)
+	}
+	metrics.GetOrRegisterCounter("foo", r).Inc(3)
+	if err := rep.Once(); err != nil {
+		t.Fatalf("Once(): %s", err)
+	}
+	if len(srv.payloads) != 0 {
+		t.Errorf("re-registered foo sent before its baseline: %v", srv.payloads)
+	}
+}
+
+func TestCounterResetAndInterval(t *testing.T) {
+	r := metrics.NewRegistry()
+	metrics.GetOrRegisterCounter("foo", r).Inc(2)
+	rep := newTestReporter(r, "")
+	rep.counts["foo|env:test"] = baseline{5, time.Unix(100, 0)}
+	series, _ := rep.BuildSeries(time.Unix(130, 0))
+	if len(series) != 1 {
+		t.Fatalf("BuildSeries(): expected 1 series, got %d", len(series))
+	}
+	if s := series[0]; s.Points[0].Value != 2 || s.Interval != 30 {
+		t.Errorf("BuildSeries(): unexpected series %+v", s)
+	}
+}
+
+func TestChunking(t *testing.T) {
+	srv := newSeriesServer(t)
+	defer srv.Close()
+
+	r := metrics.NewRegistry()
+	for i := 0; i < 20; i++ {
+		metrics.GetOrRegisterGauge(fmt.Sprintf("g%02d", i), r).Update(1)
+	}
+	rep := newTestReporter(r, srv.URL)
+	rep.config.Client.MaxPayload = 1024
+
+	if err := rep.Once(); err != nil {
+		t.Fatalf("Once(): %s", err)
+	}
+	total := 0
+	for _, p := range srv.payloads {
+		js, _ := json.Marshal(map[string][]Series{"series": p})
+		if len(js) > 1024 {
+			t.Errorf("payload of %d bytes exceeds limit", len(js))
+		}
+		total += len(p)
+	}
+	if len(srv.payloads) < 2 || total != 20 {
+		t.Errorf("expected 20 series in several payloads, got %d in %d",
+			total, len(srv.payloads))
+	}
+}
+
+func TestTimerUnits(t *testing.T) {
+	r := metrics.NewRegistry()
+	metrics.GetOrRegisterTimer("baz", r).Update(2 * time.Second)
+	series, _ := NewReporter(Config{Registry: r}).BuildSeries(time.Now())
+	for _, s := range series {
+		if s.Metric == "baz.max" && s.Points[0].Value != 2000 {
+			t.Errorf("baz.max: %v != 2000", s.Points[0].Value)
+		}
+	}
+}
+
+func TestInfoTags(t *testing.T) {
+	r := metrics.NewRegistry()
+	metrics.NewRegisteredInfo("build", r, map[string]string{"version": "v1"})
+	rep := newTestReporter(r, "")
+	series, _ := rep.BuildSeries(time.Unix(100, 0))
+	if len(series) != 1 {
+		t.Fatalf("BuildSeries(): expected 1 series, got %d", len(series))
+	}
+	s := series[0]
+	if s.Metric != "build" || s.Points[0].Value != 1 || s.Type != TypeGauge {
+		t.Errorf("BuildSeries(): unexpected series %+v", s)
+	}
+	if fmt.Sprint(s.Tags) != "[env:test version:v1]" {
+		t.Errorf("BuildSeries(): tags: %v", s.Tags)
+	}
+}
@@ -1,13 +1,24 @@
 package metrics
 
 import (
+	"context"
+	"errors"
 	"runtime/debug"
 	"sync"
 	"time"
 )
 
 var (
-	debugMetrics struct {
+	debugCollectors = map[Registry]*DebugGCCollector{}
+	debugMutex      sync.Mutex
+)
+
+// DebugGCCollector captures the Go garbage collector statistics exported in
+// debug.GCStats into the metrics of a single registry.
+type DebugGCCollector struct {
+	mutex   sync.Mutex
+	gcStats debug.GCStats
+	metrics struct {
 		GCStats struct {
 			LastGC Gauge
 			NumGC  Gauge
@@ -17,66 +28,109 @@ var (
 		}
 		ReadGCStats Timer
 	}
-	gcStats                  debug.GCStats
-	registerDebugMetricsOnce = sync.Once{}
-)
+}
+
+// NewDebugGCCollector constructs a new DebugGCCollector and registers its
+// metrics in r. The metrics are named by their fully-qualified Go symbols,
+// i.e. debug.GCStats.PauseTotal. Metrics that already exist in r are reused.
+func NewDebugGCCollector(r Registry) *DebugGCCollector {
+	if r == nil {
+		r = DefaultRegistry
+	}
+	c := &DebugGCCollector{}
+	// Allocate an initial slice for gcStats.Pause to avoid allocations during
+	// normal operation.
+	c.gcStats.Pause = make([]time.Duration, 11)
+	m := &c.metrics
+	m.GCStats.LastGC = GetOrRegisterGauge("debug.GCStats.LastGC", r)
+	m.GCStats.NumGC = GetOrRegisterGauge("debug.GCStats.NumGC", r)
+	m.GCStats.Pause = GetOrRegisterHistogram("debug.GCStats.Pause", r,
+		NewExpDecaySample(1028, 0.015))
+	m.GCStats.PauseTotal = GetOrRegisterGauge("debug.GCStats.PauseTotal", r)
+	m.ReadGCStats = GetOrRegisterTimer("debug.ReadGCStats", r)
+	return c
+}
 
 // CaptureDebugGCStats captures new values for the Go garbage collector
 // statistics exported in debug.GCStats. This is designed to be called as a
 // goroutine.
 func CaptureDebugGCStats(r Registry, d time.Duration) {
 	for range time.Tick(d) {
-		CaptureDebugGCStatsOnce(r)
+		handleCollectorError(CaptureDebugGCStatsOnce(r))
 	}
 }
 
 // CaptureDebugGCStatsOnce capture new values for the Go garbage collector
-// statistics exported in debug.GCStats. This is designed to be called in a
-// background goroutine. Giving a registry which has not been given to
-// RegisterDebugGCStats will panic.
-//
-// Be careful (but much less so) with this because debug.ReadGCStats calls
-// the C function runtime·lock(runtime·mheap) which, while not a stop-the-world
-// operation, isn't something you want to be doing all the time.
-func CaptureDebugGCStatsOnce(r Registry) {
-	lastGC := gcStats.LastGC
-	t := time.Now()
-	debug.ReadGCStats(&gcStats)
-	debugMetrics.ReadGCStats.UpdateSince(t)
-
-	debugMetrics.GCStats.LastGC.Update(int64(gcStats.LastGC.UnixNano()))
-	debugMetrics.GCStats.NumGC.Update(int64(gcStats.NumGC))
-	if lastGC != gcStats.LastGC && 0 < len(gcStats.Pause) {
-		debugMetrics.GCStats.Pause.Update(int64(gcStats.Pause[0]))
+// statistics exported in debug.GCStats into the metrics of r. This is designed
+// to be called in a background goroutine. Giving a registry which has not been
+// given to RegisterDebugGCStats returns a *CollectorError, which is counted by
+// the metrics registered with RegisterCollectorErrors.
+func CaptureDebugGCStatsOnce(r Registry) error {
+	if r == nil {
+		r = DefaultRegistry
+	}
+	debugMutex.Lock()
+	c, ok := debugCollectors[r]
+	debugMutex.Unlock()
+	if !ok {
+		return collected("debug", errors.New("stats not registered"))
 	}
-	//debugMetrics.GCStats.PauseQuantiles.Update(gcStats.PauseQuantiles)
-	debugMetrics.GCStats.PauseTotal.Update(int64(gcStats.PauseTotal))
+	c.Capture()
+	return collected("debug", nil)
 }
 
 // RegisterDebugGCStats registers metrics for the Go garbage collector statistics
 // exported in debug.GCStats.  The metrics are named by their fully-qualified Go
-// symbols, i.e. debug.GCStats.PauseTotal.
+// symbols, i.e. debug.GCStats.PauseTotal. Registering the same registry twice
+// is a no-op. The registry is held until it is given to
+// UnregisterDebugGCStats.
 func RegisterDebugGCStats(r Registry) {
 	if r == nil {
 		r = DefaultRegistry
 	}
-	registerDebugMetricsOnce.Do(func() {
-		debugMetrics.GCStats.LastGC = NewGauge()
-		debugMetrics.GCStats.NumGC = NewGauge()
-		debugMetrics.GCStats.Pause = NewHistogram(NewExpDecaySample(1028, 0.015))
-		debugMetrics.GCStats.PauseTotal = NewGauge()
-		debugMetrics.ReadGCStats = NewTimer()
+	debugMutex.Lock()
+	defer debugMutex.Unlock()
+	if _, ok := debugCollectors[r]; !ok {
+		debugCollectors[r] = NewDebugGCCollector(r)
+	}
+}
+
+// UnregisterDebugGCStats releases a registry given to RegisterDebugGCStats,
+// after which it may no longer be given to CaptureDebugGCStatsOnce. Its
+// metrics are left registered.
+func UnregisterDebugGCStats(r Registry) {
+	if r == nil {
+		r = DefaultRegistry
+	}
+	debugMutex.Lock()
+	defer debugMutex.Unlock()
+	delete(debugCollectors, r)
+}
+
+// Capture captures new values for the Go garbage collector statistics.
+//
+// Be careful (but much less so) with this because debug.ReadGCStats calls
+// the C function runtime·lock(runtime·mheap) which, while not a stop-the-world
+// operation, isn't something you want to be doing all the time.
+func (c *DebugGCCollector) Capture() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	lastGC := c.gcStats.LastGC
+	t := time.Now()
+	debug.ReadGCStats(&c.gcStats)
+	c.metrics.ReadGCStats.UpdateSince(t)
 
-		r.Register("debug.GCStats.LastGC", debugMetrics.GCStats.LastGC)
-		r.Register("debug.GCStats.NumGC", debugMetrics.GCStats.NumGC)
-		r.Register("debug.GCStats.Pause", debugMetrics.GCStats.Pause)
-		r.Register("debug.GCStats.PauseTotal", debugMetrics.GCStats.PauseTotal)
-		r.Register("debug.ReadGCStats", debugMetrics.ReadGCStats)
-	})
+	c.metrics.GCStats.LastGC.Update(int64(c.gcStats.LastGC.UnixNano()))
+	c.metrics.GCStats.NumGC.Update(int64(c.gcStats.NumGC))
+	if lastGC != c.gcStats.LastGC && 0 < len(c.gcStats.Pause) {
+		c.metrics.GCStats.Pause.Update(int64(c.gcStats.Pause[0]))
+	}
+	//c.metrics.GCStats.PauseQuantiles.Update(c.gcStats.PauseQuantiles)
+	c.metrics.GCStats.PauseTotal.Update(int64(c.gcStats.PauseTotal))
 }
 
-// Allocate an initial slice for gcStats.Pause to avoid allocations during
-// normal operation.
-func init() {
-	gcStats.Pause = make([]time.Duration, 11)
+// Collect implements Collector.
+func (c *DebugGCCollector) Collect(ctx context.Context) error {
+	c.Capture()
+	return nil
 }
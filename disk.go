@@ -17,19 +17,15 @@
 package metrics
 
 import (
-	"time"
+	"context"
+	"errors"
 	"sync"
+	"time"
 )
 
 var (
-	diskStats  DiskStats
-	diskMetrics struct {
-		ReadCount  Gauge
-		ReadBytes  Gauge
-		WriteCount Gauge
-		WriteBytes Gauge
-	}
-	registerDiskMetricsOnce = sync.Once{}
+	diskCollectors = map[Registry]*DiskCollector{}
+	diskMutex      sync.Mutex
 )
 
 // DiskStats is the per process disk io stats.
@@ -40,43 +36,105 @@ type DiskStats struct {
 	WriteBytes int64 // Total number of byte written
 }
 
-// CaptureDiskStats captures new values for the Go process disk usage
-// statistics exported in disk.DiskStats. This is designed to be called as a
-// goroutine.
+// DiskCollector captures the Go process disk usage statistics exported in
+// disk.DiskStats into the metrics of a single registry.
+type DiskCollector struct {
+	metrics struct {
+		ReadCount  Gauge
+		ReadBytes  Gauge
+		WriteCount Gauge
+		WriteBytes Gauge
+	}
+}
+
+// NewDiskCollector constructs a new DiskCollector and registers its metrics in r.
+// Metrics that already exist in r are reused.
+func NewDiskCollector(r Registry) *DiskCollector {
+	if r == nil {
+		r = DefaultRegistry
+	}
+	c := &DiskCollector{}
+	c.metrics.ReadCount = GetOrRegisterGauge("disk.DiskStats.ReadCount", r)
+	c.metrics.ReadBytes = GetOrRegisterGauge("disk.DiskStats.ReadBytes", r)
+	c.metrics.WriteCount = GetOrRegisterGauge("disk.DiskStats.WriteCount", r)
+	c.metrics.WriteBytes = GetOrRegisterGauge("disk.DiskStats.WriteBytes", r)
+	return c
+}
+
+// Capture captures new values for the Go process disk usage statistics. A failed
+// read returns a *CollectorError.
+func (c *DiskCollector) Capture() error {
+	var stats DiskStats
+	if err := ReadDiskStats(&stats); err != nil {
+		return collected("disk", err)
+	}
+	c.update(&stats)
+	return collected("disk", nil)
+}
+
+// Collect implements Collector.
+func (c *DiskCollector) Collect(ctx context.Context) error {
+	return c.Capture()
+}
+
+func (c *DiskCollector) update(stats *DiskStats) {
+	c.metrics.ReadCount.Update(stats.ReadCount)
+	c.metrics.ReadBytes.Update(stats.ReadBytes)
+	c.metrics.WriteCount.Update(stats.WriteCount)
+	c.metrics.WriteBytes.Update(stats.WriteBytes)
+}
+
+// CaptureDiskStats captures new values for the Go process disk usage statistics
+// exported in disk.DiskStats. This is designed to be called as a
+// goroutine. Errors are passed to the handler set by SetCollectorErrorHandler.
 func CaptureDiskStats(d time.Duration) {
 	for range time.Tick(d) {
-		CaptureDiskStatsOnce()
+		handleCollectorError(CaptureDiskStatsOnce())
 	}
 }
 
-// CaptureDiskStatsOnce captures new values for the Go process disk usage
-// statistics exported in disk.DiskStats. This is designed to be called in a
-// background goroutine.
-func CaptureDiskStatsOnce() {
-	err := ReadDiskStats(&diskStats)
-	if err != nil {
-		panic(err)
+// CaptureDiskStatsOnce captures new values for the Go process disk usage statistics
+// exported in disk.DiskStats into every registry given to RegisterDiskStats. This
+// is designed to be called in a background goroutine. A failed read returns a
+// *CollectorError, which is counted by the metrics registered with
+// RegisterCollectorErrors.
+func CaptureDiskStatsOnce() error {
+	diskMutex.Lock()
+	defer diskMutex.Unlock()
+	if len(diskCollectors) == 0 {
+		return collected("disk", errors.New("stats not registered"))
 	}
-	diskMetrics.ReadCount.Update(diskStats.ReadCount)
-	diskMetrics.ReadBytes.Update(diskStats.ReadBytes)
-	diskMetrics.WriteCount.Update(diskStats.WriteCount)
-	diskMetrics.WriteBytes.Update(diskStats.WriteBytes)
+	var stats DiskStats
+	if err := ReadDiskStats(&stats); err != nil {
+		return collected("disk", err)
+	}
+	for _, c := range diskCollectors {
+		c.update(&stats)
+	}
+	return collected("disk", nil)
 }
 
 // RegisterDiskStats registers metrics for the Go process disk usage statistics
-// exported in disk.DiskStats.
+// exported in disk.DiskStats. Registering the same registry twice is a no-op.
+// The registry is held until it is given to UnregisterDiskStats.
 func RegisterDiskStats(r Registry) {
 	if r == nil {
 		r = DefaultRegistry
 	}
-	registerDiskMetricsOnce.Do(func() {
-		diskMetrics.ReadCount = NewGauge()
-		diskMetrics.ReadBytes = NewGauge()
-		diskMetrics.WriteCount = NewGauge()
-		diskMetrics.WriteBytes = NewGauge()
-		r.Register("disk.DiskStats.ReadCount", diskMetrics.ReadCount)
-		r.Register("disk.DiskStats.ReadBytes", diskMetrics.ReadBytes)
-		r.Register("disk.DiskStats.WriteCount", diskMetrics.WriteCount)
-		r.Register("disk.DiskStats.WriteBytes", diskMetrics.WriteBytes)
-	})
+	diskMutex.Lock()
+	defer diskMutex.Unlock()
+	if _, ok := diskCollectors[r]; !ok {
+		diskCollectors[r] = NewDiskCollector(r)
+	}
+}
+
+// UnregisterDiskStats stops CaptureDiskStatsOnce from updating the metrics of
+// r and releases r. Its metrics are left registered.
+func UnregisterDiskStats(r Registry) {
+	if r == nil {
+		r = DefaultRegistry
+	}
+	diskMutex.Lock()
+	defer diskMutex.Unlock()
+	delete(diskCollectors, r)
 }
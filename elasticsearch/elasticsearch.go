@@ -0,0 +1,310 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/zeim839/go-metrics-plus"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultIndex is the index name prefix used when none is configured.
+const DefaultIndex = "metrics"
+
+// DefaultBatchSize is the number of documents sent per _bulk request when
+// Config.BatchSize is not set.
+const DefaultBatchSize = 500
+
+// Number of bytes of a failed response's body included in the error.
+const maxErrorBody = 512
+
+// Config provides a container with configuration parameters for the
+// Elasticsearch/OpenSearch exporter.
+type Config struct {
+	URL          string           // Cluster address, i.e http://localhost:9200.
+	Index        string           // Index name prefix, suffixed with the date.
+	Username     string           // Basic auth username (optional).
+	Password     string           // Basic auth password (optional).
+	Registry     metrics.Registry // Registry to be exported.
+	DurationUnit time.Duration    // Time conversion unit for durations.
+	Prefix       string           // Prefix to be prepended to metric names.
+	BatchSize    int              // Documents per _bulk request.
+	MaxRetries   int              // Retries for throttled or failed items.
+	RetryBackoff time.Duration    // Initial delay between retries, doubled each time.
+	Client       *http.Client     // HTTP client, defaults to http.DefaultClient.
+}
+
+// Document is the representation of a single metric in the index. Fields
+// holds the values reported by Registry.GetAll, with dots in field names
+// replaced by underscores so they are not mapped as nested objects. Documents
+// are indexed under an ID made of their name, labels and timestamp, so that
+// retried requests overwrite the documents they already indexed.
+type Document struct {
+	Timestamp time.Time              `json:"@timestamp"`
+	Name      string                 `json:"name"`
+	Type      string                 `json:"type"`
+	Fields    map[string]interface{} `json:"fields"`
+}
+
+// ItemError describes a document that was rejected by the _bulk API.
+type ItemError struct {
+	Name   string // Name of the rejected metric.
+	Status int    // HTTP status of the item.
+	Type   string // Error type, i.e mapper_parsing_exception.
+	Reason string // Human readable reason.
+}
+
+// BulkError is returned when some documents could not be indexed.
+type BulkError struct {
+	Items []ItemError
+}
+
+func (err *BulkError) Error() string {
+	if len(err.Items) == 0 {
+		return "unable to post to Elasticsearch"
+	}
+	item := err.Items[0]
+	return fmt.Sprintf("unable to index %d documents in Elasticsearch, first (%s): %d %s: %s",
+		len(err.Items), item.Name, item.Status, item.Type, item.Reason)
+}
+
+// Once performs a single submission to the _bulk API, returning a non-nil
+// error on failed requests. Documents rejected by the cluster are reported
+// in a *BulkError. It can be run periodically from a metrics.CollectorFunc
+// added to a metrics.Scheduler.
+func Once(c Config) error {
+	if c.Registry == nil {
+		c.Registry = metrics.DefaultRegistry
+	}
+	if c.Index == "" {
+		c.Index = DefaultIndex
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = DefaultBatchSize
+	}
+	if c.Client == nil {
+		c.Client = http.DefaultClient
+	}
+
+	now := time.Now().UTC()
+	docs := Documents(c.Registry, c.Prefix, c.DurationUnit, now)
+	index := IndexName(c.Index, now)
+	bulkErr := &BulkError{}
+	for len(docs) > 0 {
+		n := c.BatchSize
+		if n > len(docs) {
+			n = len(docs)
+		}
+		if err := bulk(&c, index, docs[:n], bulkErr); err != nil {
+			return err
+		}
+		docs = docs[n:]
+	}
+	if len(bulkErr.Items) > 0 {
+		return bulkErr
+	}
+	return nil
+}
+
+// IndexName returns the daily index for the given time, i.e
+// metrics-2006.01.02.
+func IndexName(prefix string, t time.Time) string {
+	return prefix + "-" + t.UTC().Format("2006.01.02")
+}
+
+// Documents converts every metric in r into a Document timestamped with now.
+// Timer durations are converted to du. Documents are sorted by name.
+func Documents(r metrics.Registry, prefix string, du time.Duration,
+	now time.Time) []Document {
+	if prefix != "" {
+		prefix = prefix + "."
+	}
+	if du <= 0 {
+		du = time.Nanosecond
+	}
+	snapshot := r.Snapshot()
+	docs := make([]Document, 0, len(snapshot))
+	for _, m := range snapshot {
+		typ := metricType(m.Metric)
+		values := m.Values()
+		fields := make(map[string]interface{}, len(values))
+		for k, v := range values {
+			if typ == "timer" && timerDurations[k] {
+				v = toFloat(v) / float64(du)
+			}
+			fields[strings.ReplaceAll(k, ".", "_")] = v
+		}
+		docs = append(docs, Document{
+			Timestamp: now,
+			Name:      prefix + m.Name,
+			Type:      typ,
+			Fields:    fields,
+		})
+	}
+	return docs
+}
+
+// Timer fields reported by Registry.GetAll that hold durations.
+var timerDurations = map[string]bool{
+	"min": true, "max": true, "mean": true, "stddev": true, "median": true,
+	"75%": true, "95%": true, "99%": true, "99.9%": true,
+}
+
+func toFloat(v interface{}) float64 {
+	switch v := v.(type) {
+	case int64:
+		return float64(v)
+	case float64:
+		return v
+	}
+	return 0
+}
+
+func metricType(i interface{}) string {
+	switch i.(type) {
+	case metrics.Counter:
+		return "counter"
+	case metrics.Gauge:
+		return "gauge"
+	case metrics.GaugeFloat64:
+		return "gauge_float64"
+	case metrics.Healthcheck:
+		return "healthcheck"
+	case metrics.Info:
+		return "info"
+	case metrics.Histogram:
+		return "histogram"
+	case metrics.Meter:
+		return "meter"
+	case metrics.Timer:
+		return "timer"
+	}
+	return "unknown"
+}
+
+type bulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Status int `json:"status"`
+		Error  struct {
+			Type   string `json:"type"`
+			Reason string `json:"reason"`
+		} `json:"error"`
+	} `json:"items"`
+}
+
+// Indexes docs, retrying whole requests and individual items that failed
+// with throttling or server errors. Permanently rejected items are appended
+// to bulkErr.
+func bulk(c *Config, index string, docs []Document, bulkErr *BulkError) error {
+	backoff := c.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		final := attempt >= c.MaxRetries
+		body, status, err := post(c, index, docs)
+		if err != nil || status == http.StatusTooManyRequests || status >= 500 {
+			if final {
+				if err == nil {
+					err = fmt.Errorf("unable to post to Elasticsearch: %d %s", status, body)
+				}
+				return err
+			}
+		} else if status >= 300 {
+			return fmt.Errorf("unable to post to Elasticsearch: %d %s", status, body)
+		} else {
+			res := &bulkResponse{}
+			if err := json.Unmarshal(body, res); err != nil {
+				// The documents may have been indexed, so they are not
+				// posted again.
+				return fmt.Errorf("invalid Elasticsearch response: %w", err)
+			}
+			var retry []Document
+			for i, item := range res.Items {
+				if i >= len(docs) {
+					break
+				}
+				for _, result := range item {
+					if result.Status < 300 {
+						continue
+					}
+					if !final && (result.Status == http.StatusTooManyRequests ||
+						result.Status >= 500) {
+						retry = append(retry, docs[i])
+						continue
+					}
+					bulkErr.Items = append(bulkErr.Items, ItemError{
+						Name:   docs[i].Name,
+						Status: result.Status,
+						Type:   result.Error.Type,
+						Reason: result.Error.Reason,
+					})
+				}
+			}
+			if len(retry) == 0 {
+				return nil
+			}
+			docs = retry
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// Posts docs as a single NDJSON _bulk request, returning the response body,
+// or its beginning if the request failed.
+func post(c *Config, index string, docs []Document) ([]byte, int, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, doc := range docs {
+		action := map[string]map[string]string{
+			"index": {"_index": index, "_id": documentID(doc)},
+		}
+		if err := enc.Encode(action); err != nil {
+			return nil, 0, err
+		}
+		if err := enc.Encode(doc); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	url := strings.TrimSuffix(c.URL, "/") + "/_bulk"
+	req, err := http.NewRequest(http.MethodPost, url, &buf)
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if c.Username != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		return body, resp.StatusCode, nil
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, resp.StatusCode, err
+	}
+	return body, resp.StatusCode, nil
+}
+
+// Returns the ID of doc, i.e app.http{method=GET}@2006-01-02T15:04:05Z.
+func documentID(doc Document) string {
+	id := doc.Name
+	if labels, ok := doc.Fields["labels"].(map[string]string); ok {
+		pairs := make([]string, 0, len(labels))
+		for k, v := range labels {
+			pairs = append(pairs, k+"="+v)
+		}
+		sort.Strings(pairs)
+		id += "{" + strings.Join(pairs, ",") + "}"
+	}
+	return id + "@" + doc.Timestamp.Format(time.RFC3339Nano)
+}
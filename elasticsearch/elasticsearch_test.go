@@ -0,0 +1,275 @@
+package elasticsearch
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/zeim839/go-metrics-plus"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func ExampleOnce() {
+	metrics.GetOrRegisterCounter("myCounter", nil)
+	metrics.GetOrRegisterTimer("myTimer", nil)
+
+	c := Config{URL: "http://localhost:9200", Index: "metrics"}
+	s := metrics.NewScheduler()
+	s.Add("elasticsearch", 10*time.Second, metrics.CollectorFunc(func(context.Context) error {
+		return Once(c)
+	}))
+	s.Start(context.Background())
+}
+
+// A stand-in for the _bulk API. The reply callback chooses the status of
+// each item in a request; a nil callback accepts every document.
+type bulkServer struct {
+	*httptest.Server
+	mutex    sync.Mutex
+	indices  []string
+	ids      []string
+	docs     [][]Document
+	requests int
+}
+
+func newBulkServer(t *testing.T, reply func(req int, doc Document) int) *bulkServer {
+	s := &bulkServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter,
+		r *http.Request) {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		s.requests++
+		if r.URL.Path != "/_bulk" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if ct := r.Header.Get("Content-Type"); ct != "application/x-ndjson" {
+			t.Errorf("unexpected content type %s", ct)
+		}
+
+		var docs []Document
+		var items []map[string]interface{}
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			var action map[string]map[string]string
+			if err := json.Unmarshal(scanner.Bytes(), &action); err != nil {
+				t.Errorf("bad action line: %s", err)
+				return
+			}
+			s.indices = append(s.indices, action["index"]["_index"])
+			s.ids = append(s.ids, action["index"]["_id"])
+			if !scanner.Scan() {
+				t.Errorf("missing document line")
+				return
+			}
+			var doc Document
+			if err := json.Unmarshal(scanner.Bytes(), &doc); err != nil {
+				t.Errorf("bad document line: %s", err)
+				return
+			}
+			status := http.StatusCreated
+			if reply != nil {
+				status = reply(s.requests, doc)
+			}
+			item := map[string]interface{}{"status": status}
+			if status >= 300 {
+				item["error"] = map[string]string{
+					"type":   "mapper_parsing_exception",
+					"reason": "failed to parse",
+				}
+			} else {
+				docs = append(docs, doc)
+			}
+			items = append(items, map[string]interface{}{"index": item})
+		}
+		s.docs = append(s.docs, docs)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"errors": len(docs) != len(items),
+			"items":  items,
+		})
+	}))
+	return s
+}
+
+func newTestConfig(r metrics.Registry, url string) Config {
+	return Config{
+		URL:          url,
+		Registry:     r,
+		MaxRetries:   3,
+		RetryBackoff: time.Millisecond,
+	}
+}
+
+func TestOnce(t *testing.T) {
+	srv := newBulkServer(t, nil)
+	defer srv.Close()
+
+	r := metrics.NewRegistry()
+	metrics.GetOrRegisterCounter("foo", r).Inc(3)
+	metrics.GetOrRegisterMeter("bar", r).Mark(1)
+	c := newTestConfig(r, srv.URL)
+	c.Prefix = "app"
+	if err := Once(c); err != nil {
+		t.Fatalf("Once(): %s", err)
+	}
+
+	index := IndexName(DefaultIndex, time.Now())
+	for _, i := range srv.indices {
+		if i != index {
+			t.Errorf("index %s != %s", i, index)
+		}
+	}
+	if len(srv.docs) != 1 || len(srv.docs[0]) != 2 {
+		t.Fatalf("expected 1 request with 2 documents, got %v", srv.docs)
+	}
+	bar, foo := srv.docs[0][0], srv.docs[0][1]
+	if foo.Name != "app.foo" || foo.Type != "counter" || foo.Fields["count"] != 3.0 {
+		t.Errorf("unexpected document %+v", foo)
+	}
+	if bar.Name != "app.bar" || bar.Type != "meter" {
+		t.Errorf("unexpected document %+v", bar)
+	}
+	if _, ok := bar.Fields["1m_rate"]; !ok {
+		t.Errorf("bar: missing field 1m_rate in %v", bar.Fields)
+	}
+	if len(srv.ids) != 2 || srv.ids[1] != documentID(foo) ||
+		!strings.HasPrefix(srv.ids[1], "app.foo@") {
+		t.Errorf("unexpected document IDs %v", srv.ids)
+	}
+}
+
+func TestBatches(t *testing.T) {
+	srv := newBulkServer(t, nil)
+	defer srv.Close()
+
+	r := metrics.NewRegistry()
+	for i := 0; i < 5; i++ {
+		metrics.GetOrRegisterGauge(fmt.Sprintf("g%d", i), r).Update(1)
+	}
+	c := newTestConfig(r, srv.URL)
+	c.BatchSize = 2
+	if err := Once(c); err != nil {
+		t.Fatalf("Once(): %s", err)
+	}
+	if srv.requests != 3 {
+		t.Errorf("expected 3 requests, got %d", srv.requests)
+	}
+}
+
+func TestItemRetries(t *testing.T) {
+	srv := newBulkServer(t, func(req int, doc Document) int {
+		if req == 1 && doc.Name == "foo" {
+			return http.StatusTooManyRequests
+		}
+		return http.StatusCreated
+	})
+	defer srv.Close()
+
+	r := metrics.NewRegistry()
+	metrics.GetOrRegisterCounter("foo", r)
+	metrics.GetOrRegisterCounter("bar", r)
+	if err := Once(newTestConfig(r, srv.URL)); err != nil {
+		t.Fatalf("Once(): %s", err)
+	}
+	if srv.requests != 2 || len(srv.docs[1]) != 1 || srv.docs[1][0].Name != "foo" {
+		t.Errorf("expected foo to be retried alone, got %v", srv.docs)
+	}
+}
+
+func TestItemErrors(t *testing.T) {
+	srv := newBulkServer(t, func(req int, doc Document) int {
+		if doc.Name == "foo" {
+			return http.StatusBadRequest
+		}
+		return http.StatusCreated
+	})
+	defer srv.Close()
+
+	r := metrics.NewRegistry()
+	metrics.GetOrRegisterCounter("foo", r)
+	metrics.GetOrRegisterCounter("bar", r)
+	err := Once(newTestConfig(r, srv.URL))
+	var bulkErr *BulkError
+	if !errors.As(err, &bulkErr) {
+		t.Fatalf("Once(): expected *BulkError, got %v", err)
+	}
+	if len(bulkErr.Items) != 1 || bulkErr.Items[0].Name != "foo" ||
+		bulkErr.Items[0].Status != http.StatusBadRequest ||
+		bulkErr.Items[0].Type != "mapper_parsing_exception" {
+		t.Errorf("unexpected item errors %+v", bulkErr.Items)
+	}
+	if srv.requests != 1 {
+		t.Errorf("Once(): retried a rejected document")
+	}
+}
+
+func TestRequestRetries(t *testing.T) {
+	var mutex sync.Mutex
+	attempts := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter,
+		r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		attempts++
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("overloaded" + strings.Repeat(".", 1000)))
+	}))
+	defer srv.Close()
+
+	r := metrics.NewRegistry()
+	metrics.GetOrRegisterCounter("foo", r)
+	err := Once(newTestConfig(r, srv.URL))
+	if err == nil || !strings.Contains(err.Error(), "503 overloaded") ||
+		len(err.Error()) > 600 {
+		t.Errorf("Once(): expected 503 error, got %v", err)
+	}
+	if attempts != 4 {
+		t.Errorf("expected 4 attempts, got %d", attempts)
+	}
+}
+
+func TestInvalidResponse(t *testing.T) {
+	var mutex sync.Mutex
+	attempts := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter,
+		r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		attempts++
+		w.Write([]byte("<html>"))
+	}))
+	defer srv.Close()
+
+	r := metrics.NewRegistry()
+	metrics.GetOrRegisterCounter("foo", r)
+	if err := Once(newTestConfig(r, srv.URL)); err == nil {
+		t.Error("Once(): expected error on invalid response")
+	}
+	if attempts != 1 {
+		t.Errorf("Once(): reposted documents after an invalid response, %d attempts", attempts)
+	}
+}
+
+func TestIndexName(t *testing.T) {
+	ts := time.Date(2023, 7, 4, 23, 0, 0, 0, time.FixedZone("", -3600))
+	if name := IndexName("metrics", ts); name != "metrics-2023.07.05" {
+		t.Errorf("IndexName(): %s != metrics-2023.07.05", name)
+	}
+}
+
+func TestTimerUnits(t *testing.T) {
+	r := metrics.NewRegistry()
+	metrics.GetOrRegisterTimer("baz", r).Update(2 * time.Second)
+	docs := Documents(r, "", time.Millisecond, time.Now())
+	if v := docs[0].Fields["max"]; v != 2000.0 {
+		t.Errorf("baz.max: %v != 2000", v)
+	}
+	if v := docs[0].Fields["count"]; v != int64(1) {
+		t.Errorf("baz.count: %v != 1", v)
+	}
+}
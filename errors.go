@@ -0,0 +1,141 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// CollectorError is returned when a collector fails to read its statistics.
+type CollectorError struct {
+	Collector string // Name of the failed collector, i.e "cpu".
+	Err       error
+}
+
+func (err *CollectorError) Error() string {
+	return fmt.Sprintf("metrics: %s collector: %s", err.Collector, err.Err)
+}
+
+// Unwrap returns the underlying error.
+func (err *CollectorError) Unwrap() error { return err.Err }
+
+var collectorErrors struct {
+	sync.Mutex
+	count   int64
+	last    map[string]error
+	handler func(error)
+	metrics struct {
+		Count     Counter
+		LastError Healthcheck
+	}
+}
+
+// SetCollectorErrorHandler sets the function called with the errors of the
+// periodic Capture* loops, such as CaptureCPUStats. The loops keep running
+// after an error. A nil handler restores the default, which logs the error.
+func SetCollectorErrorHandler(f func(error)) {
+	collectorErrors.Lock()
+	defer collectorErrors.Unlock()
+	collectorErrors.handler = f
+}
+
+// CollectorErrorCount returns the number of errors reported by collectors.
+func CollectorErrorCount() int64 {
+	collectorErrors.Lock()
+	defer collectorErrors.Unlock()
+	return collectorErrors.count
+}
+
+// RegisterCollectorErrors registers a counter of collector errors and a
+// healthcheck which is unhealthy while the last run of any collector failed.
+// The same metrics are shared by every registry they are registered in.
+func RegisterCollectorErrors(r Registry) {
+	if r == nil {
+		r = DefaultRegistry
+	}
+	collectorErrors.Lock()
+	defer collectorErrors.Unlock()
+	if collectorErrors.metrics.Count == nil {
+		collectorErrors.metrics.Count = NewCounter()
+		collectorErrors.metrics.Count.Inc(collectorErrors.count)
+		collectorErrors.metrics.LastError = NewHealthcheck(checkCollectors)
+	}
+	r.Register("collector.errors", collectorErrors.metrics.Count)
+	r.Register("collector.lastError", collectorErrors.metrics.LastError)
+}
+
+// Records the outcome of a collector run. A non-nil error is counted and
+// stored until the collector next succeeds.
+func collected(name string, err error) error {
+	collectorErrors.Lock()
+	defer collectorErrors.Unlock()
+	if err == nil {
+		if _, ok := collectorErrors.last[name]; ok {
+			delete(collectorErrors.last, name)
+			updateLastError()
+		}
+		return nil
+	}
+	err = &CollectorError{Collector: name, Err: err}
+	if collectorErrors.last == nil {
+		collectorErrors.last = map[string]error{}
+	}
+	collectorErrors.last[name] = err
+	collectorErrors.count++
+	if collectorErrors.metrics.Count != nil {
+		collectorErrors.metrics.Count.Inc(1)
+	}
+	updateLastError()
+	return err
+}
+
+// Passes err to the configured collector error handler.
+func handleCollectorError(err error) {
+	if err == nil {
+		return
+	}
+	collectorErrors.Lock()
+	f := collectorErrors.handler
+	collectorErrors.Unlock()
+	if f == nil {
+		log.Printf("ERROR %s", err)
+		return
+	}
+	f(err)
+}
+
+func checkCollectors(h Healthcheck) {
+	collectorErrors.Lock()
+	defer collectorErrors.Unlock()
+	setLastError(h)
+}
+
+// Updates the registered healthcheck, so that registry snapshots, which do
+// not run healthchecks, see the outcome of the last collector runs. Must be
+// called with the lock held.
+func updateLastError() {
+	if h := collectorErrors.metrics.LastError; h != nil {
+		setLastError(h)
+	}
+}
+
+// Must be called with the lock held.
+func setLastError(h Healthcheck) {
+	if len(collectorErrors.last) == 0 {
+		h.Healthy()
+		return
+	}
+	names := make([]string, 0, len(collectorErrors.last))
+	for name := range collectorErrors.last {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	msgs := make([]string, len(names))
+	for i, name := range names {
+		msgs[i] = collectorErrors.last[name].Error()
+	}
+	h.Unhealthy(errors.New(strings.Join(msgs, "; ")))
+}
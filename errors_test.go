@@ -0,0 +1,62 @@
+package metrics
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCollectorErrors(t *testing.T) {
+	r := NewRegistry()
+	RegisterCollectorErrors(r)
+	defer SetCollectorErrorHandler(nil)
+
+	var handled []error
+	SetCollectorErrorHandler(func(err error) { handled = append(handled, err) })
+
+	before := CollectorErrorCount()
+	errRead := errors.New("permission denied")
+	handleCollectorError(collected("test", errRead))
+	handleCollectorError(collected("other", nil))
+
+	if n := CollectorErrorCount() - before; n != 1 {
+		t.Errorf("CollectorErrorCount(): %d != 1", n)
+	}
+	if len(handled) != 1 || !errors.Is(handled[0], errRead) {
+		t.Fatalf("handler: unexpected errors %v", handled)
+	}
+	var collectorErr *CollectorError
+	if !errors.As(handled[0], &collectorErr) || collectorErr.Collector != "test" {
+		t.Errorf("handler: expected *CollectorError for test, got %v", handled[0])
+	}
+
+	h := r.Get("collector.lastError").(Healthcheck)
+	h.Check()
+	if h.Error() == nil {
+		t.Error("collector.lastError: expected unhealthy")
+	}
+	collected("test", nil)
+	h.Check()
+	if err := h.Error(); err != nil {
+		t.Errorf("collector.lastError: expected healthy, got %s", err)
+	}
+}
+
+func TestCaptureUnregisteredStats(t *testing.T) {
+	if len(cpuCollectors) == 0 {
+		if err := CaptureCPUStatsOnce(); err == nil {
+			t.Error("CaptureCPUStatsOnce(): expected error before registration")
+		}
+	}
+	if len(diskCollectors) == 0 {
+		if err := CaptureDiskStatsOnce(); err == nil {
+			t.Error("CaptureDiskStatsOnce(): expected error before registration")
+		}
+	}
+	var err *CollectorError
+	if !errors.As(CaptureDebugGCStatsOnce(NewRegistry()), &err) || err.Collector != "debug" {
+		t.Errorf("CaptureDebugGCStatsOnce(): %v for an unregistered registry", err)
+	}
+	collected("cpu", nil)
+	collected("disk", nil)
+	collected("debug", nil)
+}
@@ -0,0 +1,121 @@
+package metrics
+
+// RegistryEventType is the kind of change described by a RegistryEvent.
+type RegistryEventType int
+
+const (
+	// MetricRegistered is sent after a metric is registered.
+	MetricRegistered RegistryEventType = iota
+
+	// MetricUnregistered is sent after a metric is unregistered, including
+	// by UnregisterAll and by the expiry of a registry with a TTL.
+	MetricUnregistered
+)
+
+func (t RegistryEventType) String() string {
+	switch t {
+	case MetricRegistered:
+		return "registered"
+	case MetricUnregistered:
+		return "unregistered"
+	}
+	return "unknown"
+}
+
+// RegistryEvent describes the registration or unregistration of a metric.
+type RegistryEvent struct {
+	Type   RegistryEventType
+	Name   string      // Name of the metric in the registry that sent the event.
+	Metric interface{} // The metric that was registered or unregistered.
+}
+
+// SubscribeChannel subscribes to the events of r and sends them to ch. Sends
+// block, so ch should be buffered and drained continuously. Returns a
+// function which cancels the subscription.
+func SubscribeChannel(r Registry, ch chan<- RegistryEvent) func() {
+	return r.Subscribe(func(e RegistryEvent) { ch <- e })
+}
+
+// The subscribers of a registry, and the events waiting to be sent to them.
+type registrySubscribers struct {
+	sending  bool // Whether a goroutine is sending the queued events.
+	next     int
+	handlers map[int]func(RegistryEvent)
+	events   []RegistryEvent
+}
+
+// Subscribe calls f with every subsequent registration and unregistration of
+// a metric. Events are sent in order, after the registry has been changed, by
+// the goroutine which changed it, or by a goroutine which is already sending
+// earlier events. The registry is not locked while f runs, so f may read from
+// the registry; changes that f makes to it are sent once f returns. If f
+// panics, the other events are still sent, and the panic is raised again by
+// the sending goroutine once they have been. Returns a function which cancels
+// the subscription.
+func (r *StandardRegistry) Subscribe(f func(RegistryEvent)) func() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.subscribers.handlers == nil {
+		r.subscribers.handlers = map[int]func(RegistryEvent){}
+	}
+	id := r.subscribers.next
+	r.subscribers.next++
+	r.subscribers.handlers[id] = f
+	return func() {
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+		delete(r.subscribers.handlers, id)
+	}
+}
+
+// Queues an event for dispatch. Must be called with the write lock held.
+func (r *StandardRegistry) notify(t RegistryEventType, name string, i interface{}) {
+	if len(r.subscribers.handlers) == 0 {
+		return
+	}
+	r.subscribers.events = append(r.subscribers.events,
+		RegistryEvent{Type: t, Name: name, Metric: i})
+}
+
+// Sends the queued events to the subscribers, unless another call is already
+// sending them, in which case it will also send those queued by this call.
+// The first panic of a handler is raised again once every event was sent.
+// Must be called without the lock held.
+func (r *StandardRegistry) dispatch() {
+	var panicked interface{}
+	r.mutex.Lock()
+	if r.subscribers.sending {
+		r.mutex.Unlock()
+		return
+	}
+	r.subscribers.sending = true
+	for len(r.subscribers.events) > 0 {
+		events := r.subscribers.events
+		r.subscribers.events = nil
+		handlers := make([]func(RegistryEvent), 0, len(r.subscribers.handlers))
+		for _, f := range r.subscribers.handlers {
+			handlers = append(handlers, f)
+		}
+		r.mutex.Unlock()
+		for _, e := range events {
+			for _, f := range handlers {
+				if p := send(f, e); p != nil && panicked == nil {
+					panicked = p
+				}
+			}
+		}
+		r.mutex.Lock()
+	}
+	r.subscribers.sending = false
+	r.mutex.Unlock()
+	if panicked != nil {
+		panic(panicked)
+	}
+}
+
+// Calls f with e, and returns the value with which f panicked, if any.
+func send(f func(RegistryEvent), e RegistryEvent) (panicked interface{}) {
+	defer func() { panicked = recover() }()
+	f(e)
+	return nil
+}
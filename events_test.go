@@ -0,0 +1,152 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRegistrySubscribe(t *testing.T) {
+	r := NewRegistry()
+	var events []RegistryEvent
+	unsubscribe := r.Subscribe(func(e RegistryEvent) {
+		// Subscribers may read from the registry.
+		if e.Type == MetricRegistered && r.Get(e.Name) != e.Metric {
+			t.Errorf("%s: not registered when notified", e.Name)
+		}
+		events = append(events, e)
+	})
+
+	c := GetOrRegisterCounter("foo", r)
+	GetOrRegisterCounter("foo", r)
+	r.Register("bar", NewGauge())
+	r.Register("bar", NewGauge())
+	r.Unregister("foo")
+	r.Unregister("missing")
+	r.UnregisterAll()
+	unsubscribe()
+	r.Register("baz", NewGauge())
+
+	expect := []RegistryEvent{
+		{MetricRegistered, "foo", c},
+		{MetricRegistered, "bar", nil},
+		{MetricUnregistered, "foo", c},
+		{MetricUnregistered, "bar", nil},
+	}
+	if len(events) != len(expect) {
+		t.Fatalf("events: %v != %v", events, expect)
+	}
+	for i, e := range expect {
+		if events[i].Type != e.Type || events[i].Name != e.Name ||
+			(e.Metric != nil && events[i].Metric != e.Metric) {
+			t.Errorf("events[%d]: %v != %v", i, events[i], e)
+		}
+	}
+}
+
+func TestSubscribeReadsTTLRegistry(t *testing.T) {
+	r := NewRegistryWithTTL(time.Minute, nil)
+	now := time.Unix(1700000000, 0)
+	r.now = func() time.Time { return now }
+	var events []RegistryEvent
+	r.Subscribe(func(e RegistryEvent) {
+		// Each expires metrics, which sends more events.
+		r.Each(func(string, interface{}) {})
+		events = append(events, e)
+	})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		GetOrRegisterCounter("foo", r)
+		now = now.Add(2 * time.Minute)
+		GetOrRegisterCounter("bar", r)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Subscribe(): deadlock when a subscriber reads the registry")
+	}
+	expect := []RegistryEvent{
+		{MetricRegistered, "foo", nil},
+		{MetricRegistered, "bar", nil},
+		{MetricUnregistered, "foo", nil},
+	}
+	if len(events) != len(expect) {
+		t.Fatalf("events: %v != %v", events, expect)
+	}
+	for i, e := range expect {
+		if events[i].Type != e.Type || events[i].Name != e.Name {
+			t.Errorf("events[%d]: %v != %v", i, events[i], e)
+		}
+	}
+}
+
+func TestSubscribeChannel(t *testing.T) {
+	r := NewRegistryWithTTL(time.Minute, nil)
+	now := time.Now()
+	r.now = func() time.Time { return now }
+	ch := make(chan RegistryEvent, 2)
+	defer SubscribeChannel(r, ch)()
+
+	GetOrRegisterCounter("foo", r)
+	now = now.Add(2 * time.Minute)
+	r.Expire()
+	for _, typ := range []RegistryEventType{MetricRegistered, MetricUnregistered} {
+		if e := <-ch; e.Type != typ || e.Name != "foo" {
+			t.Errorf("SubscribeChannel(): %v != %s foo", e, typ)
+		}
+	}
+}
+
+func TestPrefixedRegistrySubscribe(t *testing.T) {
+	parent := NewRegistry()
+	r := NewPrefixedChildRegistry(NewPrefixedChildRegistry(parent, "a."), "b.")
+	var names []string
+	defer r.Subscribe(func(e RegistryEvent) { names = append(names, e.Name) })()
+	GetOrRegisterCounter("foo", r)
+	GetOrRegisterCounter("a.other", parent)
+	if len(names) != 1 || names[0] != "a.b.foo" {
+		t.Errorf("Subscribe(): %v != [a.b.foo]", names)
+	}
+}
+
+func TestRegistrySubscribePanic(t *testing.T) {
+	r := NewRegistry()
+	var names []string
+	r.Subscribe(func(e RegistryEvent) {
+		if e.Name == "bad" {
+			panic("bad")
+		}
+	})
+	r.Subscribe(func(e RegistryEvent) { names = append(names, e.Name) })
+	func() {
+		defer func() {
+			if recover() != "bad" {
+				t.Error("Register(): expected the handler's panic")
+			}
+		}()
+		r.Register("bad", NewCounter())
+	}()
+	r.Register("good", NewCounter())
+	if len(names) != 2 || names[0] != "bad" || names[1] != "good" {
+		t.Errorf("Subscribe(): %v", names)
+	}
+}
+
+func TestRegistrySubscribePanicBatch(t *testing.T) {
+	r := NewRegistry()
+	GetOrRegisterCounter("a", r)
+	GetOrRegisterCounter("b", r)
+	var names []string
+	r.Subscribe(func(e RegistryEvent) {
+		names = append(names, e.Name)
+		panic("handler")
+	})
+	func() {
+		defer func() { recover() }()
+		r.UnregisterAll()
+	}()
+	if len(names) != 2 {
+		t.Errorf("UnregisterAll(): sent %v, expected a and b", names)
+	}
+}
@@ -0,0 +1,282 @@
+package metrics
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// RegistryFilter selects the metrics of a FilteredRegistry.
+//
+// Patterns are globs matched against the whole name, in which * matches any
+// characters except a dot, ** matches any characters and ? matches one
+// character except a dot, i.e runtime.* or **.latency. A pattern enclosed in
+// slashes, i.e /^runtime\.(Mem|Num)/, is a regular expression instead.
+type RegistryFilter struct {
+	Allow []string // Patterns of names to include, or empty to include every name.
+	Deny  []string // Patterns of names to exclude, even if they are allowed.
+	Types []string // Metric types to include, i.e "counter" or "timer", or empty for every type.
+}
+
+// FilteredRegistry is a view of a Registry which only exposes the metrics
+// selected by a RegistryFilter. It lets exporters of the same registry ship
+// different metrics, i.e runtime metrics to Graphite and the others to
+// InfluxDB.
+//
+// Each, GetAll, Snapshot and Subscribe only report the selected metrics, and
+// RunHealthchecks and UnregisterAll only act on them. Get, GetOrRegister,
+// Register, SinkOnce and Unregister are passed to the underlying registry
+// unchanged, so that a FilteredRegistry can be handed to code which registers
+// metrics. Metrics stored with SinkOnce which are not selected are dequeued by
+// Each and Snapshot without being reported.
+type FilteredRegistry struct {
+	underlying Registry
+	allow      []*regexp.Regexp
+	deny       []*regexp.Regexp
+	types      map[string]bool
+}
+
+// NewFilteredRegistry creates a new FilteredRegistry over r, or
+// DefaultRegistry if r is nil. Returns an error if a pattern or a type of the
+// filter is invalid.
+func NewFilteredRegistry(r Registry, filter RegistryFilter) (*FilteredRegistry, error) {
+	if r == nil {
+		r = DefaultRegistry
+	}
+	allow, err := compilePatterns(filter.Allow)
+	if err != nil {
+		return nil, err
+	}
+	deny, err := compilePatterns(filter.Deny)
+	if err != nil {
+		return nil, err
+	}
+	var types map[string]bool
+	if len(filter.Types) > 0 {
+		types = make(map[string]bool)
+	}
+	for _, t := range filter.Types {
+		switch t {
+		case "counter", "gauge", "gauge_float64", "healthcheck", "histogram", "info", "meter", "timer":
+			types[t] = true
+		default:
+			return nil, fmt.Errorf("unknown metric type %q", t)
+		}
+	}
+	return &FilteredRegistry{underlying: r, allow: allow, deny: deny, types: types}, nil
+}
+
+// Each calls the given function for each selected metric.
+func (r *FilteredRegistry) Each(f func(string, interface{})) {
+	r.underlying.Each(func(name string, i interface{}) {
+		if r.match(name, i) {
+			f(name, i)
+		}
+	})
+}
+
+// Get the metric by the given name from the underlying registry, or nil if
+// none is registered.
+func (r *FilteredRegistry) Get(name string) interface{} {
+	return r.underlying.Get(name)
+}
+
+// GetAll selected metrics in the Registry.
+func (r *FilteredRegistry) GetAll() map[string]map[string]interface{} {
+	data := make(map[string]map[string]interface{})
+	names := resolver{}
+	for key, values := range r.underlying.GetAll() {
+		name := getAllName(key, values)
+		if r.matchName(name) && (r.types == nil || r.match(name, names.lookup(r.underlying, name))) {
+			data[key] = values
+		}
+	}
+	return data
+}
+
+// GetOrRegister gets an existing metric or registers the given one in the
+// underlying registry.
+func (r *FilteredRegistry) GetOrRegister(name string, i interface{}) interface{} {
+	return r.underlying.GetOrRegister(name, i)
+}
+
+// Register the given metric under the given name in the underlying registry.
+func (r *FilteredRegistry) Register(name string, i interface{}) error {
+	return r.underlying.Register(name, i)
+}
+
+// SinkOnce enqueues the given metric in the underlying registry.
+func (r *FilteredRegistry) SinkOnce(name string, i interface{}) {
+	r.underlying.SinkOnce(name, i)
+}
+
+// RunHealthchecks runs the selected healthchecks. Like Each, it dequeues the
+// metrics stored with SinkOnce.
+func (r *FilteredRegistry) RunHealthchecks() {
+	r.Each(func(name string, i interface{}) {
+		if h, ok := i.(Healthcheck); ok {
+			h.Check()
+		}
+	})
+}
+
+// Unregister the metric with the given name from the underlying registry.
+func (r *FilteredRegistry) Unregister(name string) {
+	r.underlying.Unregister(name)
+}
+
+// UnregisterAll unregisters the selected metrics, leaving the others
+// registered. Like Each, it dequeues the metrics stored with SinkOnce.
+func (r *FilteredRegistry) UnregisterAll() {
+	var names []string
+	r.Each(func(name string, i interface{}) { names = append(names, name) })
+	res := resolver{}
+	for _, name := range names {
+		if base, name := res.resolve(r.underlying, name); base != nil {
+			base.Unregister(name)
+		}
+	}
+}
+
+// Snapshot returns a RegistrySnapshot of the selected metrics.
+func (r *FilteredRegistry) Snapshot() RegistrySnapshot {
+	var s RegistrySnapshot
+	for _, m := range r.underlying.Snapshot() {
+		if r.match(m.Name, m.Metric) {
+			s = append(s, m)
+		}
+	}
+	return s
+}
+
+// Subscribe calls f with every subsequent registration and unregistration of
+// a selected metric.
+func (r *FilteredRegistry) Subscribe(f func(RegistryEvent)) func() {
+	return r.underlying.Subscribe(func(e RegistryEvent) {
+		if r.match(e.Name, e.Metric) {
+			f(e)
+		}
+	})
+}
+
+func (r *FilteredRegistry) underlyingRegistry(name string) (Registry, string) {
+	return r.underlying, name
+}
+
+// Reports whether the metric is selected by the filter.
+func (r *FilteredRegistry) match(name string, i interface{}) bool {
+	return r.matchName(name) && (r.types == nil || r.types[metricKind(i)])
+}
+
+// Reports whether the name is selected by the allow and deny patterns.
+func (r *FilteredRegistry) matchName(name string) bool {
+	if len(r.allow) > 0 && !matchAny(r.allow, name) {
+		return false
+	}
+	return !matchAny(r.deny, name)
+}
+
+func matchAny(patterns []*regexp.Regexp, name string) bool {
+	for _, re := range patterns {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+func compilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	res := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		re, err := compilePattern(p)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+// Compiles a glob, or a regular expression enclosed in slashes.
+func compilePattern(p string) (*regexp.Regexp, error) {
+	if len(p) >= 2 && strings.HasPrefix(p, "/") && strings.HasSuffix(p, "/") {
+		return regexp.Compile(p[1 : len(p)-1])
+	}
+	var expr strings.Builder
+	expr.WriteString("^")
+	for i := 0; i < len(p); i++ {
+		switch {
+		case strings.HasPrefix(p[i:], "**"):
+			expr.WriteString(".*")
+			i++
+		case p[i] == '*':
+			expr.WriteString(`[^.]*`)
+		case p[i] == '?':
+			expr.WriteString(`[^.]`)
+		default:
+			expr.WriteString(regexp.QuoteMeta(p[i : i+1]))
+		}
+	}
+	expr.WriteString("$")
+	return regexp.Compile(expr.String())
+}
+
+// registryView is implemented by the registries which are views of another
+// registry, i.e a PrefixedRegistry, so that resolve can look through them.
+type registryView interface {
+	// Returns the registry under the view and the name in it of the metric
+	// reported under name by the view's Each, or nil if there is none.
+	underlyingRegistry(name string) (Registry, string)
+}
+
+// Returns the innermost registry in which the metric reported under name by
+// r's Each is registered, and its name in that registry, looking through the
+// registries which are views of another. Returns nil if r reports no such
+// name.
+func resolve(r Registry, name string) (Registry, string) {
+	return resolver{}.resolve(r, name)
+}
+
+// Lookup returns the metric which r's Each reports under name, or nil if none
+// is registered. Unlike Get, it looks through the views of another registry,
+// i.e a RewriteRegistry, whose Get expects the names of the underlying
+// registry.
+func Lookup(r Registry, name string) interface{} {
+	return resolver{}.lookup(r, name)
+}
+
+// A resolver resolves names like resolve, but lists the names of each
+// RewriteRegistry only once, so that resolving every name of a registry
+// does not list them once per name.
+type resolver map[*RewriteRegistry]map[string]string
+
+func (res resolver) resolve(r Registry, name string) (Registry, string) {
+	if rw, ok := r.(*RewriteRegistry); ok {
+		originals, ok := res[rw]
+		if !ok {
+			originals = rw.originalNames()
+			res[rw] = originals
+		}
+		original, ok := originals[name]
+		if !ok {
+			return nil, ""
+		}
+		return res.resolve(rw.underlying, original)
+	}
+	if v, ok := r.(registryView); ok {
+		underlying, name := v.underlyingRegistry(name)
+		if underlying == nil {
+			return nil, ""
+		}
+		return res.resolve(underlying, name)
+	}
+	return r, name
+}
+
+func (res resolver) lookup(r Registry, name string) interface{} {
+	base, name := res.resolve(r, name)
+	if base == nil {
+		return nil
+	}
+	return base.Get(name)
+}
@@ -0,0 +1,168 @@
+package metrics
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+)
+
+func TestCompilePattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		match   bool
+	}{
+		{"runtime.*", "runtime.NumGoroutine", true},
+		{"runtime.*", "runtime.MemStats.Alloc", false},
+		{"runtime.**", "runtime.MemStats.Alloc", true},
+		{"**.latency", "http.api.latency", true},
+		{"cpu.?", "cpu.a", true},
+		{"cpu.?", "cpu.ab", false},
+		{"a+b", "a+b", true},
+		{"a+b", "aab", false},
+		{`/^runtime\.(Mem|Num)/`, "runtime.MemStats.Alloc", true},
+		{`/^runtime\.(Mem|Num)/`, "runtime.ReadMemStats", false},
+	}
+	for _, tt := range tests {
+		re, err := compilePattern(tt.pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m := re.MatchString(tt.name); m != tt.match {
+			t.Errorf("compilePattern(%q): %s: %v != %v", tt.pattern, tt.name, m, tt.match)
+		}
+	}
+}
+
+func TestFilteredRegistry(t *testing.T) {
+	parent := NewRegistry()
+	GetOrRegisterCounter("runtime.NumGC", parent)
+	GetOrRegisterGauge("runtime.NumGoroutine", parent)
+	GetOrRegisterCounter("runtime.MemStats.Frees", parent)
+	GetOrRegisterCounter("orders", parent)
+	parent.Register("health", NewHealthcheck(func(Healthcheck) { t.Error("RunHealthchecks(): ran health") }))
+
+	r, err := NewFilteredRegistry(parent, RegistryFilter{
+		Allow: []string{"runtime.**"},
+		Deny:  []string{"runtime.MemStats.*"},
+		Types: []string{"counter"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	r.Each(func(name string, i interface{}) { names = append(names, name) })
+	if len(names) != 1 || names[0] != "runtime.NumGC" {
+		t.Errorf("Each(): %v != [runtime.NumGC]", names)
+	}
+	if s := r.Snapshot(); len(s) != 1 || s[0].Name != "runtime.NumGC" {
+		t.Errorf("Snapshot(): %v", s)
+	}
+	if all := r.GetAll(); len(all) != 1 || all["runtime.NumGC"] == nil {
+		t.Errorf("GetAll(): %v", all)
+	}
+	r.RunHealthchecks()
+
+	var events []string
+	defer r.Subscribe(func(e RegistryEvent) { events = append(events, e.Name) })()
+	GetOrRegisterCounter("runtime.NumCgoCall", r)
+	GetOrRegisterCounter("other", r)
+	if len(events) != 1 || events[0] != "runtime.NumCgoCall" {
+		t.Errorf("Subscribe(): %v != [runtime.NumCgoCall]", events)
+	}
+	if parent.Get("other") == nil {
+		t.Error("GetOrRegister(): not registered in the underlying registry")
+	}
+
+	r.UnregisterAll()
+	names = nil
+	parent.Each(func(name string, i interface{}) { names = append(names, name) })
+	sort.Strings(names)
+	want := []string{"health", "orders", "other", "runtime.MemStats.Frees", "runtime.NumGoroutine"}
+	if len(names) != len(want) {
+		t.Fatalf("UnregisterAll(): %v != %v", names, want)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Errorf("UnregisterAll(): %v != %v", names, want)
+		}
+	}
+}
+
+func TestFilteredPrefixedRegistry(t *testing.T) {
+	parent := NewRegistry()
+	prefixed := NewPrefixedChildRegistry(parent, "app.")
+	GetOrRegisterCounter("foo", prefixed)
+	GetOrRegisterGauge("bar", prefixed)
+	r, err := NewFilteredRegistry(prefixed, RegistryFilter{Types: []string{"counter"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if all := r.GetAll(); len(all) != 1 || all["app.foo"] == nil {
+		t.Errorf("GetAll(): %v", all)
+	}
+	r.UnregisterAll()
+	if parent.Get("app.foo") != nil || parent.Get("app.bar") == nil {
+		t.Error("UnregisterAll(): unexpected metrics unregistered")
+	}
+}
+
+func TestFilteredRewriteRegistry(t *testing.T) {
+	parent := NewRegistry()
+	GetOrRegisterCounter("http.GET.200", parent)
+	GetOrRegisterGauge("Queue.Depth", parent)
+	checked := false
+	parent.Register("Health", NewHealthcheck(func(Healthcheck) { checked = true }))
+	rewritten, err := NewRewriteRegistry(parent, []RewriteRule{
+		{Template: "http.{method}.{status}"},
+		{Case: SnakeCase},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewFilteredRegistry(rewritten, RegistryFilter{Types: []string{"counter", "healthcheck"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if all := r.GetAll(); len(all) != 2 || all[`http{method="GET",status="200"}`] == nil || all["health"] == nil {
+		t.Errorf("GetAll(): %v", all)
+	}
+	r.RunHealthchecks()
+	if !checked {
+		t.Error("RunHealthchecks(): did not run health")
+	}
+	r.UnregisterAll()
+	if parent.Get("http.GET.200") != nil || parent.Get("Health") != nil || parent.Get("Queue.Depth") == nil {
+		t.Error("UnregisterAll(): unexpected metrics unregistered")
+	}
+}
+
+func TestFilteredRewriteRegistryGetAllListsOnce(t *testing.T) {
+	parent := &countingRegistry{StandardRegistry: NewRegistry().(*StandardRegistry)}
+	for i := 0; i < 100; i++ {
+		GetOrRegisterCounter(fmt.Sprintf("c%d", i), parent)
+	}
+	rewritten, err := NewRewriteRegistry(parent, []RewriteRule{{Case: SnakeCase}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewFilteredRegistry(rewritten, RegistryFilter{Types: []string{"counter"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if all := r.GetAll(); len(all) != 100 {
+		t.Errorf("GetAll(): %d metrics != 100", len(all))
+	}
+	if parent.getAlls > 2 {
+		t.Errorf("GetAll(): %d calls to the underlying GetAll", parent.getAlls)
+	}
+}
+
+func TestFilteredRegistryInvalid(t *testing.T) {
+	if _, err := NewFilteredRegistry(nil, RegistryFilter{Allow: []string{"/(/"}}); err == nil {
+		t.Error("NewFilteredRegistry(): expected an error for an invalid regexp")
+	}
+	if _, err := NewFilteredRegistry(nil, RegistryFilter{Types: []string{"sketch"}}); err == nil {
+		t.Error("NewFilteredRegistry(): expected an error for an unknown type")
+	}
+}
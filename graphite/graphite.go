@@ -63,7 +63,7 @@ func Once(c Config) error {
 }
 
 func graphite(w *bufio.Writer, c *Config) {
-	c.Registry.Each(func(name string, i interface{}) {
+	c.Registry.Snapshot().Each(func(name string, i interface{}) {
 		logging.EncodeGraphite(w, name, c.Prefix, i)
 		w.Flush()
 	})
@@ -1,5 +1,7 @@
 package metrics
 
+import "sync"
+
 // Healthcheck holds an error value describing an arbitrary up/down status.
 type Healthcheck interface {
 	Check()
@@ -14,7 +16,7 @@ func NewHealthcheck(f func(Healthcheck)) Healthcheck {
 	if UseNilMetrics {
 		return NilHealthcheck{}
 	}
-	return &StandardHealthcheck{nil, f}
+	return &StandardHealthcheck{f: f}
 }
 
 // NilHealthcheck is a no-op.
@@ -35,8 +37,9 @@ func (NilHealthcheck) Unhealthy(error) {}
 // StandardHealthcheck is the standard implementation of a Healthcheck and
 // stores the pstatus and a function to call to update the status.
 type StandardHealthcheck struct {
-	err error
-	f   func(Healthcheck)
+	err   error
+	f     func(Healthcheck)
+	mutex sync.Mutex
 }
 
 // Check runs the healthcheck function to update the healthcheck's status.
@@ -46,16 +49,46 @@ func (h *StandardHealthcheck) Check() {
 
 // Error returns the healthcheck's status, which will be nil if it is healthy.
 func (h *StandardHealthcheck) Error() error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
 	return h.err
 }
 
 // Healthy marks the healthcheck as healthy.
 func (h *StandardHealthcheck) Healthy() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
 	h.err = nil
 }
 
 // Unhealthy marks the healthcheck as unhealthy.  The error is stored and
 // may be retrieved by the Error method.
 func (h *StandardHealthcheck) Unhealthy(err error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
 	h.err = err
 }
+
+// HealthcheckSnapshot is a read-only copy of the status of another
+// Healthcheck.
+type HealthcheckSnapshot struct {
+	err error
+}
+
+// Check panics.
+func (HealthcheckSnapshot) Check() {
+	panic("Check called on a HealthcheckSnapshot")
+}
+
+// Error returns the status at the time the snapshot was taken.
+func (h HealthcheckSnapshot) Error() error { return h.err }
+
+// Healthy panics.
+func (HealthcheckSnapshot) Healthy() {
+	panic("Healthy called on a HealthcheckSnapshot")
+}
+
+// Unhealthy panics.
+func (HealthcheckSnapshot) Unhealthy(error) {
+	panic("Unhealthy called on a HealthcheckSnapshot")
+}
@@ -49,7 +49,7 @@ func NewRegisteredHistogram(name string, r Registry, s Sample) Histogram {
 
 // HistogramSnapshot is a read-only copy of another Histogram.
 type HistogramSnapshot struct {
-	sample *SampleSnapshot
+	sample Sample // A snapshot of the histogram's sample.
 }
 
 // Clear panics.
@@ -189,7 +189,7 @@ func (h *StandardHistogram) Sample() Sample { return h.sample }
 // Snapshot returns a read-only copy of the histogram.
 func (h *StandardHistogram) Snapshot() Histogram {
 	return &HistogramSnapshot{
-		sample: h.sample.Snapshot().(*SampleSnapshot),
+		sample: h.sample.Snapshot(),
 	}
 }
 
@@ -66,6 +66,16 @@ func TestHistogramSnapshot(t *testing.T) {
 	testHistogram10000(t, snapshot)
 }
 
+func TestHistogramSnapshotBucketSample(t *testing.T) {
+	h := NewHistogram(NewBucketSample([]float64{0, 10, 20}))
+	h.Update(5)
+	snapshot := h.Snapshot()
+	h.Update(15)
+	if count := snapshot.Count(); count != 1 {
+		t.Errorf("snapshot.Count(): 1 != %v\n", count)
+	}
+}
+
 func testHistogram10000(t *testing.T, h Histogram) {
 	if count := h.Count(); count != 10000 {
 		t.Errorf("h.Count(): 10000 != %v\n", count)
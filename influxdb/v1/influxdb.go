@@ -60,87 +60,97 @@ func influxdb(c *Config) error {
 	pts := []client.Point{}
 
 	now := time.Now().UTC()
-	c.Registry.Each(func(name string, i interface{}) {
+	c.Registry.Snapshot().Each(func(name string, i interface{}) {
+		tags := metrics.MetricLabels(i)
 		switch metric := i.(type) {
 		case metrics.Counter:
-			m := metric.Snapshot()
 			pts = append(pts, client.Point{
 				Measurement: prefix + name,
+				Tags:        tags,
 				Time:        now,
 				Fields: map[string]interface{}{
-					"count": m.Count(),
+					"count": metric.Count(),
 				},
 			})
 		case metrics.Gauge:
-			m := metric.Snapshot()
 			pts = append(pts, client.Point{
 				Measurement: prefix + name,
+				Tags:        tags,
 				Time:        now,
 				Fields: map[string]interface{}{
-					"gauge": m.Value(),
+					"gauge": metric.Value(),
 				},
 			})
 		case metrics.GaugeFloat64:
-			m := metric.Snapshot()
 			pts = append(pts, client.Point{
 				Measurement: prefix + name,
+				Tags:        tags,
 				Time:        now,
 				Fields: map[string]interface{}{
-					"gauge": m.Value(),
+					"gauge": metric.Value(),
+				},
+			})
+		case metrics.Info:
+			pts = append(pts, client.Point{
+				Measurement: prefix + name,
+				Tags:        tags,
+				Time:        now,
+				Fields: map[string]interface{}{
+					"value": metric.Value(),
 				},
 			})
 		case metrics.Meter:
-			m := metric.Snapshot()
 			pts = append(pts, client.Point{
 				Measurement: prefix + name,
+				Tags:        tags,
 				Time:        now,
 				Fields: map[string]interface{}{
-					"count":      m.Count(),
-					"rate.1min":  m.Rate1(),
-					"rate.5min":  m.Rate5(),
-					"rate.15min": m.Rate15(),
-					"rate.mean":  m.RateMean(),
+					"count":      metric.Count(),
+					"rate.1min":  metric.Rate1(),
+					"rate.5min":  metric.Rate5(),
+					"rate.15min": metric.Rate15(),
+					"rate.mean":  metric.RateMean(),
 				},
 			})
 		case metrics.Timer:
-			m := metric.Snapshot()
-			ps := m.Percentiles([]float64{0.5, 0.75, 0.95, 0.99, 0.999})
+			ps := metric.Percentiles([]float64{0.5, 0.75, 0.95, 0.99, 0.999})
 			pts = append(pts, client.Point{
 				Measurement: prefix + name,
+				Tags:        tags,
 				Time:        now,
 				Fields: map[string]interface{}{
-					"count":           m.Count(),
-					"min":             m.Min(),
-					"max":             m.Max(),
-					"mean":            m.Mean(),
-					"sum":             m.Sum(),
-					"variance":        m.Variance(),
-					"stddev":          m.StdDev(),
+					"count":           metric.Count(),
+					"min":             metric.Min(),
+					"max":             metric.Max(),
+					"mean":            metric.Mean(),
+					"sum":             metric.Sum(),
+					"variance":        metric.Variance(),
+					"stddev":          metric.StdDev(),
 					"median":          ps[0],
 					"percentile.75":   ps[1],
 					"percentile.95":   ps[2],
 					"percentile.99.0": ps[3],
 					"percentile.99.9": ps[4],
-					"rate.1min":       m.Rate1(),
-					"rate.5min":       m.Rate5(),
-					"rate.15min":      m.Rate15(),
-					"rate.mean":       m.RateMean(),
+					"rate.1min":       metric.Rate1(),
+					"rate.5min":       metric.Rate5(),
+					"rate.15min":      metric.Rate15(),
+					"rate.mean":       metric.RateMean(),
 				},
 			})
 		case metrics.Histogram:
-			m := metric.Snapshot()
-			ps := m.Percentiles([]float64{0.5, 0.75, 0.95, 0.99, 0.999})
+			ps := metric.Percentiles([]float64{0.5, 0.75, 0.95, 0.99, 0.999})
 			pts = append(pts, client.Point{
 				Measurement: prefix + name,
+				Tags:        tags,
 				Time:        now,
 				Fields: map[string]interface{}{
-					"count":           m.Count(),
-					"min":             m.Min(),
-					"max":             m.Max(),
-					"mean":            m.Mean(),
-					"sum":             m.Sum(),
-					"variance":        m.Variance(),
-					"stddev":          m.StdDev(),
+					"count":           metric.Count(),
+					"min":             metric.Min(),
+					"max":             metric.Max(),
+					"mean":            metric.Mean(),
+					"sum":             metric.Sum(),
+					"variance":        metric.Variance(),
+					"stddev":          metric.StdDev(),
 					"median":          ps[0],
 					"percentile.75":   ps[1],
 					"percentile.95":   ps[2],
@@ -57,67 +57,66 @@ func influxdb(c *Config) {
 
 	api := c.Client.WriteAPIBlocking(c.Org, c.Bucket)
 	now := time.Now().UTC()
-	c.Registry.Each(func(name string, i interface{}) {
+	c.Registry.Snapshot().Each(func(name string, i interface{}) {
 		name = prefix + name
+		tags := metrics.MetricLabels(i)
 		switch metric := i.(type) {
 		case metrics.Counter:
-			m := metric.Snapshot()
-			p := influx.NewPoint(name, nil,
-				map[string]interface{}{"count": m.Count()}, now)
+			p := influx.NewPoint(name, tags,
+				map[string]interface{}{"count": metric.Count()}, now)
 			api.WritePoint(context.Background(), p)
 		case metrics.Gauge:
-			m := metric.Snapshot()
-			p := influx.NewPoint(name, nil,
-				map[string]interface{}{"gauge": m.Value()}, now)
+			p := influx.NewPoint(name, tags,
+				map[string]interface{}{"gauge": metric.Value()}, now)
 			api.WritePoint(context.Background(), p)
 		case metrics.GaugeFloat64:
-			m := metric.Snapshot()
-			p := influx.NewPoint(name, nil,
-				map[string]interface{}{"gauge": m.Value()}, now)
+			p := influx.NewPoint(name, tags,
+				map[string]interface{}{"gauge": metric.Value()}, now)
+			api.WritePoint(context.Background(), p)
+		case metrics.Info:
+			p := influx.NewPoint(name, tags,
+				map[string]interface{}{"value": metric.Value()}, now)
 			api.WritePoint(context.Background(), p)
 		case metrics.Meter:
-			m := metric.Snapshot()
-			p := influx.NewPoint(name, nil, map[string]interface{}{
-				"count":      m.Count(),
-				"rate.1min":  m.Rate1(),
-				"rate.5min":  m.Rate5(),
-				"rate.15min": m.Rate15(),
-				"rate.mean":  m.RateMean(),
+			p := influx.NewPoint(name, tags, map[string]interface{}{
+				"count":      metric.Count(),
+				"rate.1min":  metric.Rate1(),
+				"rate.5min":  metric.Rate5(),
+				"rate.15min": metric.Rate15(),
+				"rate.mean":  metric.RateMean(),
 			}, now)
 			api.WritePoint(context.Background(), p)
 		case metrics.Timer:
-			m := metric.Snapshot()
-			ps := m.Percentiles([]float64{0.5, 0.75, 0.95, 0.99, 0.999})
-			p := influx.NewPoint(name, nil, map[string]interface{}{
-				"count":           m.Count(),
-				"min":             m.Min(),
-				"max":             m.Max(),
-				"mean":            m.Mean(),
-				"sum":             m.Sum(),
-				"variance":        m.Variance(),
-				"stddev":          m.StdDev(),
+			ps := metric.Percentiles([]float64{0.5, 0.75, 0.95, 0.99, 0.999})
+			p := influx.NewPoint(name, tags, map[string]interface{}{
+				"count":           metric.Count(),
+				"min":             metric.Min(),
+				"max":             metric.Max(),
+				"mean":            metric.Mean(),
+				"sum":             metric.Sum(),
+				"variance":        metric.Variance(),
+				"stddev":          metric.StdDev(),
 				"median":          ps[0],
 				"percentile.75":   ps[1],
 				"percentile.95":   ps[2],
 				"percentile.99.0": ps[3],
 				"percentile.99.9": ps[4],
-				"rate.1min":       m.Rate1(),
-				"rate.5min":       m.Rate5(),
-				"rate.15min":      m.Rate15(),
-				"rate.mean":       m.RateMean(),
+				"rate.1min":       metric.Rate1(),
+				"rate.5min":       metric.Rate5(),
+				"rate.15min":      metric.Rate15(),
+				"rate.mean":       metric.RateMean(),
 			}, now)
 			api.WritePoint(context.Background(), p)
 		case metrics.Histogram:
-			m := metric.Snapshot()
-			ps := m.Percentiles([]float64{0.5, 0.75, 0.95, 0.99, 0.999})
-			p := influx.NewPoint(name, nil, map[string]interface{}{
-				"count":           m.Count(),
-				"min":             m.Min(),
-				"max":             m.Max(),
-				"mean":            m.Mean(),
-				"sum":             m.Sum(),
-				"variance":        m.Variance(),
-				"stddev":          m.StdDev(),
+			ps := metric.Percentiles([]float64{0.5, 0.75, 0.95, 0.99, 0.999})
+			p := influx.NewPoint(name, tags, map[string]interface{}{
+				"count":           metric.Count(),
+				"min":             metric.Min(),
+				"max":             metric.Max(),
+				"mean":            metric.Mean(),
+				"sum":             metric.Sum(),
+				"variance":        metric.Variance(),
+				"stddev":          metric.StdDev(),
 				"median":          ps[0],
 				"percentile.75":   ps[1],
 				"percentile.95":   ps[2],
@@ -0,0 +1,142 @@
+package metrics
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"time"
+)
+
+// Time at which the package was initialized.
+var initTime = time.Now()
+
+// Returns the start time of the process read from <root>/self/stat by the
+// process collector's parser. Where the proc filesystem is unavailable, i.e
+// on other operating systems, it falls back to the time at which the package
+// was initialized, which is later than the actual start of the process.
+func processStartTime(root string) time.Time {
+	var stats ProcessStats
+	if err := readProcessStat(root, filepath.Join(root, "self"), &stats); err != nil {
+		return initTime
+	}
+	return time.Unix(stats.StartTime, 0)
+}
+
+// Info is a constant metric whose value is always 1 and whose labels describe
+// the process, i.e its version, following the Prometheus "_info" convention.
+// Exporters which support labels or tags attach them to the exported value.
+type Info interface {
+	Labels() map[string]string
+	Snapshot() Info
+	Value() int64
+}
+
+// GetOrRegisterInfo returns an existing Info or constructs and registers a
+// new StandardInfo with the given labels.
+func GetOrRegisterInfo(name string, r Registry, labels map[string]string) Info {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	return r.GetOrRegister(name, func() Info { return NewInfo(labels) }).(Info)
+}
+
+// NewInfo constructs a new StandardInfo with a copy of labels.
+func NewInfo(labels map[string]string) Info {
+	if UseNilMetrics {
+		return NilInfo{}
+	}
+	info := &StandardInfo{labels: make(map[string]string, len(labels))}
+	for k, v := range labels {
+		info.labels[k] = v
+	}
+	return info
+}
+
+// NewRegisteredInfo constructs and registers a new StandardInfo.
+func NewRegisteredInfo(name string, r Registry, labels map[string]string) Info {
+	c := NewInfo(labels)
+	if nil == r {
+		r = DefaultRegistry
+	}
+	r.Register(name, c)
+	return c
+}
+
+// NilInfo is a no-op Info.
+type NilInfo struct{}
+
+// Labels is a no-op.
+func (NilInfo) Labels() map[string]string { return nil }
+
+// Snapshot is a no-op.
+func (NilInfo) Snapshot() Info { return NilInfo{} }
+
+// Value is a no-op.
+func (NilInfo) Value() int64 { return 0 }
+
+// StandardInfo is the standard implementation of an Info. Its labels cannot
+// be changed after construction, so it is its own snapshot.
+type StandardInfo struct {
+	labels map[string]string
+}
+
+// Labels returns a copy of the info's labels.
+func (i *StandardInfo) Labels() map[string]string {
+	labels := make(map[string]string, len(i.labels))
+	for k, v := range i.labels {
+		labels[k] = v
+	}
+	return labels
+}
+
+// Snapshot returns the info itself.
+func (i *StandardInfo) Snapshot() Info { return i }
+
+// Value returns 1.
+func (i *StandardInfo) Value() int64 { return 1 }
+
+// BuildInfoLabels returns the labels of the Info registered by
+// RegisterBuildInfo: go_version, path, version, revision and modified from
+// runtime/debug.ReadBuildInfo, and start_time (in seconds since the epoch)
+// and hostname of the process. The start time is read from /proc/self/stat,
+// or is the time at which this package was initialized if that is
+// unavailable. Labels that are unavailable, i.e the VCS revision of binaries
+// built without module support, are omitted.
+func BuildInfoLabels() map[string]string {
+	labels := map[string]string{
+		"go_version": runtime.Version(),
+		"start_time": strconv.FormatInt(processStartTime(DefaultProcRoot).Unix(), 10),
+	}
+	if host, err := os.Hostname(); err == nil {
+		labels["hostname"] = host
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return labels
+	}
+	labels["path"] = info.Main.Path
+	labels["version"] = info.Main.Version
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			labels["revision"] = s.Value
+		case "vcs.modified":
+			labels["modified"] = s.Value
+		}
+	}
+	for k, v := range labels {
+		if v == "" {
+			delete(labels, k)
+		}
+	}
+	return labels
+}
+
+// RegisterBuildInfo registers an Info named "build" with the labels returned
+// by BuildInfoLabels in r, so that metrics can be correlated with
+// deployments. The Prometheus exporter publishes it as build_info.
+func RegisterBuildInfo(r Registry) Info {
+	return GetOrRegisterInfo("build", r, BuildInfoLabels())
+}
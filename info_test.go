@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestInfo(t *testing.T) {
+	labels := map[string]string{"version": "v1.2.3"}
+	i := NewInfo(labels)
+	labels["version"] = "changed"
+	if v := i.Value(); v != 1 {
+		t.Errorf("i.Value(): 1 != %v\n", v)
+	}
+	if v := i.Snapshot().Labels()["version"]; v != "v1.2.3" {
+		t.Errorf("i.Labels()[\"version\"]: v1.2.3 != %s\n", v)
+	}
+	i.Labels()["version"] = "changed"
+	if v := i.Labels()["version"]; v != "v1.2.3" {
+		t.Errorf("i.Labels() is not a copy: %s\n", v)
+	}
+}
+
+func TestGetOrRegisterInfo(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredInfo("foo", r, map[string]string{"a": "1"})
+	if i := GetOrRegisterInfo("foo", r, nil); i.Labels()["a"] != "1" {
+		t.Fatal(i)
+	}
+	values := r.GetAll()["foo"]
+	if values["value"] != int64(1) {
+		t.Errorf("GetAll(): value: 1 != %v\n", values["value"])
+	}
+	if labels, ok := values["labels"].(map[string]string); !ok || labels["a"] != "1" {
+		t.Errorf("GetAll(): labels: %v\n", values["labels"])
+	}
+}
+
+func TestRegisterBuildInfo(t *testing.T) {
+	r := NewRegistry()
+	labels := RegisterBuildInfo(r).Labels()
+	if labels["go_version"] != runtime.Version() {
+		t.Errorf("go_version: %s != %s\n", labels["go_version"], runtime.Version())
+	}
+	if labels["start_time"] == "" {
+		t.Error("start_time: missing")
+	}
+	if _, ok := r.Get("build").(Info); !ok {
+		t.Error("build: not registered")
+	}
+}
+
+func TestProcessStartTime(t *testing.T) {
+	if v := processStartTime("testdata/proc").Unix(); v != 1700000005 {
+		t.Errorf("processStartTime(): 1700000005 != %d\n", v)
+	}
+	if v := processStartTime("testdata/missing"); !v.Equal(initTime) {
+		t.Errorf("processStartTime(): %v != %v\n", v, initTime)
+	}
+}
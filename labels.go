@@ -0,0 +1,146 @@
+package metrics
+
+// WithLabels returns a metric which behaves like i but also carries the given
+// labels, which exporters that support them attach to its values, i.e as
+// Prometheus labels or InfluxDB tags. The labels of an Info are merged with
+// the given ones. Values which are not metrics are returned as is.
+func WithLabels(i interface{}, labels map[string]string) interface{} {
+	if len(labels) == 0 {
+		return i
+	}
+	switch metric := i.(type) {
+	case Counter:
+		return labeledCounter{metric, labels}
+	case Gauge:
+		return labeledGauge{metric, labels}
+	case GaugeFloat64:
+		return labeledGaugeFloat64{metric, labels}
+	case Healthcheck:
+		return labeledHealthcheck{metric, labels}
+	case Histogram:
+		return labeledHistogram{metric, labels}
+	case Info:
+		return NewInfo(mergeLabels(metric.Labels(), labels))
+	case Meter:
+		return labeledMeter{metric, labels}
+	case Timer:
+		return labeledTimer{metric, labels}
+	}
+	return i
+}
+
+// MetricLabels returns the labels of a metric: those of an Info, or those
+// attached with WithLabels. Returns nil for metrics without labels.
+func MetricLabels(i interface{}) map[string]string {
+	if l, ok := i.(interface{ Labels() map[string]string }); ok {
+		return l.Labels()
+	}
+	return nil
+}
+
+// Returns the metric to which WithLabels attached labels, or i if it has none.
+func unlabeled(i interface{}) interface{} {
+	if l, ok := i.(interface{ unlabeled() interface{} }); ok {
+		return l.unlabeled()
+	}
+	return i
+}
+
+// Returns the union of a and b, preferring the values of b.
+func mergeLabels(a, b map[string]string) map[string]string {
+	labels := make(map[string]string, len(a)+len(b))
+	for k, v := range a {
+		labels[k] = v
+	}
+	for k, v := range b {
+		labels[k] = v
+	}
+	return labels
+}
+
+type labeledCounter struct {
+	Counter
+	labels map[string]string
+}
+
+func (c labeledCounter) Labels() map[string]string { return c.labels }
+
+func (c labeledCounter) unlabeled() interface{} { return c.Counter }
+
+func (c labeledCounter) Snapshot() Counter {
+	return labeledCounter{c.Counter.Snapshot(), c.labels}
+}
+
+type labeledGauge struct {
+	Gauge
+	labels map[string]string
+}
+
+func (g labeledGauge) Labels() map[string]string { return g.labels }
+
+func (g labeledGauge) unlabeled() interface{} { return g.Gauge }
+
+func (g labeledGauge) Snapshot() Gauge {
+	return labeledGauge{g.Gauge.Snapshot(), g.labels}
+}
+
+type labeledGaugeFloat64 struct {
+	GaugeFloat64
+	labels map[string]string
+}
+
+func (g labeledGaugeFloat64) Labels() map[string]string { return g.labels }
+
+func (g labeledGaugeFloat64) unlabeled() interface{} { return g.GaugeFloat64 }
+
+func (g labeledGaugeFloat64) Snapshot() GaugeFloat64 {
+	return labeledGaugeFloat64{g.GaugeFloat64.Snapshot(), g.labels}
+}
+
+type labeledHealthcheck struct {
+	Healthcheck
+	labels map[string]string
+}
+
+func (h labeledHealthcheck) Labels() map[string]string { return h.labels }
+
+func (h labeledHealthcheck) unlabeled() interface{} { return h.Healthcheck }
+
+type labeledHistogram struct {
+	Histogram
+	labels map[string]string
+}
+
+func (h labeledHistogram) Labels() map[string]string { return h.labels }
+
+func (h labeledHistogram) unlabeled() interface{} { return h.Histogram }
+
+func (h labeledHistogram) Snapshot() Histogram {
+	return labeledHistogram{h.Histogram.Snapshot(), h.labels}
+}
+
+type labeledMeter struct {
+	Meter
+	labels map[string]string
+}
+
+func (m labeledMeter) Labels() map[string]string { return m.labels }
+
+func (m labeledMeter) unlabeled() interface{} { return m.Meter }
+
+func (m labeledMeter) Snapshot() Meter {
+	return labeledMeter{m.Meter.Snapshot(), m.labels}
+}
+
+type labeledTimer struct {
+	Timer
+	labels map[string]string
+}
+
+func (t labeledTimer) Labels() map[string]string { return t.labels }
+
+func (t labeledTimer) unlabeled() interface{} { return t.Timer }
+
+func (t labeledTimer) Snapshot() Timer {
+	return labeledTimer{t.Timer.Snapshot(), t.labels}
+}
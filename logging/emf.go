@@ -0,0 +1,265 @@
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/zeim839/go-metrics-plus"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// EMFMaxMetrics is the maximum number of metrics that CloudWatch accepts in a
+// single Embedded Metric Format document.
+const EMFMaxMetrics = 100
+
+// DefaultEMFNamespace is the CloudWatch namespace used when none is given.
+const DefaultEMFNamespace = "go-metrics-plus"
+
+// EMFConfig provides a container with configuration parameters for the
+// CloudWatch Embedded Metric Format (EMF) writer.
+type EMFConfig struct {
+	Writer       io.Writer         // Destination, defaults to os.Stdout.
+	Registry     metrics.Registry  // Registry to be exported.
+	DurationUnit time.Duration     // Second, Millisecond or Microsecond.
+	Namespace    string            // CloudWatch namespace.
+	Dimensions   map[string]string // Dimensions attached to every metric.
+	Prefix       string            // Prefix to be prepended to metric names.
+}
+
+// EMFOnce writes every metric in the registry as CloudWatch EMF documents,
+// one JSON document per line, i.e from a metrics.CollectorFunc run by a
+// metrics.Scheduler. The labels of a metric, i.e those of an Info,
+// are added to its dimensions, so metrics are grouped into one document per
+// set of dimensions, and batched so that no document exceeds EMFMaxMetrics
+// metrics. Metrics named like one of their dimensions are not written, and
+// are reported in the returned error.
+func EMFOnce(c EMFConfig) error {
+	if c.Writer == nil {
+		c.Writer = os.Stdout
+	}
+	if c.Registry == nil {
+		c.Registry = metrics.DefaultRegistry
+	}
+	groups := map[string]*emfGroup{}
+	c.Registry.Snapshot().Each(func(name string, i interface{}) {
+		dims := c.Dimensions
+		if labels := metrics.MetricLabels(i); len(labels) > 0 {
+			dims = make(map[string]string, len(c.Dimensions)+len(labels))
+			for k, v := range c.Dimensions {
+				dims[k] = v
+			}
+			for k, v := range labels {
+				dims[k] = v
+			}
+		}
+		key := emfGroupKey(dims)
+		g, ok := groups[key]
+		if !ok {
+			g = &emfGroup{dims: dims}
+			groups[key] = g
+		}
+		g.values = append(g.values, emfValues(name, c.Prefix, c.DurationUnit, i)...)
+	})
+	keys := make([]string, 0, len(groups))
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	ts := time.Now().UnixMilli()
+	enc := json.NewEncoder(c.Writer)
+	var rejected []string
+	for _, key := range keys {
+		g := groups[key]
+		values := g.accepted(&rejected)
+		sort.Slice(values, func(i, j int) bool {
+			return values[i].name < values[j].name
+		})
+		for len(values) > 0 {
+			n := EMFMaxMetrics
+			if n > len(values) {
+				n = len(values)
+			}
+			doc := emfDocument(ts, c.Namespace, g.dims, values[:n])
+			if err := enc.Encode(doc); err != nil {
+				return err
+			}
+			values = values[n:]
+		}
+	}
+	if len(rejected) > 0 {
+		return fmt.Errorf("emf: metrics named like a dimension: %s",
+			strings.Join(rejected, ", "))
+	}
+	return nil
+}
+
+// EncodeEMF encodes a metric into a single CloudWatch EMF document under the
+// DefaultEMFNamespace, with the labels of the metric as its dimensions.
+// Durations are reported in milliseconds. Healthchecks, and metrics named like
+// one of their labels, are not supported.
+func EncodeEMF(w io.Writer, name, prefix string, i interface{}) {
+	g := emfGroup{
+		dims:   metrics.MetricLabels(i),
+		values: emfValues(name, prefix, time.Millisecond, i),
+	}
+	var rejected []string
+	values := g.accepted(&rejected)
+	if len(values) == 0 {
+		return
+	}
+	doc := emfDocument(time.Now().UnixMilli(), DefaultEMFNamespace, g.dims,
+		values)
+	json.NewEncoder(w).Encode(doc)
+}
+
+type emfValue struct {
+	name  string
+	unit  string
+	value interface{}
+}
+
+// The values of the metrics which share a set of dimensions.
+type emfGroup struct {
+	dims   map[string]string
+	values []emfValue
+}
+
+// Returns the values of g which are not named like a dimension, since both
+// are members of the document, and appends the names of the others to
+// rejected.
+func (g *emfGroup) accepted(rejected *[]string) []emfValue {
+	values := g.values[:0:0]
+	for _, v := range g.values {
+		if _, ok := g.dims[v.name]; ok {
+			*rejected = append(*rejected, v.name)
+			continue
+		}
+		values = append(values, v)
+	}
+	return values
+}
+
+// Returns a key which identifies a set of dimensions.
+func emfGroupKey(dims map[string]string) string {
+	var key strings.Builder
+	for _, k := range sortedKeys(dims) {
+		key.WriteString(k + "\x00" + dims[k] + "\x00")
+	}
+	return key.String()
+}
+
+// Builds a single EMF document, values must not exceed EMFMaxMetrics.
+func emfDocument(ts int64, namespace string, dims map[string]string,
+	values []emfValue) map[string]interface{} {
+	if namespace == "" {
+		namespace = DefaultEMFNamespace
+	}
+	doc := make(map[string]interface{}, len(values)+len(dims)+1)
+	dimKeys := make([]string, 0, len(dims))
+	for k, v := range dims {
+		dimKeys = append(dimKeys, k)
+		doc[k] = v
+	}
+	sort.Strings(dimKeys)
+
+	defs := make([]map[string]string, len(values))
+	for i, v := range values {
+		defs[i] = map[string]string{"Name": v.name, "Unit": v.unit}
+		doc[v.name] = v.value
+	}
+	doc["_aws"] = map[string]interface{}{
+		"Timestamp": ts,
+		"CloudWatchMetrics": []map[string]interface{}{{
+			"Namespace":  namespace,
+			"Dimensions": [][]string{dimKeys},
+			"Metrics":    defs,
+		}},
+	}
+	return doc
+}
+
+// Returns the CloudWatch unit for the given duration unit.
+func emfDurationUnit(d time.Duration) (time.Duration, string) {
+	switch d {
+	case time.Second:
+		return d, "Seconds"
+	case time.Microsecond:
+		return d, "Microseconds"
+	}
+	return time.Millisecond, "Milliseconds"
+}
+
+// Expands a metric into named EMF values, following the same naming scheme as
+// EncodeGraphite.
+func emfValues(name, prefix string, du time.Duration,
+	i interface{}) []emfValue {
+	if prefix != "" {
+		prefix = prefix + "."
+	}
+	head := prefix + name
+	du, unit := emfDurationUnit(du)
+	d := func(v float64) float64 { return v / float64(du) }
+
+	switch metric := i.(type) {
+	case metrics.Counter:
+		return []emfValue{{head, "Count", metric.Count()}}
+	case metrics.Gauge:
+		return []emfValue{{head, "None", metric.Value()}}
+	case metrics.GaugeFloat64:
+		return []emfValue{{head, "None", metric.Value()}}
+	case metrics.Info:
+		return []emfValue{{head, "None", metric.Value()}}
+	case metrics.Meter:
+		m := metric.Snapshot()
+		return []emfValue{
+			{head + ".count", "Count", m.Count()},
+			{head + ".rate.1min", "Count/Second", m.Rate1()},
+			{head + ".rate.5min", "Count/Second", m.Rate5()},
+			{head + ".rate.15min", "Count/Second", m.Rate15()},
+			{head + ".rate.mean", "Count/Second", m.RateMean()},
+		}
+	case metrics.Timer:
+		t := metric.Snapshot()
+		ps := t.Percentiles([]float64{0.5, 0.75, 0.95, 0.99, 0.999})
+		return []emfValue{
+			{head + ".count", "Count", t.Count()},
+			{head + ".min", unit, d(float64(t.Min()))},
+			{head + ".max", unit, d(float64(t.Max()))},
+			{head + ".mean", unit, d(t.Mean())},
+			{head + ".sum", unit, d(float64(t.Sum()))},
+			{head + ".stddev", unit, d(t.StdDev())},
+			{head + ".variance", "None", d(d(t.Variance()))},
+			{head + ".median", unit, d(ps[0])},
+			{head + ".percentile.75", unit, d(ps[1])},
+			{head + ".percentile.95", unit, d(ps[2])},
+			{head + ".percentile.99.0", unit, d(ps[3])},
+			{head + ".percentile.99.9", unit, d(ps[4])},
+			{head + ".rate.1min", "Count/Second", t.Rate1()},
+			{head + ".rate.5min", "Count/Second", t.Rate5()},
+			{head + ".rate.15min", "Count/Second", t.Rate15()},
+			{head + ".rate.mean", "Count/Second", t.RateMean()},
+		}
+	case metrics.Histogram:
+		h := metric.Snapshot()
+		ps := h.Percentiles([]float64{0.5, 0.75, 0.95, 0.99, 0.999})
+		return []emfValue{
+			{head + ".count", "Count", h.Count()},
+			{head + ".min", "None", h.Min()},
+			{head + ".max", "None", h.Max()},
+			{head + ".mean", "None", h.Mean()},
+			{head + ".sum", "None", h.Sum()},
+			{head + ".stddev", "None", h.StdDev()},
+			{head + ".variance", "None", h.Variance()},
+			{head + ".median", "None", ps[0]},
+			{head + ".percentile.75", "None", ps[1]},
+			{head + ".percentile.95", "None", ps[2]},
+			{head + ".percentile.99.0", "None", ps[3]},
+			{head + ".percentile.99.9", "None", ps[4]},
+		}
+	}
+	return nil
+}
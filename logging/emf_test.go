@@ -0,0 +1,184 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/zeim839/go-metrics-plus"
+	"testing"
+	"time"
+)
+
+type emfTestDocument struct {
+	AWS struct {
+		Timestamp         int64
+		CloudWatchMetrics []struct {
+			Namespace  string
+			Dimensions [][]string
+			Metrics    []struct{ Name, Unit string }
+		}
+	} `json:"_aws"`
+}
+
+func TestEMFOnce(t *testing.T) {
+	r := metrics.NewRegistry()
+	metrics.GetOrRegisterCounter("foo", r).Inc(3)
+	metrics.GetOrRegisterTimer("bar", r).Update(2 * time.Second)
+
+	buf := new(bytes.Buffer)
+	err := EMFOnce(EMFConfig{
+		Writer:       buf,
+		Registry:     r,
+		DurationUnit: time.Millisecond,
+		Namespace:    "svc",
+		Dimensions:   map[string]string{"Service": "api"},
+	})
+	if err != nil {
+		t.Fatalf("EMFOnce(): %s", err)
+	}
+
+	var raw map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &raw); err != nil {
+		t.Fatalf("EMFOnce(): invalid document: %s", err)
+	}
+	var doc emfTestDocument
+	json.Unmarshal(buf.Bytes(), &doc)
+
+	if len(doc.AWS.CloudWatchMetrics) != 1 {
+		t.Fatalf("expected 1 metric directive, got %d",
+			len(doc.AWS.CloudWatchMetrics))
+	}
+	dir := doc.AWS.CloudWatchMetrics[0]
+	if dir.Namespace != "svc" {
+		t.Errorf("%s != svc", dir.Namespace)
+	}
+	if fmt.Sprint(dir.Dimensions) != "[[Service]]" {
+		t.Errorf("unexpected dimensions %v", dir.Dimensions)
+	}
+	if raw["Service"] != "api" {
+		t.Errorf("%v != api", raw["Service"])
+	}
+	if raw["foo"] != 3.0 {
+		t.Errorf("foo: %v != 3", raw["foo"])
+	}
+	if raw["bar.max"] != 2000.0 {
+		t.Errorf("bar.max: %v != 2000", raw["bar.max"])
+	}
+	units := map[string]string{}
+	for _, m := range dir.Metrics {
+		units[m.Name] = m.Unit
+	}
+	if units["foo"] != "Count" || units["bar.max"] != "Milliseconds" ||
+		units["bar.rate.1min"] != "Count/Second" || units["bar.variance"] != "None" {
+		t.Errorf("unexpected units %v", units)
+	}
+}
+
+func TestEMFBatching(t *testing.T) {
+	r := metrics.NewRegistry()
+	for i := 0; i < 2*EMFMaxMetrics+1; i++ {
+		metrics.GetOrRegisterGauge(fmt.Sprintf("g%03d", i), r).Update(1)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := EMFOnce(EMFConfig{Writer: buf, Registry: r}); err != nil {
+		t.Fatalf("EMFOnce(): %s", err)
+	}
+
+	dec := json.NewDecoder(buf)
+	sizes := []int{}
+	for dec.More() {
+		var doc emfTestDocument
+		if err := dec.Decode(&doc); err != nil {
+			t.Fatal(err)
+		}
+		sizes = append(sizes, len(doc.AWS.CloudWatchMetrics[0].Metrics))
+	}
+	if fmt.Sprint(sizes) != "[100 100 1]" {
+		t.Errorf("unexpected document sizes %v", sizes)
+	}
+}
+
+func TestEncodeEMF(t *testing.T) {
+	buf := new(bytes.Buffer)
+	EncodeEMF(buf, "foo", "bar", metrics.NewHealthcheck(nil))
+	if buf.Len() != 0 {
+		t.Errorf("EncodeEMF(): encoded healthcheck %s", buf.String())
+	}
+
+	meter := metrics.NewMeter()
+	meter.Mark(1)
+	EncodeEMF(buf, "foo", "bar", meter)
+	var raw map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &raw); err != nil {
+		t.Fatalf("EncodeEMF(): invalid document: %s", err)
+	}
+	if raw["bar.foo.count"] != 1.0 {
+		t.Errorf("bar.foo.count: %v != 1", raw["bar.foo.count"])
+	}
+}
+
+func TestEncodeEMFTimer(t *testing.T) {
+	timer := metrics.NewTimer()
+	timer.Update(time.Millisecond)
+	timer.Update(3 * time.Millisecond)
+	buf := new(bytes.Buffer)
+	EncodeEMF(buf, "foo", "", timer)
+	var raw map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &raw); err != nil {
+		t.Fatalf("EncodeEMF(): invalid document: %s", err)
+	}
+	if raw["foo.variance"] != 1.0 {
+		t.Errorf("foo.variance: %v != 1", raw["foo.variance"])
+	}
+}
+
+func TestEncodeEMFInfo(t *testing.T) {
+	buf := new(bytes.Buffer)
+	EncodeEMF(buf, "build_info", "", metrics.NewInfo(map[string]string{"version": "v1", "host": "a"}))
+	var raw map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &raw); err != nil {
+		t.Fatalf("EncodeEMF(): invalid document: %s", err)
+	}
+	var doc emfTestDocument
+	json.Unmarshal(buf.Bytes(), &doc)
+	if raw["build_info"] != 1.0 || raw["host"] != "a" || raw["version"] != "v1" ||
+		fmt.Sprint(doc.AWS.CloudWatchMetrics[0].Dimensions) != "[[host version]]" {
+		t.Errorf("EncodeEMF(): %s", buf.String())
+	}
+}
+
+func TestEMFOnceLabels(t *testing.T) {
+	r := metrics.NewRegistry()
+	metrics.GetOrRegisterCounter("foo", r).Inc(1)
+	metrics.NewRegisteredInfo("build", r, map[string]string{"version": "v1"})
+	metrics.GetOrRegisterGauge("Service", r).Update(2)
+
+	buf := new(bytes.Buffer)
+	err := EMFOnce(EMFConfig{
+		Writer:     buf,
+		Registry:   r,
+		Dimensions: map[string]string{"Service": "api"},
+	})
+	if err == nil || err.Error() != "emf: metrics named like a dimension: Service" {
+		t.Errorf("EMFOnce(): %v", err)
+	}
+	dec := json.NewDecoder(buf)
+	var docs []map[string]interface{}
+	for dec.More() {
+		var raw map[string]interface{}
+		if err := dec.Decode(&raw); err != nil {
+			t.Fatal(err)
+		}
+		docs = append(docs, raw)
+	}
+	if len(docs) != 2 {
+		t.Fatalf("EMFOnce(): %d documents != 2", len(docs))
+	}
+	if docs[0]["foo"] != 1.0 || docs[0]["Service"] != "api" {
+		t.Errorf("EMFOnce(): %v", docs[0])
+	}
+	if docs[1]["build"] != 1.0 || docs[1]["version"] != "v1" || docs[1]["Service"] != "api" {
+		t.Errorf("EMFOnce(): %v", docs[1])
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"github.com/zeim839/go-metrics-plus"
 	"io"
+	"sort"
+	"strings"
 	"time"
 )
 
@@ -11,7 +13,8 @@ import (
 type Encoder func(w io.Writer, name string, prefix string, i interface{})
 
 // Encode encodes a metric into prometheus expositional format. Some interfaces
-// are encoded as multi-line summaries. Healthchecks are not supported.
+// are encoded as multi-line summaries and Infos are encoded with their labels.
+// Healthchecks are not supported.
 func Encode(w io.Writer, name, prefix string, i interface{}) {
 	if prefix != "" {
 		prefix = prefix + "_"
@@ -26,6 +29,14 @@ func Encode(w io.Writer, name, prefix string, i interface{}) {
 		fmt.Fprintf(w, "%s %d %v\n", head, metric.Value(), ts)
 	case metrics.GaugeFloat64:
 		fmt.Fprintf(w, "%s %f %v\n", head, metric.Value(), ts)
+	case metrics.Info:
+		labels := metric.Labels()
+		pairs := make([]string, 0, len(labels))
+		for _, k := range sortedKeys(labels) {
+			pairs = append(pairs, fmt.Sprintf("%s=%q", k, labels[k]))
+		}
+		fmt.Fprintf(w, "%s_info{%s} %d %v\n", head, strings.Join(pairs, ","),
+			metric.Value(), ts)
 	case metrics.Meter:
 		m := metric.Snapshot()
 		fmt.Fprintf(w, "%s_count %d %v\n", head, m.Count(), ts)
@@ -69,3 +80,13 @@ func Encode(w io.Writer, name, prefix string, i interface{}) {
 		fmt.Fprintf(w, "%s_percentile_99_9 %f %v\n", head, ps[4], ts)
 	}
 }
+
+// Returns the keys of labels in ascending order.
+func sortedKeys(labels map[string]string) []string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
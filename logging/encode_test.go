@@ -605,3 +605,20 @@ func TestEncodeUnknown(t *testing.T) {
 		t.Errorf("Encode(): Unknown struct returned non-empty string: %s", str)
 	}
 }
+
+func TestEncodeInfo(t *testing.T) {
+	info := metrics.NewInfo(map[string]string{"version": "v1", "host": "a"})
+	buf := new(bytes.Buffer)
+	Encode(buf, "build", "bar", info)
+	expect := `bar_build_info{host="a",version="v1"} 1`
+	if str := buf.String(); str[:len(str)-12] != expect {
+		t.Errorf("Encode(): %s != %s", str[:len(str)-12], expect)
+	}
+
+	buf = new(bytes.Buffer)
+	EncodeGraphite(buf, "build", "bar", info)
+	expect = "bar.build;host=a;version=v1 1"
+	if str := buf.String(); str[:len(str)-12] != expect {
+		t.Errorf("EncodeGraphite(): %s != %s", str[:len(str)-12], expect)
+	}
+}
@@ -8,7 +8,8 @@ import (
 )
 
 // EncodeGraphite encodes a metric into graphite format. Some interfaces
-// are encoded as multi-line summaries. Healthchecks are not supported.
+// are encoded as multi-line summaries and Infos are encoded with their labels.
+// Healthchecks are not supported.
 func EncodeGraphite(w io.Writer, name, prefix string, i interface{}) {
 	if prefix != "" {
 		prefix = prefix + "."
@@ -23,6 +24,14 @@ func EncodeGraphite(w io.Writer, name, prefix string, i interface{}) {
 		fmt.Fprintf(w, "%s %d %d\n", head, metric.Value(), ts)
 	case metrics.GaugeFloat64:
 		fmt.Fprintf(w, "%s %f %d\n", head, metric.Value(), ts)
+	case metrics.Info:
+		// Encoded as a tagged series, supported since Graphite 1.1.
+		labels := metric.Labels()
+		tags := ""
+		for _, k := range sortedKeys(labels) {
+			tags += ";" + k + "=" + labels[k]
+		}
+		fmt.Fprintf(w, "%s%s %d %d\n", head, tags, metric.Value(), ts)
 	case metrics.Meter:
 		m := metric.Snapshot()
 		fmt.Fprintf(w, "%s.count %d %d\n", head, m.Count(), ts)
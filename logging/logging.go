@@ -11,7 +11,7 @@ import (
 // metric names with prefix.
 func Logger(f Encoder, r metrics.Registry, d time.Duration, prefix string) {
 	for range time.Tick(d) {
-		r.Each(func(name string, i interface{}) {
+		r.Snapshot().Each(func(name string, i interface{}) {
 			f(os.Stdout, name, prefix, i)
 		})
 	}
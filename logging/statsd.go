@@ -11,6 +11,17 @@ import (
 // are not (natively) supported by Statsd. It is assumed that the sampling rate
 // is the same as the flush rate configured on the Statsd server.
 func EncodeStatsd(w io.Writer, name, prefix string, i interface{}) {
+	EncodeStatsdSnapshot(w, name, prefix, i)
+	if metric, ok := i.(metrics.Counter); ok {
+		metric.Clear()
+	}
+}
+
+// EncodeStatsdSnapshot encodes a metric like EncodeStatsd, but does not clear
+// counters, so that it can encode the metrics of a RegistrySnapshot. Since
+// Statsd counts are deltas, the caller must subtract the encoded counts from
+// the registered counters.
+func EncodeStatsdSnapshot(w io.Writer, name, prefix string, i interface{}) {
 	if prefix != "" {
 		prefix = prefix + "."
 	}
@@ -18,7 +29,6 @@ func EncodeStatsd(w io.Writer, name, prefix string, i interface{}) {
 	switch metric := i.(type) {
 	case metrics.Counter:
 		fmt.Fprintf(w, "%s:%d|c\n", head, metric.Count())
-		metric.Clear()
 	case metrics.Gauge:
 		fmt.Fprintf(w, "%s:%d|g\n", head, metric.Value())
 	case metrics.GaugeFloat64:
@@ -19,7 +19,7 @@ func Write(r metrics.Registry, d time.Duration, w io.Writer) {
 // io.Writer, in the prometheus expositional format.
 func WriteOnce(r metrics.Registry, w io.Writer) {
 	var namedMetrics namedMetricSlice
-	r.Each(func(name string, i interface{}) {
+	r.Snapshot().Each(func(name string, i interface{}) {
 		namedMetrics = append(namedMetrics, namedMetric{name, i})
 	})
 
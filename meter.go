@@ -1,6 +1,7 @@
 package metrics
 
 import (
+	"sync"
 	"sync/atomic"
 	"time"
 )
@@ -103,6 +104,9 @@ func (NilMeter) Snapshot() Meter { return NilMeter{} }
 
 // StandardMeter is the standard implementation of a Meter.
 type StandardMeter struct {
+	// Marks and reads share the mutex, restoring a state holds it alone so
+	// that the count, rates and start time are replaced together.
+	mutex       sync.RWMutex
 	count       atomic.Int64
 	a1, a5, a15 EWMA
 	startTime   time.Time
@@ -124,6 +128,8 @@ func (m *StandardMeter) Count() int64 {
 
 // Mark records the occurance of n events.
 func (m *StandardMeter) Mark(n int64) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
 	m.count.Add(n)
 	m.a1.Update(n)
 	m.a5.Update(n)
@@ -147,6 +153,8 @@ func (m *StandardMeter) Rate15() float64 {
 
 // RateMean returns the meter's mean rate of events per second.
 func (m *StandardMeter) RateMean() float64 {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
 	return float64(m.Count()) / (1 + time.Since(m.startTime).Seconds())
 }
 
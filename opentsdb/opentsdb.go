@@ -0,0 +1,324 @@
+package opentsdb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/zeim839/go-metrics-plus"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Supported OpenTSDB protocols.
+const (
+	Telnet = "telnet" // Newline-delimited put commands over TCP.
+	HTTP   = "http"   // Batched JSON data points posted to /api/put.
+)
+
+// DefaultBatchSize is the number of data points sent per /api/put request
+// when Config.BatchSize is not set.
+const DefaultBatchSize = 50
+
+// Config provides a container with configuration parameters for
+// the OpenTSDB exporter.
+type Config struct {
+	Addr         string            // Network address (i.e localhost:4242) or URL.
+	Protocol     string            // Telnet or HTTP, defaults to Telnet.
+	Registry     metrics.Registry  // Registry to be exported.
+	DurationUnit time.Duration     // Time conversion unit for durations.
+	Prefix       string            // Prefix to be prepended to metric names.
+	Tags         map[string]string // Tags attached to every data point.
+	BatchSize    int               // Data points per HTTP request.
+	Summary      bool              // Request a summary of failed points (HTTP).
+	Details      bool              // Request per-point error details (HTTP).
+	Timeout      time.Duration     // Connection/request timeout.
+}
+
+// DataPoint is a single OpenTSDB measurement.
+type DataPoint struct {
+	Metric    string            `json:"metric"`
+	Timestamp int64             `json:"timestamp"`
+	Value     interface{}       `json:"value"`
+	Tags      map[string]string `json:"tags"`
+}
+
+// PointError describes a data point that was rejected by OpenTSDB.
+type PointError struct {
+	DataPoint DataPoint `json:"datapoint"`
+	Error     string    `json:"error"`
+}
+
+// PutError is returned when OpenTSDB fails to store some of the data points
+// of an /api/put request. Failed and Success are only populated when Summary
+// or Details is set, and Errors is only populated when Details is set.
+type PutError struct {
+	Status  int          `json:"-"`
+	Failed  int          `json:"failed"`
+	Success int          `json:"success"`
+	Errors  []PointError `json:"errors"`
+}
+
+func (err *PutError) Error() string {
+	if len(err.Errors) > 0 {
+		return fmt.Sprintf("opentsdb: %d data points failed (status %d): %s",
+			err.Failed, err.Status, err.Errors[0].Error)
+	}
+	return fmt.Sprintf("opentsdb: %d data points failed (status %d)",
+		err.Failed, err.Status)
+}
+
+// Once performs a single submission to OpenTSDB, returning a non-nil error
+// on failed connections or rejected data points. It can be run periodically
+// from a metrics.CollectorFunc added to a metrics.Scheduler.
+func Once(c Config) error {
+	if err := checkConfig(&c); err != nil {
+		return err
+	}
+	return opentsdb(&c)
+}
+
+// Validates c and fills in defaults.
+func checkConfig(c *Config) error {
+	switch c.Protocol {
+	case "":
+		c.Protocol = Telnet
+	case Telnet, HTTP:
+	default:
+		return fmt.Errorf("unsupported protocol %s", c.Protocol)
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = DefaultBatchSize
+	}
+	if c.Registry == nil {
+		c.Registry = metrics.DefaultRegistry
+	}
+	if c.DurationUnit == 0 {
+		c.DurationUnit = time.Nanosecond
+	}
+	// OpenTSDB rejects data points without at least one tag.
+	if len(c.Tags) == 0 {
+		host, err := os.Hostname()
+		if err != nil {
+			return err
+		}
+		c.Tags = map[string]string{"host": host}
+	}
+	return nil
+}
+
+func opentsdb(c *Config) error {
+	ts := time.Now().Unix()
+	var pts []DataPoint
+	c.Registry.Snapshot().Each(func(name string, i interface{}) {
+		pts = append(pts, DataPoints(name, c.Prefix, i, ts, c.DurationUnit, c.Tags)...)
+	})
+	if c.Protocol == HTTP {
+		return putHTTP(c, pts)
+	}
+	return putTelnet(c, pts)
+}
+
+// Writes data points as put commands over a TCP connection.
+func putTelnet(c *Config, pts []DataPoint) error {
+	conn, err := net.DialTimeout("tcp", c.Addr, c.Timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	w := bufio.NewWriter(conn)
+	for _, p := range pts {
+		if err := WritePut(w, p); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
+
+// Posts data points to /api/put in batches of c.BatchSize.
+func putHTTP(c *Config, pts []DataPoint) error {
+	url := c.Addr
+	if !strings.Contains(url, "://") {
+		url = "http://" + url
+	}
+	url = strings.TrimSuffix(url, "/") + "/api/put"
+	if c.Details {
+		url += "?details"
+	} else if c.Summary {
+		url += "?summary"
+	}
+
+	client := &http.Client{Timeout: c.Timeout}
+	for len(pts) > 0 {
+		n := c.BatchSize
+		if n > len(pts) {
+			n = len(pts)
+		}
+		if err := post(client, url, pts[:n]); err != nil {
+			return err
+		}
+		pts = pts[n:]
+	}
+	return nil
+}
+
+func post(client *http.Client, url string, pts []DataPoint) error {
+	js, err := json.Marshal(pts)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(js))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	// Summary and details responses report failures in the body, which
+	// is returned along with a 200 (or 400 if any point failed).
+	putErr := &PutError{Status: resp.StatusCode}
+	if len(body) > 0 && json.Unmarshal(body, putErr) == nil && putErr.Failed > 0 {
+		return putErr
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unable to post to OpenTSDB: %s %s", resp.Status,
+			string(body))
+	}
+	return nil
+}
+
+// WritePut writes p to w as an OpenTSDB telnet put command.
+func WritePut(w io.Writer, p DataPoint) error {
+	keys := make([]string, 0, len(p.Tags))
+	for k := range p.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var tags strings.Builder
+	for _, k := range keys {
+		fmt.Fprintf(&tags, " %s=%s", sanitize(k), sanitize(p.Tags[k]))
+	}
+	var err error
+	switch v := p.Value.(type) {
+	case float64:
+		_, err = fmt.Fprintf(w, "put %s %d %s%s\n", p.Metric, p.Timestamp,
+			strconv.FormatFloat(v, 'g', -1, 64), tags.String())
+	default:
+		_, err = fmt.Fprintf(w, "put %s %d %v%s\n", p.Metric, p.Timestamp,
+			v, tags.String())
+	}
+	return err
+}
+
+// DataPoints expands a metric into OpenTSDB data points. Metric fields are
+// named following the same scheme as logging.EncodeGraphite, i.e a meter
+// named foo produces foo.count, foo.rate.1min, etc. Durations are divided by
+// du. The labels of the metric, i.e those of an Info, are added to tags, and
+// the tags are sanitized like the metric name. Healthchecks and non-finite
+// GaugeFloat64 values are not supported.
+func DataPoints(name, prefix string, i interface{}, ts int64, du time.Duration,
+	tags map[string]string) []DataPoint {
+	if prefix != "" {
+		prefix = prefix + "."
+	}
+	labels := metrics.MetricLabels(i)
+	sanitized := make(map[string]string, len(tags)+len(labels))
+	for k, v := range tags {
+		sanitized[sanitize(k)] = sanitize(v)
+	}
+	for k, v := range labels {
+		sanitized[sanitize(k)] = sanitize(v)
+	}
+	tags = sanitized
+	d := func(v float64) float64 { return v / float64(du) }
+	head := sanitize(prefix + name)
+	pt := func(suffix string, v interface{}) DataPoint {
+		return DataPoint{Metric: head + suffix, Timestamp: ts, Value: v,
+			Tags: tags}
+	}
+
+	switch metric := i.(type) {
+	case metrics.Counter:
+		return []DataPoint{pt("", metric.Count())}
+	case metrics.Gauge:
+		return []DataPoint{pt("", metric.Value())}
+	case metrics.GaugeFloat64:
+		if v := metric.Value(); !math.IsNaN(v) && !math.IsInf(v, 0) {
+			return []DataPoint{pt("", v)}
+		}
+	case metrics.Info:
+		return []DataPoint{pt("", metric.Value())}
+	case metrics.Meter:
+		m := metric.Snapshot()
+		return []DataPoint{
+			pt(".count", m.Count()),
+			pt(".rate.1min", m.Rate1()),
+			pt(".rate.5min", m.Rate5()),
+			pt(".rate.15min", m.Rate15()),
+			pt(".rate.mean", m.RateMean()),
+		}
+	case metrics.Timer:
+		t := metric.Snapshot()
+		ps := t.Percentiles([]float64{0.5, 0.75, 0.95, 0.99, 0.999})
+		return []DataPoint{
+			pt(".count", t.Count()),
+			pt(".min", d(float64(t.Min()))),
+			pt(".max", d(float64(t.Max()))),
+			pt(".mean", d(t.Mean())),
+			pt(".sum", d(float64(t.Sum()))),
+			pt(".stddev", d(t.StdDev())),
+			pt(".variance", d(d(t.Variance()))),
+			pt(".median", d(ps[0])),
+			pt(".percentile.75", d(ps[1])),
+			pt(".percentile.95", d(ps[2])),
+			pt(".percentile.99.0", d(ps[3])),
+			pt(".percentile.99.9", d(ps[4])),
+			pt(".rate.1min", t.Rate1()),
+			pt(".rate.5min", t.Rate5()),
+			pt(".rate.15min", t.Rate15()),
+			pt(".rate.mean", t.RateMean()),
+		}
+	case metrics.Histogram:
+		h := metric.Snapshot()
+		ps := h.Percentiles([]float64{0.5, 0.75, 0.95, 0.99, 0.999})
+		return []DataPoint{
+			pt(".count", h.Count()),
+			pt(".min", h.Min()),
+			pt(".max", h.Max()),
+			pt(".mean", h.Mean()),
+			pt(".sum", h.Sum()),
+			pt(".stddev", h.StdDev()),
+			pt(".variance", h.Variance()),
+			pt(".median", ps[0]),
+			pt(".percentile.75", ps[1]),
+			pt(".percentile.95", ps[2]),
+			pt(".percentile.99.0", ps[3]),
+			pt(".percentile.99.9", ps[4]),
+		}
+	}
+	return nil
+}
+
+// Replaces characters which OpenTSDB does not accept in metric names and
+// tags with an underscore.
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		case r == '-', r == '_', r == '.', r == '/':
+			return r
+		}
+		return '_'
+	}, s)
+}
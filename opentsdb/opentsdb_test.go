@@ -0,0 +1,203 @@
+package opentsdb
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/zeim839/go-metrics-plus"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func ExampleOnce() {
+	c := Config{
+		Addr:     "localhost:4242",
+		Protocol: HTTP,
+		Registry: metrics.DefaultRegistry,
+		Prefix:   "some.prefix",
+		Tags:     map[string]string{"host": "web01", "dc": "eu"},
+	}
+	s := metrics.NewScheduler()
+	s.Add("opentsdb", time.Second, metrics.CollectorFunc(func(context.Context) error {
+		return Once(c)
+	}))
+	s.Start(context.Background())
+}
+
+func TestTelnet(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("could not start dummy server:", err)
+	}
+	defer ln.Close()
+
+	lines := make(chan []string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			t.Errorf("dummy server error: %s", err)
+			lines <- nil
+			return
+		}
+		defer conn.Close()
+		var res []string
+		s := bufio.NewScanner(conn)
+		for s.Scan() {
+			res = append(res, s.Text())
+		}
+		lines <- res
+	}()
+
+	r := metrics.NewRegistry()
+	metrics.GetOrRegisterCounter("foo", r).Inc(2)
+	metrics.GetOrRegisterMeter("bar", r).Mark(1)
+
+	err = Once(Config{
+		Addr:     ln.Addr().String(),
+		Registry: r,
+		Prefix:   "p",
+		Tags:     map[string]string{"host": "h1", "dc": "eu west"},
+	})
+	if err != nil {
+		t.Fatalf("Once(): %s", err)
+	}
+
+	res := <-lines
+	if len(res) != 6 {
+		t.Fatalf("expected 6 put lines, got %d: %v", len(res), res)
+	}
+	found := map[string]string{}
+	for _, line := range res {
+		parts := strings.Split(line, " ")
+		if parts[0] != "put" || len(parts) != 6 {
+			t.Fatalf("malformed put line %q", line)
+		}
+		if parts[4] != "dc=eu_west" || parts[5] != "host=h1" {
+			t.Errorf("unexpected tags in %q", line)
+		}
+		found[parts[1]] = parts[3]
+	}
+	if v := found["p.foo"]; v != "2" {
+		t.Errorf("p.foo: %s != 2", v)
+	}
+	if v := found["p.bar.count"]; v != "1" {
+		t.Errorf("p.bar.count: %s != 1", v)
+	}
+	if _, ok := found["p.bar.rate.15min"]; !ok {
+		t.Error("missing p.bar.rate.15min")
+	}
+}
+
+func TestHTTP(t *testing.T) {
+	var batches [][]DataPoint
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter,
+		r *http.Request) {
+		if r.URL.Path != "/api/put" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		var pts []DataPoint
+		if err := json.NewDecoder(r.Body).Decode(&pts); err != nil {
+			t.Errorf("bad request body: %s", err)
+		}
+		batches = append(batches, pts)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	r := metrics.NewRegistry()
+	metrics.GetOrRegisterTimer("baz", r).Update(time.Second)
+
+	err := Once(Config{
+		Addr:      srv.URL,
+		Protocol:  HTTP,
+		Registry:  r,
+		BatchSize: 10,
+		Tags:      map[string]string{"host": "h1"},
+	})
+	if err != nil {
+		t.Fatalf("Once(): %s", err)
+	}
+	if len(batches) != 2 || len(batches[0]) != 10 || len(batches[1]) != 6 {
+		t.Fatalf("unexpected batching: %v", batches)
+	}
+	if m := batches[0][0].Metric; m != "baz.count" {
+		t.Errorf("%s != baz.count", m)
+	}
+	if tag := batches[0][0].Tags["host"]; tag != "h1" {
+		t.Errorf("%s != h1", tag)
+	}
+}
+
+func TestHTTPDetails(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter,
+		r *http.Request) {
+		if _, ok := r.URL.Query()["details"]; !ok {
+			t.Errorf("expected details query, got %s", r.URL.RawQuery)
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"failed":1,"success":0,"errors":[{"datapoint":` +
+			`{"metric":"foo","timestamp":1,"value":1,"tags":{}},` +
+			`"error":"Unknown metric"}]}`))
+	}))
+	defer srv.Close()
+
+	r := metrics.NewRegistry()
+	metrics.GetOrRegisterCounter("foo", r).Inc(1)
+
+	err := Once(Config{
+		Addr:     srv.URL,
+		Protocol: HTTP,
+		Registry: r,
+		Details:  true,
+	})
+	var putErr *PutError
+	if !errors.As(err, &putErr) {
+		t.Fatalf("Once(): expected *PutError, got %v", err)
+	}
+	if putErr.Failed != 1 || len(putErr.Errors) != 1 {
+		t.Fatalf("unexpected PutError: %+v", putErr)
+	}
+	if e := putErr.Errors[0].Error; e != "Unknown metric" {
+		t.Errorf("%s != Unknown metric", e)
+	}
+}
+
+func TestDataPoints(t *testing.T) {
+	tm := metrics.NewTimer()
+	tm.Update(2 * time.Second)
+	tags := map[string]string{"dc": "eu west"}
+	found := map[string]interface{}{}
+	for _, p := range DataPoints("t", "", tm, 1, time.Millisecond, tags) {
+		found[p.Metric] = p.Value
+		if p.Tags["dc"] != "eu_west" {
+			t.Errorf("%s: unexpected tags %v", p.Metric, p.Tags)
+		}
+	}
+	if v := found["t.max"]; v != 2000.0 {
+		t.Errorf("t.max: %v != 2000", v)
+	}
+
+	g := metrics.NewGaugeFloat64()
+	g.Update(math.NaN())
+	if pts := DataPoints("g", "", g, 1, time.Millisecond, tags); len(pts) != 0 {
+		t.Errorf("DataPoints(): %v for NaN", pts)
+	}
+
+	var b strings.Builder
+	WritePut(&b, DataPoint{Metric: "g", Timestamp: 1, Value: 0.25, Tags: tags})
+	if b.String() != "put g 1 0.25 dc=eu_west\n" {
+		t.Errorf("WritePut(): %q", b.String())
+	}
+}
+
+func TestUnsupportedProtocol(t *testing.T) {
+	if err := Once(Config{Protocol: "udp"}); err == nil {
+		t.Error("Once(): expected error for unsupported protocol")
+	}
+}
@@ -0,0 +1,247 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	pressureCollectors = map[Registry]*PressureCollector{}
+	pressureMutex      sync.Mutex
+)
+
+// PressureResources are the resources whose Pressure Stall Information is
+// collected by a PressureCollector.
+var PressureResources = []string{"cpu", "memory", "io"}
+
+// PressureStats is the Pressure Stall Information (PSI) of a single resource,
+// as read from /proc/pressure/<resource> or <cgroup>/<resource>.pressure.
+type PressureStats struct {
+	Some PressureStall // Time in which at least some tasks were stalled.
+	Full PressureStall // Time in which all non-idle tasks were stalled.
+}
+
+// PressureStall is a line of a PSI file.
+type PressureStall struct {
+	Avg10  float64 // Percentage of time stalled over the last 10 seconds.
+	Avg60  float64 // Percentage of time stalled over the last 60 seconds.
+	Avg300 float64 // Percentage of time stalled over the last 300 seconds.
+	Total  int64   // Total stall time, in microseconds.
+}
+
+// ReadPressureStats parses the PSI file at path into stats. The full line is
+// optional, i.e it is missing for cpu before Linux 5.13, in which case
+// stats.Full is zero.
+func ReadPressureStats(path string, stats *PressureStats) error {
+	var some bool
+	err := scanProcFile(path, func(key, value string) error {
+		var dst *PressureStall
+		switch key {
+		case "some":
+			dst, some = &stats.Some, true
+		case "full":
+			dst = &stats.Full
+		default:
+			return nil
+		}
+		// i.e "avg10=0.00 avg60=0.00 avg300=0.00 total=0".
+		for _, field := range strings.Fields(value) {
+			k, v, ok := strings.Cut(field, "=")
+			if !ok {
+				return fmt.Errorf("malformed field %q", field)
+			}
+			var err error
+			switch k {
+			case "avg10":
+				dst.Avg10, err = strconv.ParseFloat(v, 64)
+			case "avg60":
+				dst.Avg60, err = strconv.ParseFloat(v, 64)
+			case "avg300":
+				dst.Avg300, err = strconv.ParseFloat(v, 64)
+			case "total":
+				dst.Total, err = strconv.ParseInt(v, 10, 64)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err == nil && !some {
+		err = fmt.Errorf("%s: missing some line", path)
+	}
+	return err
+}
+
+// PressureCollector captures the Pressure Stall Information of the cpu,
+// memory and io resources into the metrics of a single registry. For each
+// resource and line it exports the GaugeFloat64s <prefix>.<resource>.some.avg10,
+// avg60 and avg300 and the Counter <prefix>.<resource>.some.total, in
+// microseconds, and their full equivalents, i.e pressure.memory.full.avg10.
+type PressureCollector struct {
+	name     string
+	paths    map[string]string
+	floats   map[string]GaugeFloat64
+	counters map[string]Counter
+}
+
+// NewPressureCollector constructs a new PressureCollector for the host and
+// registers its metrics in r, prefixed with "pressure". The proc filesystem
+// is read from root, or DefaultProcRoot if root is empty.
+func NewPressureCollector(r Registry, root string) *PressureCollector {
+	if root == "" {
+		root = DefaultProcRoot
+	}
+	return newPressureCollector(r, "pressure", func(resource string) string {
+		return filepath.Join(root, "pressure", resource)
+	})
+}
+
+// NewCgroupPressureCollector constructs a new PressureCollector for a cgroup
+// v2 group and registers its metrics in r, prefixed with "cgroup.pressure".
+// The group is read from root, or DefaultCgroupRoot if root is empty.
+func NewCgroupPressureCollector(r Registry, root string) *PressureCollector {
+	if root == "" {
+		root = DefaultCgroupRoot
+	}
+	return newPressureCollector(r, "cgroup.pressure", func(resource string) string {
+		return filepath.Join(root, resource+".pressure")
+	})
+}
+
+func newPressureCollector(r Registry, prefix string, path func(string) string) *PressureCollector {
+	if r == nil {
+		r = DefaultRegistry
+	}
+	c := &PressureCollector{
+		name:     prefix,
+		paths:    map[string]string{},
+		floats:   map[string]GaugeFloat64{},
+		counters: map[string]Counter{},
+	}
+	for _, resource := range PressureResources {
+		c.paths[resource] = path(resource)
+		for _, line := range []string{"some", "full"} {
+			name := resource + "." + line
+			for _, avg := range []string{"avg10", "avg60", "avg300"} {
+				c.floats[name+"."+avg] = GetOrRegisterGaugeFloat64(prefix+"."+name+"."+avg, r)
+			}
+			c.counters[name+".total"] = GetOrRegisterCounter(prefix+"."+name+".total", r)
+		}
+	}
+	return c
+}
+
+// Capture reads the PSI files and updates their metrics. Metrics of missing
+// resources keep their previous values. If PSI is not available at all, i.e
+// the kernel was booted without it, a *CollectorError is returned.
+func (c *PressureCollector) Capture() error {
+	stats, err := c.read()
+	c.update(stats)
+	return collected(c.name, err)
+}
+
+// Collect implements Collector.
+func (c *PressureCollector) Collect(ctx context.Context) error {
+	return c.Capture()
+}
+
+// Reads every resource. Missing resources are omitted from the result.
+func (c *PressureCollector) read() (map[string]*PressureStats, error) {
+	all := map[string]*PressureStats{}
+	var errs []error
+	for _, resource := range PressureResources {
+		var stats PressureStats
+		err := ReadPressureStats(c.paths[resource], &stats)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		all[resource] = &stats
+	}
+	if len(all) == 0 && len(errs) == 0 {
+		errs = append(errs, errors.New("pressure stall information unavailable"))
+	}
+	return all, errors.Join(errs...)
+}
+
+func (c *PressureCollector) update(all map[string]*PressureStats) {
+	for resource, stats := range all {
+		for line, stall := range map[string]PressureStall{
+			"some": stats.Some,
+			"full": stats.Full,
+		} {
+			name := resource + "." + line
+			c.floats[name+".avg10"].Update(stall.Avg10)
+			c.floats[name+".avg60"].Update(stall.Avg60)
+			c.floats[name+".avg300"].Update(stall.Avg300)
+			counter := c.counters[name+".total"]
+			counter.Inc(stall.Total - counter.Count())
+		}
+	}
+}
+
+// CapturePressureStats captures new values for the host Pressure Stall
+// Information. This is designed to be called as a goroutine. Errors are
+// passed to the handler set by SetCollectorErrorHandler.
+func CapturePressureStats(d time.Duration) {
+	for range time.Tick(d) {
+		handleCollectorError(CapturePressureStatsOnce())
+	}
+}
+
+// CapturePressureStatsOnce captures new values for the host Pressure Stall
+// Information into every registry given to RegisterPressureStats. A failed
+// read returns a *CollectorError.
+func CapturePressureStatsOnce() error {
+	pressureMutex.Lock()
+	defer pressureMutex.Unlock()
+	if len(pressureCollectors) == 0 {
+		return collected("pressure", errors.New("stats not registered"))
+	}
+	var all map[string]*PressureStats
+	var err error
+	for _, c := range pressureCollectors {
+		if all == nil {
+			all, err = c.read()
+		}
+		c.update(all)
+	}
+	return collected("pressure", err)
+}
+
+// RegisterPressureStats registers metrics for the host Pressure Stall
+// Information read from DefaultProcRoot, the saturation counterpart of the
+// utilization registered by RegisterCPUStats. Registering the same registry
+// twice is a no-op. The registry is held until it is given to
+// UnregisterPressureStats.
+func RegisterPressureStats(r Registry) {
+	if r == nil {
+		r = DefaultRegistry
+	}
+	pressureMutex.Lock()
+	defer pressureMutex.Unlock()
+	if _, ok := pressureCollectors[r]; !ok {
+		pressureCollectors[r] = NewPressureCollector(r, "")
+	}
+}
+
+// UnregisterPressureStats stops CapturePressureStatsOnce from updating the
+// metrics of r and releases r. Its metrics are left registered.
+func UnregisterPressureStats(r Registry) {
+	if r == nil {
+		r = DefaultRegistry
+	}
+	pressureMutex.Lock()
+	defer pressureMutex.Unlock()
+	delete(pressureCollectors, r)
+}
@@ -0,0 +1,88 @@
+package metrics
+
+import "testing"
+
+func TestReadPressureStats(t *testing.T) {
+	var stats PressureStats
+	if err := ReadPressureStats("testdata/proc/pressure/memory", &stats); err != nil {
+		t.Fatalf("ReadPressureStats(): %s", err)
+	}
+	expect := PressureStats{
+		Some: PressureStall{Avg10: 12, Avg60: 8.5, Avg300: 3.1, Total: 9876543},
+		Full: PressureStall{Avg10: 6.25, Avg60: 4, Avg300: 1.5, Total: 4567890},
+	}
+	if stats != expect {
+		t.Errorf("ReadPressureStats():\n%+v !=\n%+v", stats, expect)
+	}
+}
+
+func TestPressureCollector(t *testing.T) {
+	r := NewRegistry()
+	c := NewPressureCollector(r, "testdata/proc")
+	for i := 0; i < 2; i++ {
+		if err := c.Capture(); err != nil {
+			t.Fatalf("Capture(): %s", err)
+		}
+	}
+	for name, expect := range map[string]float64{
+		"pressure.cpu.some.avg10":     1.5,
+		"pressure.memory.some.avg60":  8.5,
+		"pressure.memory.full.avg300": 1.5,
+		"pressure.io.full.avg10":      0.05,
+	} {
+		if v := r.Get(name).(GaugeFloat64).Value(); v != expect {
+			t.Errorf("%s: %v != %v", name, v, expect)
+		}
+	}
+	for name, expect := range map[string]int64{
+		"pressure.cpu.some.total":    123456,
+		"pressure.memory.full.total": 4567890,
+		"pressure.io.some.total":     1000,
+	} {
+		if v := r.Get(name).(Counter).Count(); v != expect {
+			t.Errorf("%s: %d != %d", name, v, expect)
+		}
+	}
+}
+
+func TestCgroupPressureCollector(t *testing.T) {
+	r := NewRegistry()
+	if err := NewCgroupPressureCollector(r, "testdata/cgroup/v2").Capture(); err != nil {
+		t.Fatalf("Capture(): %s", err)
+	}
+	if v := r.Get("cgroup.pressure.cpu.some.avg10").(GaugeFloat64).Value(); v != 40 {
+		t.Errorf("cgroup.pressure.cpu.some.avg10: %v != 40", v)
+	}
+	if v := r.Get("cgroup.pressure.memory.full.total").(Counter).Count(); v != 100000 {
+		t.Errorf("cgroup.pressure.memory.full.total: %d != 100000", v)
+	}
+	// io.pressure is missing, which is not an error.
+	if v := r.Get("cgroup.pressure.io.some.total").(Counter).Count(); v != 0 {
+		t.Errorf("cgroup.pressure.io.some.total: %d != 0", v)
+	}
+}
+
+func TestPressureUnavailable(t *testing.T) {
+	if err := NewPressureCollector(NewRegistry(), "testdata/missing").Capture(); err == nil {
+		t.Error("Capture(): expected error without pressure stall information")
+	}
+	collected("pressure", nil)
+}
+
+func TestPressureStatsPerRegistry(t *testing.T) {
+	r1, r2 := NewRegistry(), NewRegistry()
+	RegisterPressureStats(r1)
+	RegisterPressureStats(r2)
+	defer func() {
+		UnregisterPressureStats(r1)
+		UnregisterPressureStats(r2)
+		collected("pressure", nil)
+	}()
+	// The host may not support PSI; only the registration is checked.
+	CapturePressureStatsOnce()
+	for _, r := range []Registry{r1, r2} {
+		if _, ok := r.Get("pressure.memory.some.avg10").(GaugeFloat64); !ok {
+			t.Error("pressure.memory.some.avg10: not registered")
+		}
+	}
+}
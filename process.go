@@ -0,0 +1,322 @@
+package metrics
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// DefaultProcRoot is the mount point of the proc filesystem read by the
+// process and system collectors.
+const DefaultProcRoot = "/proc"
+
+// Clock ticks per second used by the kernel for times in /proc/<pid>/stat.
+// This is USER_HZ, which is 100 on every supported architecture.
+const userHZ = 100
+
+// ProcessStats is the per process resource usage read from the proc
+// filesystem. Memory and IO values are in bytes.
+type ProcessStats struct {
+	ResidentMemory         int64 // Resident set size.
+	VirtualMemory          int64 // Virtual memory size.
+	OpenFDs                int64 // Number of open file descriptors.
+	MaxFDs                 int64 // Soft limit of open file descriptors, -1 if unlimited.
+	Threads                int64 // Number of threads.
+	StartTime              int64 // Start time of the process, in seconds since the epoch.
+	VoluntaryCtxSwitches   int64 // Context switches to wait for a resource.
+	InvoluntaryCtxSwitches int64 // Context switches forced by the scheduler.
+	MinorFaults            int64 // Page faults which did not require disk IO.
+	MajorFaults            int64 // Page faults which required disk IO.
+	ReadChars              int64 // Bytes read by read-like syscalls (rchar).
+	WriteChars             int64 // Bytes written by write-like syscalls (wchar).
+	ReadSyscalls           int64 // Number of read-like syscalls (syscr).
+	WriteSyscalls          int64 // Number of write-like syscalls (syscw).
+	ReadBytes              int64 // Bytes fetched from storage (read_bytes).
+	WriteBytes             int64 // Bytes sent to storage (write_bytes).
+	CancelledWriteBytes    int64 // Bytes whose writeback was cancelled.
+}
+
+// ReadProcessStats retrieves the resource usage of the process with the given
+// pid (i.e "self") from the proc filesystem mounted at root. Every file is
+// read even if another could not be, so stats holds whatever was available;
+// the returned error joins the errors of the unreadable files.
+func ReadProcessStats(root, pid string, stats *ProcessStats) error {
+	dir := filepath.Join(root, pid)
+	return errors.Join(
+		readProcessStat(root, dir, stats),
+		readProcessStatus(dir, stats),
+		readProcessFDs(dir, stats),
+		readProcessLimits(dir, stats),
+		readProcessIO(dir, stats),
+	)
+}
+
+// Parses /proc/<pid>/stat. The start time is relative to boot, which is read
+// from /proc/stat.
+func readProcessStat(root, dir string, stats *ProcessStats) error {
+	data, err := os.ReadFile(filepath.Join(dir, "stat"))
+	if err != nil {
+		return err
+	}
+	// The command name may contain spaces and parentheses, so fields are
+	// counted from the last closing parenthesis. fields[0] is field 3, state.
+	i := strings.LastIndexByte(string(data), ')')
+	if i < 0 {
+		return fmt.Errorf("%s: malformed stat", dir)
+	}
+	fields := strings.Fields(string(data[i+1:]))
+	if len(fields) < 22 {
+		return fmt.Errorf("%s: malformed stat", dir)
+	}
+	parse := func(field int) int64 {
+		if err != nil {
+			return 0
+		}
+		var v int64
+		v, err = strconv.ParseInt(fields[field-3], 10, 64)
+		return v
+	}
+	minflt, majflt := parse(10), parse(12)
+	starttime := parse(22)
+	if err != nil {
+		return err
+	}
+	stats.MinorFaults = minflt
+	stats.MajorFaults = majflt
+
+	btime, err := readBootTime(root)
+	if err != nil {
+		return err
+	}
+	stats.StartTime = btime + starttime/userHZ
+	return nil
+}
+
+func readBootTime(root string) (int64, error) {
+	var btime int64
+	err := scanProcFile(filepath.Join(root, "stat"), func(key, value string) error {
+		if key == "btime" {
+			v, err := strconv.ParseInt(value, 10, 64)
+			btime = v
+			return err
+		}
+		return nil
+	})
+	return btime, err
+}
+
+// Parses /proc/<pid>/status.
+func readProcessStatus(dir string, stats *ProcessStats) error {
+	return scanProcFile(filepath.Join(dir, "status"), func(key, value string) error {
+		var dst *int64
+		scale := int64(1)
+		switch key {
+		case "VmRSS:":
+			dst, scale = &stats.ResidentMemory, 1024
+		case "VmSize:":
+			dst, scale = &stats.VirtualMemory, 1024
+		case "Threads:":
+			dst = &stats.Threads
+		case "voluntary_ctxt_switches:":
+			dst = &stats.VoluntaryCtxSwitches
+		case "nonvoluntary_ctxt_switches:":
+			dst = &stats.InvoluntaryCtxSwitches
+		default:
+			return nil
+		}
+		v, err := strconv.ParseInt(strings.TrimSuffix(value, " kB"), 10, 64)
+		*dst = v * scale
+		return err
+	})
+}
+
+// Counts the entries of /proc/<pid>/fd.
+func readProcessFDs(dir string, stats *ProcessStats) error {
+	fds, err := os.ReadDir(filepath.Join(dir, "fd"))
+	if err != nil {
+		return err
+	}
+	stats.OpenFDs = int64(len(fds))
+	return nil
+}
+
+// Parses the soft limit of open files from /proc/<pid>/limits.
+func readProcessLimits(dir string, stats *ProcessStats) error {
+	f, err := os.Open(filepath.Join(dir, "limits"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "Max open files") {
+			continue
+		}
+		fields := strings.Fields(strings.TrimPrefix(line, "Max open files"))
+		if len(fields) == 0 {
+			break
+		}
+		if fields[0] == "unlimited" {
+			stats.MaxFDs = -1
+			return nil
+		}
+		stats.MaxFDs, err = strconv.ParseInt(fields[0], 10, 64)
+		return err
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return fmt.Errorf("%s: missing open files limit", dir)
+}
+
+// Parses /proc/<pid>/io.
+func readProcessIO(dir string, stats *ProcessStats) error {
+	return scanProcFile(filepath.Join(dir, "io"), func(key, value string) error {
+		var dst *int64
+		switch key {
+		case "rchar:":
+			dst = &stats.ReadChars
+		case "wchar:":
+			dst = &stats.WriteChars
+		case "syscr:":
+			dst = &stats.ReadSyscalls
+		case "syscw:":
+			dst = &stats.WriteSyscalls
+		case "read_bytes:":
+			dst = &stats.ReadBytes
+		case "write_bytes:":
+			dst = &stats.WriteBytes
+		case "cancelled_write_bytes:":
+			dst = &stats.CancelledWriteBytes
+		default:
+			return nil
+		}
+		v, err := strconv.ParseInt(value, 10, 64)
+		*dst = v
+		return err
+	})
+}
+
+// Calls f with the first field and the rest of every line of a proc file.
+func scanProcFile(path string, f func(key, value string) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		i := strings.IndexAny(line, " \t")
+		if i < 0 {
+			continue
+		}
+		if err := f(line[:i], strings.TrimSpace(line[i:])); err != nil {
+			return fmt.Errorf("%s: %s", path, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// ProcessCollector captures the resource usage exported in ProcessStats into
+// the metrics of a single registry. The metrics are named by their
+// fully-qualified Go symbols, i.e process.ProcessStats.ResidentMemory.
+type ProcessCollector struct {
+	root, pid string
+	gauges    map[string]Gauge
+	counters  map[string]Counter
+}
+
+// NewProcessCollector constructs a new ProcessCollector for the current
+// process and registers its metrics in r. The proc filesystem is read from
+// root, or DefaultProcRoot if root is empty.
+func NewProcessCollector(r Registry, root string) *ProcessCollector {
+	if r == nil {
+		r = DefaultRegistry
+	}
+	if root == "" {
+		root = DefaultProcRoot
+	}
+	c := &ProcessCollector{
+		root:     root,
+		pid:      "self",
+		gauges:   map[string]Gauge{},
+		counters: map[string]Counter{},
+	}
+	for _, name := range []string{"ResidentMemory", "VirtualMemory",
+		"OpenFDs", "MaxFDs", "Threads", "StartTime"} {
+		c.gauges[name] = GetOrRegisterGauge("process.ProcessStats."+name, r)
+	}
+	for _, name := range []string{"VoluntaryCtxSwitches",
+		"InvoluntaryCtxSwitches", "MinorFaults", "MajorFaults", "ReadChars",
+		"WriteChars", "ReadSyscalls", "WriteSyscalls", "ReadBytes",
+		"WriteBytes", "CancelledWriteBytes"} {
+		c.counters[name] = GetOrRegisterCounter("process.ProcessStats."+name, r)
+	}
+	return c
+}
+
+// Capture reads the process stats and updates their metrics. Metrics backed
+// by unreadable files, i.e /proc/self/io in restricted containers, keep their
+// previous values and the failure is returned as a *CollectorError.
+func (c *ProcessCollector) Capture() error {
+	var stats ProcessStats
+	dir := filepath.Join(c.root, c.pid)
+	var errs []error
+	update := func(err error, gauges, counters map[string]int64) {
+		if err != nil {
+			errs = append(errs, err)
+			return
+		}
+		for name, v := range gauges {
+			c.gauges[name].Update(v)
+		}
+		for name, v := range counters {
+			counter := c.counters[name]
+			counter.Inc(v - counter.Count())
+		}
+	}
+
+	err := readProcessStat(c.root, dir, &stats)
+	update(err, map[string]int64{
+		"StartTime": stats.StartTime,
+	}, map[string]int64{
+		"MinorFaults": stats.MinorFaults,
+		"MajorFaults": stats.MajorFaults,
+	})
+	err = readProcessStatus(dir, &stats)
+	update(err, map[string]int64{
+		"ResidentMemory": stats.ResidentMemory,
+		"VirtualMemory":  stats.VirtualMemory,
+		"Threads":        stats.Threads,
+	}, map[string]int64{
+		"VoluntaryCtxSwitches":   stats.VoluntaryCtxSwitches,
+		"InvoluntaryCtxSwitches": stats.InvoluntaryCtxSwitches,
+	})
+	err = readProcessFDs(dir, &stats)
+	update(err, map[string]int64{"OpenFDs": stats.OpenFDs}, nil)
+	err = readProcessLimits(dir, &stats)
+	update(err, map[string]int64{"MaxFDs": stats.MaxFDs}, nil)
+	err = readProcessIO(dir, &stats)
+	update(err, nil, map[string]int64{
+		"ReadChars":           stats.ReadChars,
+		"WriteChars":          stats.WriteChars,
+		"ReadSyscalls":        stats.ReadSyscalls,
+		"WriteSyscalls":       stats.WriteSyscalls,
+		"ReadBytes":           stats.ReadBytes,
+		"WriteBytes":          stats.WriteBytes,
+		"CancelledWriteBytes": stats.CancelledWriteBytes,
+	})
+	return collected("process", errors.Join(errs...))
+}
+
+// Collect implements Collector.
+func (c *ProcessCollector) Collect(ctx context.Context) error {
+	return c.Capture()
+}
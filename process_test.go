@@ -0,0 +1,98 @@
+package metrics
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadProcessStats(t *testing.T) {
+	var stats ProcessStats
+	if err := ReadProcessStats("testdata/proc", "self", &stats); err != nil {
+		t.Fatalf("ReadProcessStats(): %s", err)
+	}
+	expect := ProcessStats{
+		ResidentMemory:         1200 * 1024,
+		VirtualMemory:          120560 * 1024,
+		OpenFDs:                4,
+		MaxFDs:                 1024,
+		Threads:                7,
+		StartTime:              1700000005,
+		VoluntaryCtxSwitches:   42,
+		InvoluntaryCtxSwitches: 3,
+		MinorFaults:            1234,
+		MajorFaults:            56,
+		ReadChars:              1000,
+		WriteChars:             2000,
+		ReadSyscalls:           10,
+		WriteSyscalls:          20,
+		ReadBytes:              4096,
+		WriteBytes:             8192,
+		CancelledWriteBytes:    512,
+	}
+	if stats != expect {
+		t.Errorf("ReadProcessStats():\n%+v !=\n%+v", stats, expect)
+	}
+}
+
+func TestProcessCollector(t *testing.T) {
+	r := NewRegistry()
+	if err := NewProcessCollector(r, "testdata/proc").Capture(); err != nil {
+		t.Fatalf("Capture(): %s", err)
+	}
+	if v := r.Get("process.ProcessStats.ResidentMemory").(Gauge).Value(); v != 1200*1024 {
+		t.Errorf("ResidentMemory: %d != %d", v, 1200*1024)
+	}
+	if v := r.Get("process.ProcessStats.MajorFaults").(Counter).Count(); v != 56 {
+		t.Errorf("MajorFaults: %d != 56", v)
+	}
+}
+
+func TestProcessCollectorUnreadableIO(t *testing.T) {
+	// Copy the fixture tree without the io file, as in restricted containers.
+	root := t.TempDir()
+	err := filepath.Walk("testdata/proc", func(path string, info os.FileInfo, err error) error {
+		if err != nil || filepath.Base(path) == "io" {
+			return err
+		}
+		rel, _ := filepath.Rel("testdata/proc", path)
+		if info.IsDir() {
+			return os.MkdirAll(filepath.Join(root, rel), 0o755)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(filepath.Join(root, rel), data, 0o644)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewRegistry()
+	err = NewProcessCollector(r, root).Capture()
+	defer collected("process", nil)
+	var collectorErr *CollectorError
+	if !errors.As(err, &collectorErr) || !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Capture(): expected *CollectorError for missing io, got %v", err)
+	}
+	if v := r.Get("process.ProcessStats.Threads").(Gauge).Value(); v != 7 {
+		t.Errorf("Threads: %d != 7", v)
+	}
+}
+
+func TestProcessCollectorSelf(t *testing.T) {
+	if _, err := os.Stat("/proc/self/stat"); err != nil {
+		t.Skip("no proc filesystem")
+	}
+	r := NewRegistry()
+	err := NewProcessCollector(r, "").Capture()
+	defer collected("process", nil)
+	if err != nil && !errors.Is(err, os.ErrPermission) {
+		t.Fatalf("Capture(): %s", err)
+	}
+	if v := r.Get("process.ProcessStats.OpenFDs").(Gauge).Value(); v < 3 {
+		t.Errorf("OpenFDs: %d < 3", v)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	pr "github.com/prometheus/client_golang/prometheus"
 	"github.com/zeim839/go-metrics-plus"
 	"log"
+	"sort"
 	"sync"
 	"time"
 )
@@ -18,6 +19,10 @@ type Config struct {
 	Registry      metrics.Registry // Registry to be exported.
 	FlushInterval time.Duration    // Flush interval.
 	DurationUnit  time.Duration    // Time conversion unit for durations.
+
+	// RemoveUnregistered removes the series of the metrics unregistered from
+	// Registry, by subscribing to it until Close is called.
+	RemoveUnregistered bool
 }
 
 // The Prometheus exposer's state. Can be created with New() or NewWithConfig().
@@ -26,6 +31,17 @@ type Prometheus struct {
 	reg     *pr.Registry
 	vectors map[string]*pr.GaugeVec
 	mutex   sync.Mutex
+
+	// Series are removed when their metric is unregistered from the
+	// registry. Removals are queued, since the registry may notify while
+	// Once iterates over it.
+	series      map[string]map[string]pr.Labels // Metric keys to their vector names and labels.
+	exported    map[string]bool                 // Keys of the metrics exported by Once.
+	current     string                          // Key of the metric being exported.
+	labels      map[string]string               // Labels of the metric being exported.
+	unsubscribe func()
+	removed     []metrics.RegistryEvent
+	removeMutex sync.Mutex
 }
 
 // New creates a new prometheus exposer instance that will expose metrics registry
@@ -50,15 +66,80 @@ func NewWithConfig(c Config, p *pr.Registry) (*Prometheus, error) {
 	}
 	prom := &Prometheus{
 		vectors: map[string]*pr.GaugeVec{},
+		series:  map[string]map[string]pr.Labels{},
 		config:  c,
 		reg:     p,
 	}
+	prom.unsubscribe = func() {}
+	if c.Registry != nil && c.RemoveUnregistered {
+		prom.unsubscribe = c.Registry.Subscribe(func(e metrics.RegistryEvent) {
+			if e.Type == metrics.MetricUnregistered {
+				prom.removeMutex.Lock()
+				prom.removed = append(prom.removed, e)
+				prom.removeMutex.Unlock()
+			}
+		})
+	}
 	return prom, nil
 }
 
+// Close stops tracking unregistrations from the exported registry, if
+// Config.RemoveUnregistered is set. The exposer must not be used afterwards.
+func (p *Prometheus) Close() {
+	p.unsubscribe()
+}
+
+// Removes the series of metrics that were unregistered from the exported
+// registry. Vectors without labels are unregistered. Not threadsafe, must be
+// called with a mutex.
+func (p *Prometheus) removeUnregistered() {
+	p.removeMutex.Lock()
+	removed := p.removed
+	p.removed = nil
+	p.removeMutex.Unlock()
+	for _, e := range removed {
+		// The metric may have been registered again since. Names are not
+		// enough to tell, since views may report several metrics under one
+		// name with other labels.
+		key := metricKey(e.Name, metrics.MetricLabels(e.Metric))
+		if p.exported[key] && metrics.Lookup(p.config.Registry, e.Name) != nil {
+			continue
+		}
+		for vecName, labels := range p.series[key] {
+			vec, ok := p.vectors[vecName]
+			if !ok {
+				continue
+			}
+			if len(labels) > 0 {
+				vec.Delete(labels)
+				continue
+			}
+			p.reg.Unregister(vec)
+			delete(p.vectors, vecName)
+		}
+		delete(p.series, key)
+	}
+}
+
+// Returns the key of the series of a metric, which tells apart the metrics
+// with the same name but other labels, i.e those rewritten by a
+// metrics.RewriteRegistry.
+func metricKey(name string, labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for k := range labels {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	key := name
+	for _, k := range names {
+		key += "\xff" + k + "=" + labels[k]
+	}
+	return key
+}
+
 // Retrieves or creates a gauge vector for the given name and label set. Not
 // threadsafe, must be called with a mutex.
-func (p *Prometheus) getVector(name string) *pr.GaugeVec {
+func (p *Prometheus) getVector(name string, labels ...string) *pr.GaugeVec {
 	vec, ok := p.vectors[name]
 	if !ok {
 		vec = pr.NewGaugeVec(pr.GaugeOpts{
@@ -66,78 +147,103 @@ func (p *Prometheus) getVector(name string) *pr.GaugeVec {
 			Subsystem: p.config.Subsystem,
 			Name:      name,
 			Help:      name,
-		}, nil)
+		}, labels)
 		p.vectors[name] = vec
 		p.reg.MustRegister(vec)
 	}
 	return vec
 }
 
-// Sets the value of the gauge with name and labels. Prints an error if the
-// gauge cannot be set or labels dont match predefined schema. Not threadsafe,
-// must be called with a mutex.
+// Sets the value of the gauge with name, labelled with the labels of the
+// metric being exported, i.e those extracted by a metrics.RewriteRegistry.
+// Not threadsafe, must be called with a mutex.
 func (p *Prometheus) setValue(name string, val float64) {
-	vec := p.getVector(name)
-	gauge, err := vec.GetMetricWith(nil)
+	p.setGauge(name, p.labels, val)
+}
+
+// Sets the value of the gauge with name to 1, labelled with labels. Not
+// threadsafe, must be called with a mutex.
+func (p *Prometheus) setInfo(name string, labels map[string]string) {
+	p.setGauge(name, labels, 1)
+}
+
+// Sets the value of the gauge with name and labels. The label names of a
+// vector are fixed by its first value. Prints an error if the gauge cannot be
+// set or labels dont match predefined schema. Not threadsafe, must be called
+// with a mutex.
+func (p *Prometheus) setGauge(name string, labels map[string]string, val float64) {
+	names := make([]string, 0, len(labels))
+	for k := range labels {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	vec := p.getVector(name, names...)
+	gauge, err := vec.GetMetricWith(labels)
 	if err != nil {
 		log.Printf("Error: (metrics) ignoring %s due to error: %s", name, err)
 		return
 	}
+	if p.series[p.current] == nil {
+		p.series[p.current] = map[string]pr.Labels{}
+	}
+	p.series[p.current][name] = labels
 	gauge.Set(val)
 }
 
 // Once performs a single submission of metrics to the configured prometheus
-// registry.
+// registry. If Config.RemoveUnregistered is set, the series of metrics that
+// were unregistered since the last submission are removed.
 func (p *Prometheus) Once() {
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
-	p.config.Registry.Each(func(name string, i interface{}) {
+	defer p.removeUnregistered()
+	p.exported = map[string]bool{}
+	p.config.Registry.Snapshot().Each(func(name string, i interface{}) {
+		p.labels = metrics.MetricLabels(i)
+		p.current = metricKey(name, p.labels)
+		p.exported[p.current] = true
 		switch metric := i.(type) {
 		case metrics.Counter:
-			m := metric.Snapshot()
-			p.setValue(name+"_count", float64(m.Count()))
+			p.setValue(name+"_count", float64(metric.Count()))
 		case metrics.Gauge:
-			m := metric.Snapshot()
-			p.setValue(name+"_gauge", float64(m.Value()))
+			p.setValue(name+"_gauge", float64(metric.Value()))
 		case metrics.GaugeFloat64:
-			m := metric.Snapshot()
-			p.setValue(name+"_gauge", m.Value())
+			p.setValue(name+"_gauge", metric.Value())
+		case metrics.Info:
+			p.setInfo(name+"_info", metric.Labels())
 		case metrics.Meter:
-			m := metric.Snapshot()
-			p.setValue(name+"_count", float64(m.Count()))
-			p.setValue(name+"_rate_1min", m.Rate1())
-			p.setValue(name+"_rate_5min", m.Rate5())
-			p.setValue(name+"_rate_15min", m.Rate15())
-			p.setValue(name+"_rate_mean", m.RateMean())
+			p.setValue(name+"_count", float64(metric.Count()))
+			p.setValue(name+"_rate_1min", metric.Rate1())
+			p.setValue(name+"_rate_5min", metric.Rate5())
+			p.setValue(name+"_rate_15min", metric.Rate15())
+			p.setValue(name+"_rate_mean", metric.RateMean())
 		case metrics.Timer:
-			m := metric.Snapshot()
-			ps := m.Percentiles([]float64{0.5, 0.75, 0.95, 0.99, 0.999})
-			p.setValue(name+"_count", float64(m.Count()))
-			p.setValue(name+"_min", float64(m.Min()))
-			p.setValue(name+"_max", float64(m.Max()))
-			p.setValue(name+"_mean", m.Mean())
-			p.setValue(name+"_sum", float64(m.Sum()))
-			p.setValue(name+"_variance", m.Variance())
-			p.setValue(name+"_stddev", m.StdDev())
+			ps := metric.Percentiles([]float64{0.5, 0.75, 0.95, 0.99, 0.999})
+			p.setValue(name+"_count", float64(metric.Count()))
+			p.setValue(name+"_min", float64(metric.Min()))
+			p.setValue(name+"_max", float64(metric.Max()))
+			p.setValue(name+"_mean", metric.Mean())
+			p.setValue(name+"_sum", float64(metric.Sum()))
+			p.setValue(name+"_variance", metric.Variance())
+			p.setValue(name+"_stddev", metric.StdDev())
 			p.setValue(name+"_median", ps[0])
 			p.setValue(name+"_percentile_75", ps[1])
 			p.setValue(name+"_percentile_95", ps[2])
 			p.setValue(name+"_percentile_99_0", ps[3])
 			p.setValue(name+"_percentile_99_9", ps[4])
-			p.setValue(name+"_rate_1min", m.Rate1())
-			p.setValue(name+"_rate_5min", m.Rate5())
-			p.setValue(name+"_rate_15min", m.Rate15())
-			p.setValue(name+"_rate_mean", m.RateMean())
+			p.setValue(name+"_rate_1min", metric.Rate1())
+			p.setValue(name+"_rate_5min", metric.Rate5())
+			p.setValue(name+"_rate_15min", metric.Rate15())
+			p.setValue(name+"_rate_mean", metric.RateMean())
 		case metrics.Histogram:
-			m := metric.Snapshot()
-			ps := m.Percentiles([]float64{0.5, 0.75, 0.95, 0.99, 0.999})
-			p.setValue(name+"_count", float64(m.Count()))
-			p.setValue(name+"_min", float64(m.Min()))
-			p.setValue(name+"_max", float64(m.Max()))
-			p.setValue(name+"_mean", m.Mean())
-			p.setValue(name+"_sum", float64(m.Sum()))
-			p.setValue(name+"_variance", m.Variance())
-			p.setValue(name+"_stddev", m.StdDev())
+			ps := metric.Percentiles([]float64{0.5, 0.75, 0.95, 0.99, 0.999})
+			p.setValue(name+"_count", float64(metric.Count()))
+			p.setValue(name+"_min", float64(metric.Min()))
+			p.setValue(name+"_max", float64(metric.Max()))
+			p.setValue(name+"_mean", metric.Mean())
+			p.setValue(name+"_sum", float64(metric.Sum()))
+			p.setValue(name+"_variance", metric.Variance())
+			p.setValue(name+"_stddev", metric.StdDev())
 			p.setValue(name+"_median", ps[0])
 			p.setValue(name+"_percentile_75", ps[1])
 			p.setValue(name+"_percentile_95", ps[2])
@@ -146,3 +146,137 @@ func TestPrometheusOnce(t *testing.T) {
 	}
 	// Mean rate is too volatile to calculate.
 }
+
+func TestPrometheusInfo(t *testing.T) {
+	reg := metrics.NewRegistry()
+	metrics.NewRegisteredInfo("build", reg, map[string]string{
+		"version":  "v1.2.3",
+		"revision": "abc",
+	})
+
+	r := prometheus.NewRegistry()
+	pr, err := New(reg, time.Second, "", "", r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pr.Once()
+	metrics, _ := r.Gather()
+	if len(metrics) != 1 {
+		t.Fatalf("Once(): expected 1 metric but found %d", len(metrics))
+	}
+	expected := "name:\"build_info\" help:\"build_info\" type:GAUGE " +
+		"metric:<label:<name:\"revision\" value:\"abc\" > " +
+		"label:<name:\"version\" value:\"v1.2.3\" > gauge:<value:1 > > "
+	if expected != fmt.Sprint(metrics[0]) {
+		t.Errorf("Once(): %s != %s", expected, metrics[0])
+	}
+}
+
+func TestPrometheusUnregister(t *testing.T) {
+	reg := metrics.NewRegistry()
+	metrics.GetOrRegisterCounter("foo", reg).Inc(1)
+	metrics.GetOrRegisterCounter("bar", reg).Inc(2)
+
+	r := prometheus.NewRegistry()
+	pr, err := NewWithConfig(Config{Registry: reg, RemoveUnregistered: true}, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pr.Close()
+	pr.Once()
+	if families, _ := r.Gather(); len(families) != 2 {
+		t.Fatalf("Once(): expected 2 metrics but found %d", len(families))
+	}
+
+	reg.Unregister("foo")
+	pr.Once()
+	families, _ := r.Gather()
+	if len(families) != 1 || families[0].GetName() != "bar_count" {
+		t.Errorf("Once(): expected only bar_count, found %v", families)
+	}
+
+	// Re-registered metrics are exported again.
+	metrics.GetOrRegisterCounter("foo", reg).Inc(3)
+	pr.Once()
+	if families, _ := r.Gather(); len(families) != 2 {
+		t.Errorf("Once(): expected 2 metrics but found %d", len(families))
+	}
+}
+
+func TestPrometheusLabels(t *testing.T) {
+	reg := metrics.NewRegistry()
+	metrics.GetOrRegisterCounter("http.GET.requests", reg).Inc(1)
+	metrics.GetOrRegisterCounter("http.POST.requests", reg).Inc(2)
+	rewrite, err := metrics.NewRewriteRegistry(reg, []metrics.RewriteRule{
+		{Template: "http.{method}.*"},
+		{Regexp: `\.`, Replacement: "_"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := prometheus.NewRegistry()
+	pr, err := NewWithConfig(Config{Registry: rewrite, RemoveUnregistered: true}, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pr.Close()
+	pr.Once()
+	families, _ := r.Gather()
+	if len(families) != 1 || len(families[0].GetMetric()) != 2 {
+		t.Fatalf("Once(): expected 1 metric with 2 series, found %v", families)
+	}
+	if name := families[0].GetName(); name != "http_requests_count" {
+		t.Errorf("Once(): %s != http_requests_count", name)
+	}
+
+	// Only the series of the unregistered metric is removed.
+	reg.Unregister("http.GET.requests")
+	pr.Once()
+	families, _ = r.Gather()
+	if len(families) != 1 || len(families[0].GetMetric()) != 1 {
+		t.Fatalf("Once(): expected 1 series, found %v", families)
+	}
+	if l := families[0].GetMetric()[0].GetLabel(); len(l) != 1 || l[0].GetValue() != "POST" {
+		t.Errorf("Once(): unexpected labels %v", l)
+	}
+}
+
+func TestPrometheusReregisteredInView(t *testing.T) {
+	reg := metrics.NewRegistry()
+	metrics.GetOrRegisterCounter("Foo", reg).Inc(1)
+	rewrite, err := metrics.NewRewriteRegistry(reg, []metrics.RewriteRule{{Case: metrics.SnakeCase}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := prometheus.NewRegistry()
+	pr, err := NewWithConfig(Config{Registry: rewrite, RemoveUnregistered: true}, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pr.Close()
+	pr.Once()
+	reg.Unregister("Foo")
+	metrics.GetOrRegisterCounter("Foo", reg).Inc(2)
+	pr.Once()
+	if families, _ := r.Gather(); len(families) != 1 || families[0].GetName() != "foo_count" {
+		t.Errorf("Once(): expected foo_count, found %v", families)
+	}
+}
+
+func TestPrometheusKeepsUnregisteredByDefault(t *testing.T) {
+	reg := metrics.NewRegistry()
+	metrics.GetOrRegisterCounter("foo", reg).Inc(1)
+	r := prometheus.NewRegistry()
+	pr, err := New(reg, time.Second, "", "", r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pr.Once()
+	reg.Unregister("foo")
+	pr.Once()
+	if families, _ := r.Gather(); len(families) != 1 {
+		t.Errorf("Once(): expected foo_count to be kept, found %v", families)
+	}
+}
@@ -0,0 +1,105 @@
+package prometheusmetrics
+
+import (
+	"errors"
+	pr "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	"github.com/prometheus/common/expfmt"
+	"github.com/zeim839/go-metrics-plus"
+	"net/http"
+	"time"
+)
+
+// PushConfig provides a container with configuration parameters for pushing
+// a registry to a Prometheus Pushgateway. The job, instance and grouping
+// labels together form the Pushgateway grouping key.
+type PushConfig struct {
+	URL             string            // Pushgateway address, i.e http://localhost:9091.
+	Job             string            // Job grouping label (required).
+	Instance        string            // Instance grouping label (optional).
+	Grouping        map[string]string // Additional grouping labels.
+	Namespace       string            // The Prometheus namespace.
+	Subsystem       string            // The Prometheus subsystem.
+	Registry        metrics.Registry  // Registry to be pushed.
+	DurationUnit    time.Duration     // Time conversion unit for durations.
+	Client          *http.Client      // HTTP client, defaults to http.DefaultClient.
+	DeleteOnSuccess bool              // Used by RunJob, see RunJob.
+}
+
+// Push renders the registry in the Prometheus text exposition format and
+// pushes it to the Pushgateway, replacing all metrics previously pushed under
+// the same grouping key.
+func Push(c PushConfig) error {
+	p, err := newPusher(c, true)
+	if err != nil {
+		return err
+	}
+	return p.Push()
+}
+
+// PushAdd works like Push, but only replaces previously pushed metrics which
+// share a name with the metrics being pushed.
+func PushAdd(c PushConfig) error {
+	p, err := newPusher(c, true)
+	if err != nil {
+		return err
+	}
+	return p.Add()
+}
+
+// Delete removes all metrics pushed under the configured grouping key from
+// the Pushgateway.
+func Delete(c PushConfig) error {
+	p, err := newPusher(c, false)
+	if err != nil {
+		return err
+	}
+	return p.Delete()
+}
+
+// RunJob runs the batch job f and pushes the registry once it returns. If f
+// succeeds and DeleteOnSuccess is set, the grouping key is deleted from the
+// Pushgateway instead, so that only failed runs leave metrics behind. The
+// returned error joins the errors of f and of the Pushgateway request.
+func RunJob(c PushConfig, f func() error) error {
+	jobErr := f()
+	if jobErr == nil && c.DeleteOnSuccess {
+		return Delete(c)
+	}
+	return errors.Join(jobErr, Push(c))
+}
+
+// Creates a pusher for the grouping key in c. If gather is true, the
+// registry is flushed into a fresh Prometheus registry which is attached to
+// the pusher.
+func newPusher(c PushConfig, gather bool) (*push.Pusher, error) {
+	p := push.New(c.URL, c.Job).Format(expfmt.FmtText)
+	if c.Client != nil {
+		p = p.Client(c.Client)
+	}
+	if c.Instance != "" {
+		p = p.Grouping("instance", c.Instance)
+	}
+	for k, v := range c.Grouping {
+		p = p.Grouping(k, v)
+	}
+	if !gather {
+		return p, nil
+	}
+	if c.Registry == nil {
+		c.Registry = metrics.DefaultRegistry
+	}
+	reg := pr.NewRegistry()
+	prom, err := NewWithConfig(Config{
+		Namespace:    c.Namespace,
+		Subsystem:    c.Subsystem,
+		Registry:     c.Registry,
+		DurationUnit: c.DurationUnit,
+	}, reg)
+	if err != nil {
+		return nil, err
+	}
+	defer prom.Close()
+	prom.Once()
+	return p.Gatherer(reg), nil
+}
@@ -0,0 +1,173 @@
+package prometheusmetrics
+
+import (
+	"errors"
+	"github.com/zeim839/go-metrics-plus"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func ExamplePush() {
+	metrics.GetOrRegisterCounter("processed", nil).Inc(500)
+
+	// Push the registry once the batch job has finished.
+	err := Push(PushConfig{
+		URL:      "http://localhost:9091",
+		Job:      "nightly_backup",
+		Instance: "worker-1",
+		Registry: metrics.DefaultRegistry,
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+type pushRequest struct {
+	method string
+	path   string
+	body   string
+}
+
+func newPushServer(t *testing.T) (*httptest.Server, *[]pushRequest) {
+	var (
+		reqs  []pushRequest
+		mutex sync.Mutex
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter,
+		r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("push server: %s", err)
+		}
+		mutex.Lock()
+		reqs = append(reqs, pushRequest{r.Method, r.URL.Path, string(body)})
+		mutex.Unlock()
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	return srv, &reqs
+}
+
+func TestPush(t *testing.T) {
+	srv, reqs := newPushServer(t)
+	defer srv.Close()
+
+	r := metrics.NewRegistry()
+	metrics.GetOrRegisterCounter("foo", r).Inc(7)
+	c := PushConfig{
+		URL:      srv.URL,
+		Job:      "batch",
+		Instance: "host1",
+		Grouping: map[string]string{"shard": "3"},
+		Registry: r,
+	}
+
+	if err := Push(c); err != nil {
+		t.Fatalf("Push(): %s", err)
+	}
+	if err := PushAdd(c); err != nil {
+		t.Fatalf("PushAdd(): %s", err)
+	}
+	if err := Delete(c); err != nil {
+		t.Fatalf("Delete(): %s", err)
+	}
+
+	if len(*reqs) != 3 {
+		t.Fatalf("expected 3 requests, got %d", len(*reqs))
+	}
+	for i, method := range []string{http.MethodPut, http.MethodPost,
+		http.MethodDelete} {
+		req := (*reqs)[i]
+		if req.method != method {
+			t.Errorf("request %d: %s != %s", i, req.method, method)
+		}
+		for _, part := range []string{"/metrics/job/batch", "/instance/host1",
+			"/shard/3"} {
+			if !strings.Contains(req.path, part) {
+				t.Errorf("request %d: path %s missing %s", i, req.path, part)
+			}
+		}
+	}
+	if body := (*reqs)[0].body; !strings.Contains(body, "foo_count 7") {
+		t.Errorf("Push(): unexpected body %q", body)
+	}
+	if body := (*reqs)[2].body; body != "" {
+		t.Errorf("Delete(): unexpected body %q", body)
+	}
+}
+
+// A registry which counts its active subscriptions.
+type subscriptionRegistry struct {
+	metrics.Registry
+	mutex         sync.Mutex
+	subscriptions int
+}
+
+func (r *subscriptionRegistry) Subscribe(f func(metrics.RegistryEvent)) func() {
+	r.mutex.Lock()
+	r.subscriptions++
+	r.mutex.Unlock()
+	unsubscribe := r.Registry.Subscribe(f)
+	return func() {
+		unsubscribe()
+		r.mutex.Lock()
+		r.subscriptions--
+		r.mutex.Unlock()
+	}
+}
+
+func TestPushUnsubscribes(t *testing.T) {
+	srv, _ := newPushServer(t)
+	defer srv.Close()
+
+	r := &subscriptionRegistry{Registry: metrics.NewRegistry()}
+	metrics.GetOrRegisterCounter("foo", r).Inc(1)
+	c := PushConfig{URL: srv.URL, Job: "batch", Registry: r}
+	for i := 0; i < 3; i++ {
+		if err := Push(c); err != nil {
+			t.Fatalf("Push(): %s", err)
+		}
+	}
+	if r.subscriptions != 0 {
+		t.Errorf("Push(): %d subscriptions left", r.subscriptions)
+	}
+}
+
+func TestPushEmptyJob(t *testing.T) {
+	if err := Push(PushConfig{URL: "localhost:9091"}); err == nil {
+		t.Error("Push(): expected error for empty job")
+	}
+}
+
+func TestRunJob(t *testing.T) {
+	srv, reqs := newPushServer(t)
+	defer srv.Close()
+
+	c := PushConfig{
+		URL:             srv.URL,
+		Job:             "batch",
+		Registry:        metrics.NewRegistry(),
+		DeleteOnSuccess: true,
+	}
+
+	if err := RunJob(c, func() error { return nil }); err != nil {
+		t.Fatalf("RunJob(): %s", err)
+	}
+	jobErr := errors.New("job failed")
+	if err := RunJob(c, func() error { return jobErr }); !errors.Is(err, jobErr) {
+		t.Fatalf("RunJob(): %v != %v", err, jobErr)
+	}
+
+	if len(*reqs) != 2 {
+		t.Fatalf("expected 2 requests, got %d", len(*reqs))
+	}
+	if method := (*reqs)[0].method; method != http.MethodDelete {
+		t.Errorf("RunJob(): successful job sent %s", method)
+	}
+	if method := (*reqs)[1].method; method != http.MethodPut {
+		t.Errorf("RunJob(): failed job sent %s", method)
+	}
+}
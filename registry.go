@@ -5,6 +5,7 @@ import (
 	"reflect"
 	"strings"
 	"sync"
+	"time"
 )
 
 // DuplicateMetric is the error returned by Registry.Register when a metric
@@ -16,6 +17,30 @@ func (err DuplicateMetric) Error() string {
 	return fmt.Sprintf("duplicate metric: %s", string(err))
 }
 
+// UnsupportedMetric is the error returned by Registry.Register when the given
+// value does not implement any of the metric interfaces, i.e a plain int or a
+// struct of counters. Such values are not registered.
+type UnsupportedMetric struct {
+	Name   string
+	Metric interface{}
+}
+
+func (err *UnsupportedMetric) Error() string {
+	return fmt.Sprintf("unsupported metric type %T: %s", err.Metric, err.Name)
+}
+
+// MismatchedMetric is the error returned by GetOrRegisterAs when the metric
+// registered under the given name is not of the requested type.
+type MismatchedMetric struct {
+	Name   string
+	Metric interface{}  // The registered metric.
+	Want   reflect.Type // The requested type.
+}
+
+func (err *MismatchedMetric) Error() string {
+	return fmt.Sprintf("metric %s is a %T, not a %s", err.Name, err.Metric, err.Want)
+}
+
 // A Registry holds references to a set of metrics by name and can iterate
 // over them, calling callback functions provided by the user.
 //
@@ -53,6 +78,13 @@ type Registry interface {
 
 	// Unregister all metrics.  (Mostly for testing.)
 	UnregisterAll()
+
+	// Snapshot returns an immutable copy of every metric, sorted by name.
+	Snapshot() RegistrySnapshot
+
+	// Subscribe calls the given function with every subsequent registration
+	// and unregistration of a metric, until the returned function is called.
+	Subscribe(func(RegistryEvent)) func()
 }
 
 // StandardRegistry is the standard implementation of a Registry is a
@@ -61,6 +93,15 @@ type StandardRegistry struct {
 	metrics   map[string]interface{}
 	tempQueue []metricKV
 	mutex     sync.RWMutex
+
+	// Idle metric expiry, see NewRegistryWithTTL.
+	ttl       time.Duration
+	onEvict   func(string, interface{})
+	evictions Counter
+	seen      map[string]*ttlEntry
+	now       func() time.Time
+
+	subscribers registrySubscribers
 }
 
 // NewRegistry creates a new registry.
@@ -70,6 +111,7 @@ func NewRegistry() Registry {
 
 // Each calls the given function for each registered metric.
 func (r *StandardRegistry) Each(f func(string, interface{})) {
+	r.Expire()
 	metrics := r.registered()
 	for i := range metrics {
 		kv := &metrics[i]
@@ -100,12 +142,14 @@ func (r *StandardRegistry) GetOrRegister(name string, i interface{}) interface{}
 	// access the read lock first which should be re-entrant
 	r.mutex.RLock()
 	metric, ok := r.metrics[name]
+	r.touch(name)
 	r.mutex.RUnlock()
 	if ok {
 		return metric
 	}
 
 	// only take the write lock if we'll be modifying the metrics map
+	defer r.dispatch()
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 	if metric, ok := r.metrics[name]; ok {
@@ -114,13 +158,17 @@ func (r *StandardRegistry) GetOrRegister(name string, i interface{}) interface{}
 	if v := reflect.ValueOf(i); v.Kind() == reflect.Func {
 		i = v.Call(nil)[0].Interface()
 	}
-	r.register(name, i)
-	return i
+	if r.register(name, i) != nil {
+		return i
+	}
+	return r.metrics[name]
 }
 
 // Register the given metric under the given name.  Returns a DuplicateMetric
-// if a metric by the given name is already registered.
+// if a metric by the given name is already registered, or an
+// *UnsupportedMetric if i is not a supported metric type.
 func (r *StandardRegistry) Register(name string, i interface{}) error {
+	defer r.dispatch()
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 	return r.register(name, i)
@@ -146,82 +194,40 @@ func (r *StandardRegistry) RunHealthchecks() {
 	}
 }
 
-// GetAll metrics in the Registry
+// GetAll metrics in the Registry, from a snapshot which excludes the metrics
+// stored with SinkOnce. Healthchecks are not run; their status is the one set
+// by their last check.
 func (r *StandardRegistry) GetAll() map[string]map[string]interface{} {
-	data := make(map[string]map[string]interface{})
-	r.Each(func(name string, i interface{}) {
-		values := make(map[string]interface{})
-		switch metric := i.(type) {
-		case Counter:
-			values["count"] = metric.Count()
-		case Gauge:
-			values["value"] = metric.Value()
-		case GaugeFloat64:
-			values["value"] = metric.Value()
-		case Healthcheck:
-			values["error"] = nil
-			metric.Check()
-			if err := metric.Error(); nil != err {
-				values["error"] = metric.Error().Error()
-			}
-		case Histogram:
-			h := metric.Snapshot()
-			ps := h.Percentiles([]float64{0.5, 0.75, 0.95, 0.99, 0.999})
-			values["count"] = h.Count()
-			values["min"] = h.Min()
-			values["max"] = h.Max()
-			values["mean"] = h.Mean()
-			values["stddev"] = h.StdDev()
-			values["median"] = ps[0]
-			values["75%"] = ps[1]
-			values["95%"] = ps[2]
-			values["99%"] = ps[3]
-			values["99.9%"] = ps[4]
-		case Meter:
-			m := metric.Snapshot()
-			values["count"] = m.Count()
-			values["1m.rate"] = m.Rate1()
-			values["5m.rate"] = m.Rate5()
-			values["15m.rate"] = m.Rate15()
-			values["mean.rate"] = m.RateMean()
-		case Timer:
-			t := metric.Snapshot()
-			ps := t.Percentiles([]float64{0.5, 0.75, 0.95, 0.99, 0.999})
-			values["count"] = t.Count()
-			values["min"] = t.Min()
-			values["max"] = t.Max()
-			values["mean"] = t.Mean()
-			values["stddev"] = t.StdDev()
-			values["median"] = ps[0]
-			values["75%"] = ps[1]
-			values["95%"] = ps[2]
-			values["99%"] = ps[3]
-			values["99.9%"] = ps[4]
-			values["1m.rate"] = t.Rate1()
-			values["5m.rate"] = t.Rate5()
-			values["15m.rate"] = t.Rate15()
-			values["mean.rate"] = t.RateMean()
-		}
-		data[name] = values
-	})
-	return data
+	return r.snapshot(false).GetAll()
 }
 
 // Unregister the metric with the given name.
 func (r *StandardRegistry) Unregister(name string) {
+	defer r.dispatch()
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
+	r.unregister(name)
+}
+
+// Must be called with the write lock held.
+func (r *StandardRegistry) unregister(name string) {
+	i, ok := r.metrics[name]
+	if !ok {
+		return
+	}
 	r.stop(name)
 	delete(r.metrics, name)
+	delete(r.seen, name)
+	r.notify(MetricUnregistered, name, i)
 }
 
 // UnregisterAll unregisters all metrics in the registry. (Mostly for testing.)
 func (r *StandardRegistry) UnregisterAll() {
+	defer r.dispatch()
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 	for name := range r.metrics {
-		r.stop(name)
-		delete(r.metrics, name)
+		r.unregister(name)
 	}
 }
 
@@ -230,10 +236,13 @@ func (r *StandardRegistry) register(name string, i interface{}) error {
 		return DuplicateMetric(name)
 	}
 	switch i.(type) {
-	case Counter, Gauge, GaugeFloat64, Healthcheck, Histogram, Meter, Timer:
+	case Counter, Gauge, GaugeFloat64, Healthcheck, Histogram, Info, Meter, Timer:
+		i = r.track(name, i)
 		r.metrics[name] = i
+		r.notify(MetricRegistered, name, i)
+		return nil
 	}
-	return nil
+	return &UnsupportedMetric{Name: name, Metric: i}
 }
 
 type metricKV struct {
@@ -268,10 +277,24 @@ type Stoppable interface {
 }
 
 // PrefixedRegistry manages an underlying registry but exposes it with some
-// given prefix.
+// given prefix. Every operation is scoped to the metrics whose names start
+// with the prefix: Get, GetOrRegister, Register, SinkOnce and Unregister
+// prefix the given name, while Each, GetAll, Snapshot, Subscribe,
+// RunHealthchecks and UnregisterAll ignore the metrics of the underlying
+// registry which are outside of the prefix. Get, GetOrRegister and Unregister
+// also accept the names reported by Each. The underlying registry may be
+// any Registry, including another PrefixedRegistry.
+//
+// A registry created with NewPrefixedRegistry or NewPrefixedChildRegistry
+// keeps the prefix: Each, GetAll, Snapshot and Subscribe report the names
+// used by the underlying registries, i.e prefix.foo. A registry created with
+// NewScopedRegistry strips it, so that it reports foo, as if the metrics were
+// registered in a registry of their own.
 type PrefixedRegistry struct {
 	underlying Registry
 	prefix     string
+	scope      string // Prefix of the names as reported by the underlying registry.
+	strip      bool
 }
 
 // NewPrefixedRegistry creates a new PrefixedRegistry using the specified prefix.
@@ -279,56 +302,121 @@ func NewPrefixedRegistry(prefix string) Registry {
 	return &PrefixedRegistry{
 		underlying: NewRegistry(),
 		prefix:     prefix,
+		scope:      prefix,
 	}
 }
 
 // NewPrefixedChildRegistry creates a new PrefixedRegistry from an existing
 // parent registry and assigns the specified prefix.
 func NewPrefixedChildRegistry(parent Registry, prefix string) Registry {
+	_, scope := findPrefix(parent, prefix)
+	return &PrefixedRegistry{
+		underlying: parent,
+		prefix:     prefix,
+		scope:      scope,
+	}
+}
+
+// NewScopedRegistry creates a new PrefixedRegistry which registers metrics in
+// parent, or DefaultRegistry if parent is nil, under the specified prefix,
+// and strips the prefix from the names it reports. It lets a component
+// register and export its metrics without knowing where they are mounted.
+func NewScopedRegistry(parent Registry, prefix string) Registry {
+	if parent == nil {
+		parent = DefaultRegistry
+	}
+	_, scope := findPrefix(parent, prefix)
 	return &PrefixedRegistry{
 		underlying: parent,
 		prefix:     prefix,
+		scope:      scope,
+		strip:      true,
 	}
 }
 
 // Each calls the given function for each registered metric.
 func (r *PrefixedRegistry) Each(fn func(string, interface{})) {
-	wrappedFn := func(prefix string) func(string, interface{}) {
-		return func(name string, iface interface{}) {
-			if strings.HasPrefix(name, prefix) {
-				fn(name, iface)
-			} else {
-				return
-			}
+	r.underlying.Each(func(name string, i interface{}) {
+		if strings.HasPrefix(name, r.scope) {
+			fn(r.report(name), i)
+		}
+	})
+}
+
+// Returns the name which the registry reports for a name in its scope, as
+// reported by the underlying registry.
+func (r *PrefixedRegistry) report(name string) string {
+	if r.strip {
+		return name[len(r.scope):]
+	}
+	return name
+}
+
+// Returns the names of the registered metrics with the registry's prefix, as
+// reported by the underlying registry. The metrics stored with SinkOnce are
+// left queued.
+func (r *PrefixedRegistry) names() []string {
+	var names []string
+	for key, values := range r.underlying.GetAll() {
+		if name := getAllName(key, values); strings.HasPrefix(name, r.scope) {
+			names = append(names, name)
 		}
 	}
+	return names
+}
 
-	baseRegistry, prefix := findPrefix(r, "")
-	baseRegistry.Each(wrappedFn(prefix))
+func (r *PrefixedRegistry) underlyingRegistry(name string) (Registry, string) {
+	if r.strip {
+		return r.underlying, r.scope + name
+	}
+	if !strings.HasPrefix(name, r.scope) {
+		return nil, ""
+	}
+	return r.underlying, name
 }
 
+// Returns the innermost registry which reports the names given to registry
+// with prefix, and the accumulated prefix with which it reports them. It
+// looks through the PrefixedRegistries which keep their prefix, and the views
+// which report the names of their underlying registry unchanged, i.e a
+// FilteredRegistry.
 func findPrefix(registry Registry, prefix string) (Registry, string) {
-	switch r := registry.(type) {
-	case *PrefixedRegistry:
+	if r, ok := registry.(*PrefixedRegistry); ok {
+		if r.strip {
+			return registry, prefix
+		}
 		return findPrefix(r.underlying, r.prefix+prefix)
-	case *StandardRegistry:
-		return r, prefix
 	}
-	return nil, ""
+	if v, ok := registry.(registryView); ok {
+		if underlying, name := v.underlyingRegistry(prefix); underlying != nil && name == prefix {
+			return findPrefix(underlying, prefix)
+		}
+	}
+	return registry, prefix
 }
 
-// Get the metric by the given name or nil if none is registered.
+// Returns the name in the underlying registry of the metric which Get,
+// GetOrRegister and Unregister are given: a name reported by Each which is
+// registered, or else the name with the prefix.
+func (r *PrefixedRegistry) realName(name string) string {
+	if !r.strip && strings.HasPrefix(name, r.scope) && r.underlying.Get(name) != nil {
+		return name
+	}
+	return r.prefix + name
+}
+
+// Get the metric by the given name or nil if none is registered. The name is
+// either prefixed, or one reported by Each.
 func (r *PrefixedRegistry) Get(name string) interface{} {
-	realName := r.prefix + name
-	return r.underlying.Get(realName)
+	return r.underlying.Get(r.realName(name))
 }
 
 // GetOrRegister gets an existing metric or registers the given one.
 // The interface can be the metric to register if not found in registry,
-// or a function returning the metric for lazy instantiation.
+// or a function returning the metric for lazy instantiation. The name is
+// either prefixed, or one reported by Each.
 func (r *PrefixedRegistry) GetOrRegister(name string, metric interface{}) interface{} {
-	realName := r.prefix + name
-	return r.underlying.GetOrRegister(realName, metric)
+	return r.underlying.GetOrRegister(r.realName(name), metric)
 }
 
 // Register the given metric under the given name. The name will be prefixed.
@@ -338,30 +426,56 @@ func (r *PrefixedRegistry) Register(name string, metric interface{}) error {
 }
 
 // SinkOnce enqueues the given metric without registering it, allowing it to be
-// picked up by Each() only once.
+// picked up by Each() only once. The name will be prefixed.
 func (r *PrefixedRegistry) SinkOnce(name string, i interface{}) {
-	r.underlying.SinkOnce(name, i)
+	realName := r.prefix + name
+	r.underlying.SinkOnce(realName, i)
 }
 
-// RunHealthchecks runs all registered healthchecks.
+// RunHealthchecks runs the registered healthchecks with the registry's
+// prefix.
 func (r *PrefixedRegistry) RunHealthchecks() {
-	r.underlying.RunHealthchecks()
+	for _, name := range r.names() {
+		if h, ok := r.underlying.Get(name).(Healthcheck); ok {
+			h.Check()
+		}
+	}
 }
 
-// GetAll metrics in the Registry
+// GetAll metrics with the registry's prefix.
 func (r *PrefixedRegistry) GetAll() map[string]map[string]interface{} {
-	return r.underlying.GetAll()
+	data := make(map[string]map[string]interface{})
+	for name, values := range r.underlying.GetAll() {
+		if strings.HasPrefix(name, r.scope) {
+			data[r.report(name)] = values
+		}
+	}
+	return data
 }
 
-// Unregister the metric with the given name. The name will be prefixed.
+// Unregister the metric with the given name. The name is either prefixed, or
+// one reported by Each.
 func (r *PrefixedRegistry) Unregister(name string) {
-	realName := r.prefix + name
-	r.underlying.Unregister(realName)
+	r.underlying.Unregister(r.realName(name))
 }
 
-// UnregisterAll unregisters all metrics.  (Mostly for testing.)
+// UnregisterAll unregisters all metrics with the registry's prefix, leaving
+// the other metrics of the underlying registry registered.
 func (r *PrefixedRegistry) UnregisterAll() {
-	r.underlying.UnregisterAll()
+	for _, name := range r.names() {
+		r.underlying.Unregister(name)
+	}
+}
+
+// Subscribe calls f with every subsequent registration and unregistration of
+// a metric with the registry's prefix. Event names are reported as in Each.
+func (r *PrefixedRegistry) Subscribe(f func(RegistryEvent)) func() {
+	return r.underlying.Subscribe(func(e RegistryEvent) {
+		if strings.HasPrefix(e.Name, r.scope) {
+			e.Name = r.report(e.Name)
+			f(e)
+		}
+	})
 }
 
 // DefaultRegistry is a globally-scoped registry. The create/register functions
@@ -384,6 +498,33 @@ func GetOrRegister(name string, i interface{}) interface{} {
 	return DefaultRegistry.GetOrRegister(name, i)
 }
 
+// GetOrRegisterAs gets an existing metric or registers the given one, like
+// GetOrRegister, and returns it as a T, i.e a Counter. Unlike the type
+// assertion of GetOrRegisterCounter and friends, it does not panic: it
+// returns a *MismatchedMetric if the name is held by a metric of another
+// type, or an *UnsupportedMetric if i is not a supported metric type. The
+// interface can be the metric to register if not found in registry, or a
+// function returning the metric for lazy instantiation.
+func GetOrRegisterAs[T any](name string, r Registry, i interface{}) (T, error) {
+	if r == nil {
+		r = DefaultRegistry
+	}
+	var t T
+	metric := r.GetOrRegister(name, i)
+	if metricKind(metric) == "unknown" {
+		return t, &UnsupportedMetric{Name: name, Metric: metric}
+	}
+	t, ok := metric.(T)
+	if !ok {
+		return t, &MismatchedMetric{
+			Name:   name,
+			Metric: metric,
+			Want:   reflect.TypeOf((*T)(nil)).Elem(),
+		}
+	}
+	return t, nil
+}
+
 // Register the given metric under the given name.  Returns a DuplicateMetric
 // if a metric by the given name is already registered.
 func Register(name string, i interface{}) error {
@@ -413,3 +554,9 @@ func RunHealthchecks() {
 func Unregister(name string) {
 	DefaultRegistry.Unregister(name)
 }
+
+// Subscribe calls f with every subsequent registration and unregistration of
+// a metric in DefaultRegistry, until the returned function is called.
+func Subscribe(f func(RegistryEvent)) func() {
+	return DefaultRegistry.Subscribe(f)
+}
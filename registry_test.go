@@ -2,6 +2,7 @@ package metrics
 
 import (
 	"fmt"
+	"sort"
 	"sync"
 	"testing"
 )
@@ -84,6 +85,39 @@ func TestRegistryDuplicate(t *testing.T) {
 	}
 }
 
+func TestRegistryUnsupported(t *testing.T) {
+	r := NewRegistry()
+	err := r.Register("foo", "bar")
+	if e, ok := err.(*UnsupportedMetric); !ok || e.Name != "foo" {
+		t.Fatal(err)
+	}
+	if r.Get("foo") != nil {
+		t.Fatal(r.Get("foo"))
+	}
+}
+
+func TestGetOrRegisterAs(t *testing.T) {
+	r := NewRegistry()
+	c, err := GetOrRegisterAs[Counter]("foo", r, NewCounter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Inc(1)
+	if c, err := GetOrRegisterAs[Counter]("foo", r, NewCounter); err != nil || c.Count() != 1 {
+		t.Fatal(c, err)
+	}
+	g, err := GetOrRegisterAs[Gauge]("foo", r, NewGauge)
+	if e, ok := err.(*MismatchedMetric); !ok || e.Want.Name() != "Gauge" || g != nil {
+		t.Fatal(g, err)
+	}
+	if err.Error() != "metric foo is a *metrics.StandardCounter, not a metrics.Gauge" {
+		t.Error(err)
+	}
+	if _, err := GetOrRegisterAs[string]("bar", r, "baz"); err == nil {
+		t.Fatal("GetOrRegisterAs(): expected an error for an unsupported type")
+	}
+}
+
 func TestRegistryGet(t *testing.T) {
 	r := NewRegistry()
 	r.Register("foo", NewCounter())
@@ -344,6 +378,152 @@ func TestWalkRegistries(t *testing.T) {
 	}
 }
 
+func TestPrefixedRegistryOfAnyRegistry(t *testing.T) {
+	r := NewPrefixedChildRegistry(NewLimitedRegistry(NewRegistry(), CardinalityLimits{}), "prefix.")
+	GetOrRegisterCounter("foo", r)
+	i := 0
+	r.Each(func(name string, m interface{}) {
+		i++
+		if name != "prefix.foo" {
+			t.Fatal(name)
+		}
+	})
+	if i != 1 {
+		t.Fatal(i)
+	}
+}
+
+func TestPrefixedRegistryOfView(t *testing.T) {
+	parent := NewRegistry()
+	prefixed := NewPrefixedChildRegistry(parent, "a.")
+	filtered, _ := NewFilteredRegistry(prefixed, RegistryFilter{})
+	for _, view := range []Registry{filtered, NewLimitedRegistry(prefixed, CardinalityLimits{})} {
+		r := NewPrefixedChildRegistry(view, "b.")
+		GetOrRegisterCounter("foo", r)
+		var names []string
+		r.Each(func(name string, i interface{}) { names = append(names, name) })
+		if len(names) != 1 || names[0] != "a.b.foo" {
+			t.Errorf("Each(): %v != [a.b.foo]", names)
+		}
+		r.UnregisterAll()
+		if parent.Get("a.b.foo") != nil {
+			t.Error("UnregisterAll(): a.b.foo still registered")
+		}
+	}
+}
+
+func TestPrefixedRegistryScope(t *testing.T) {
+	parent := NewRegistry()
+	r := NewPrefixedChildRegistry(parent, "prefix.")
+	GetOrRegisterCounter("bar", parent)
+	GetOrRegisterCounter("foo", r)
+	checked := false
+	r.Register("check", NewHealthcheck(func(Healthcheck) { checked = true }))
+	parent.Register("other", NewHealthcheck(func(Healthcheck) { t.Error("RunHealthchecks(): ran other") }))
+
+	if all := r.GetAll(); len(all) != 2 || all["prefix.foo"] == nil {
+		t.Errorf("GetAll(): %v", all)
+	}
+	r.RunHealthchecks()
+	if !checked {
+		t.Error("RunHealthchecks(): did not run prefix.check")
+	}
+
+	r.SinkOnce("baz", NewGauge())
+	if parent.Snapshot().Get("prefix.baz") == nil {
+		t.Error("SinkOnce(): name not prefixed")
+	}
+
+	r.UnregisterAll()
+	if parent.Get("bar") == nil || parent.Get("other") == nil {
+		t.Error("UnregisterAll(): unregistered metrics outside of the prefix")
+	}
+	if parent.Get("prefix.foo") != nil {
+		t.Error("UnregisterAll(): prefix.foo still registered")
+	}
+}
+
+func TestPrefixedRegistryKeepsSinkOnce(t *testing.T) {
+	parent := NewRegistry()
+	r := NewPrefixedChildRegistry(parent, "prefix.")
+	GetOrRegisterCounter("foo", r)
+	parent.SinkOnce("other", NewGauge())
+	r.RunHealthchecks()
+	r.UnregisterAll()
+	if parent.Snapshot().Get("other") == nil {
+		t.Error("RunHealthchecks(), UnregisterAll(): dequeued the parent's SinkOnce metrics")
+	}
+}
+
+func TestPrefixedRegistryUnregisterAllLabeled(t *testing.T) {
+	parent := NewRegistry()
+	r := NewPrefixedChildRegistry(parent, "prefix.")
+	r.Register("foo", WithLabels(NewCounter(), map[string]string{"k": "v"}))
+	r.UnregisterAll()
+	if parent.Get("prefix.foo") != nil {
+		t.Error("UnregisterAll(): labeled prefix.foo still registered")
+	}
+}
+
+func TestPrefixedRegistryGetEachNames(t *testing.T) {
+	parent := NewRegistry()
+	registries := []Registry{
+		NewPrefixedChildRegistry(parent, "svc."),
+		NewPrefixedChildRegistry(NewPrefixedChildRegistry(parent, "a."), "b."),
+		NewScopedRegistry(parent, "scoped."),
+		NewPrefixedChildRegistry(NewScopedRegistry(parent, "c."), "d."),
+	}
+	for _, r := range registries {
+		GetOrRegisterCounter("hits", r)
+		r.Each(func(name string, i interface{}) {
+			if m := r.Get(name); m != i {
+				t.Errorf("Get(%q): %v != %v", name, m, i)
+			}
+			if m := r.GetOrRegister(name, NewCounter()); m != i {
+				t.Errorf("GetOrRegister(%q): %v != %v", name, m, i)
+			}
+		})
+		var names []string
+		r.Each(func(name string, i interface{}) { names = append(names, name) })
+		for _, name := range names {
+			r.Unregister(name)
+		}
+		if m := r.Get("hits"); m != nil {
+			t.Errorf("Unregister(%v): hits still registered", names)
+		}
+	}
+}
+
+func TestScopedRegistry(t *testing.T) {
+	parent := NewRegistry()
+	r := NewScopedRegistry(NewPrefixedChildRegistry(parent, "a."), "b.")
+	child := NewPrefixedChildRegistry(r, "c.")
+	var events []string
+	defer child.Subscribe(func(e RegistryEvent) { events = append(events, e.Name) })()
+	GetOrRegisterCounter("foo", r)
+	GetOrRegisterCounter("bar", child)
+	GetOrRegisterCounter("a.other", parent)
+
+	if parent.Get("a.b.foo") == nil || parent.Get("a.b.c.bar") == nil {
+		t.Fatal("GetOrRegister(): unexpected names in parent")
+	}
+	var names []string
+	r.Each(func(name string, m interface{}) { names = append(names, name) })
+	sort.Strings(names)
+	if len(names) != 2 || names[0] != "c.bar" || names[1] != "foo" {
+		t.Errorf("Each(): %v != [c.bar foo]", names)
+	}
+	if all := r.GetAll(); len(all) != 2 || all["foo"] == nil {
+		t.Errorf("GetAll(): %v", all)
+	}
+	if s := child.Snapshot(); len(s) != 1 || s[0].Name != "c.bar" {
+		t.Errorf("Snapshot(): %v", s)
+	}
+	if len(events) != 1 || events[0] != "c.bar" {
+		t.Errorf("Subscribe(): %v != [c.bar]", events)
+	}
+}
+
 func TestConcurrentRegistryAccess(t *testing.T) {
 	r := NewRegistry()
 
@@ -0,0 +1,201 @@
+package metrics
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// NewRegistryWithTTL creates a new registry which unregisters metrics that
+// have not been updated for longer than ttl, so that metrics created on
+// demand, i.e per customer or per endpoint with GetOrRegisterTimer, do not
+// live forever.
+//
+// A metric counts as updated when it is retrieved with GetOrRegister, or when
+// its value changes, i.e a Counter's count or a Timer's number of events. Get
+// does not count as an update, so that exporters do not keep idle metrics
+// alive. The registry stores StandardCounters, StandardGauges and
+// StandardGaugeFloat64s in a wrapper which also counts the updates that leave
+// their value unchanged, so Get and GetOrRegister return the wrapper, and the
+// updates made through the registered metric itself only count if they change
+// its value.
+// Healthchecks and Infos never expire. Expired metrics are stopped if they
+// are Stoppable and passed to onEvict, which may be nil. Expiry happens
+// whenever the registry is iterated, i.e by an exporter, or when Expire is
+// called. Idle metrics are looked for under the read lock, so that iterating
+// the registry only blocks its users when metrics expire.
+func NewRegistryWithTTL(ttl time.Duration, onEvict func(name string, metric interface{})) *StandardRegistry {
+	return &StandardRegistry{
+		metrics:   make(map[string]interface{}),
+		ttl:       ttl,
+		onEvict:   onEvict,
+		evictions: NewCounter(),
+		seen:      make(map[string]*ttlEntry),
+		now:       time.Now,
+	}
+}
+
+// Evictions returns the number of metrics expired by the registry. It is not
+// registered, and is nil unless the registry was created with
+// NewRegistryWithTTL.
+func (r *StandardRegistry) Evictions() Counter {
+	return r.evictions
+}
+
+// Expire unregisters the metrics that have not been updated for longer than
+// the registry's TTL. It is a no-op unless the registry was created with
+// NewRegistryWithTTL.
+func (r *StandardRegistry) Expire() {
+	if r.ttl <= 0 {
+		return
+	}
+	now := r.now()
+	var idle []string
+	r.mutex.RLock()
+	for name, e := range r.seen {
+		if e.idle(r.metrics[name], now, r.ttl) {
+			idle = append(idle, name)
+		}
+	}
+	r.mutex.RUnlock()
+	if len(idle) == 0 {
+		return
+	}
+
+	var evicted []metricKV
+	defer r.dispatch()
+	r.mutex.Lock()
+	for _, name := range idle {
+		// The metric may have been updated or replaced since.
+		e, ok := r.seen[name]
+		if !ok || !e.idle(r.metrics[name], now, r.ttl) {
+			continue
+		}
+		evicted = append(evicted, metricKV{name, r.metrics[name]})
+		r.unregister(name)
+	}
+	r.mutex.Unlock()
+
+	r.evictions.Inc(int64(len(evicted)))
+	if r.onEvict != nil {
+		for _, kv := range evicted {
+			r.onEvict(kv.name, kv.value)
+		}
+	}
+}
+
+// The last observed state of a metric of a registry with a TTL.
+type ttlEntry struct {
+	mutex       sync.Mutex // Held while observing the metric.
+	fingerprint interface{}
+	lastSeen    int64       // Unix nanoseconds, accessed atomically.
+	updated     atomic.Bool // Whether a wrapper saw an update since.
+}
+
+// Records whether the metric i was updated since it was last observed, and
+// reports whether it has not been updated for ttl.
+func (e *ttlEntry) idle(i interface{}, now time.Time, ttl time.Duration) bool {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if fp := fingerprint(i); e.updated.Swap(false) || fp != e.fingerprint {
+		e.fingerprint = fp
+		atomic.StoreInt64(&e.lastSeen, now.UnixNano())
+		return false
+	}
+	return now.Sub(time.Unix(0, atomic.LoadInt64(&e.lastSeen))) >= ttl
+}
+
+// Starts tracking a newly registered metric, and returns the metric to store
+// in its place. Must be called with the write lock held.
+func (r *StandardRegistry) track(name string, i interface{}) interface{} {
+	if r.ttl <= 0 {
+		return i
+	}
+	switch i.(type) {
+	case Healthcheck, Info:
+		return i
+	}
+	e := &ttlEntry{
+		fingerprint: fingerprint(i),
+		lastSeen:    r.now().UnixNano(),
+	}
+	r.seen[name] = e
+	switch metric := i.(type) {
+	case *StandardCounter:
+		return ttlCounter{metric, e}
+	case *StandardGauge:
+		return ttlGauge{metric, e}
+	case *StandardGaugeFloat64:
+		return ttlGaugeFloat64{metric, e}
+	}
+	return i
+}
+
+// Marks a metric as updated. Must be called with at least the read lock held.
+func (r *StandardRegistry) touch(name string) {
+	if e, ok := r.seen[name]; ok {
+		atomic.StoreInt64(&e.lastSeen, r.now().UnixNano())
+	}
+}
+
+// Returns a comparable value which changes whenever the metric is updated.
+func fingerprint(i interface{}) interface{} {
+	switch metric := i.(type) {
+	case Counter:
+		return metric.Count()
+	case Gauge:
+		return metric.Value()
+	case GaugeFloat64:
+		return metric.Value()
+	case Histogram:
+		return metric.Count()
+	case Meter:
+		return metric.Count()
+	case Timer:
+		return metric.Count()
+	}
+	return nil
+}
+
+// The wrappers in which a registry with a TTL stores the metrics whose
+// updates may leave their value unchanged.
+
+type ttlCounter struct {
+	*StandardCounter
+	entry *ttlEntry
+}
+
+func (c ttlCounter) Clear() {
+	c.StandardCounter.Clear()
+	c.entry.updated.Store(true)
+}
+
+func (c ttlCounter) Dec(i int64) {
+	c.StandardCounter.Dec(i)
+	c.entry.updated.Store(true)
+}
+
+func (c ttlCounter) Inc(i int64) {
+	c.StandardCounter.Inc(i)
+	c.entry.updated.Store(true)
+}
+
+type ttlGauge struct {
+	*StandardGauge
+	entry *ttlEntry
+}
+
+func (g ttlGauge) Update(v int64) {
+	g.StandardGauge.Update(v)
+	g.entry.updated.Store(true)
+}
+
+type ttlGaugeFloat64 struct {
+	*StandardGaugeFloat64
+	entry *ttlEntry
+}
+
+func (g ttlGaugeFloat64) Update(v float64) {
+	g.StandardGaugeFloat64.Update(v)
+	g.entry.updated.Store(true)
+}
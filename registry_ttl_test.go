@@ -0,0 +1,134 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRegistryTTL(t *testing.T) {
+	var evicted []string
+	r := NewRegistryWithTTL(time.Minute, func(name string, metric interface{}) {
+		evicted = append(evicted, name)
+	})
+	now := time.Unix(1700000000, 0)
+	r.now = func() time.Time { return now }
+
+	idle := GetOrRegisterCounter("idle", r)
+	busy := GetOrRegisterCounter("busy", r)
+	GetOrRegisterCounter("retrieved", r)
+	GetOrRegisterTimer("timer", r)
+	stoppable := &stoppableCounter{Counter: NewCounter()}
+	r.Register("stoppable", stoppable)
+	NewRegisteredInfo("info", r, nil)
+
+	now = now.Add(45 * time.Second)
+	busy.Inc(1)
+	GetOrRegisterCounter("retrieved", r)
+	r.Expire()
+	if len(evicted) != 0 {
+		t.Fatalf("Expire(): evicted %v before the TTL", evicted)
+	}
+
+	now = now.Add(30 * time.Second)
+	r.Each(func(string, interface{}) {})
+	if len(evicted) != 3 {
+		t.Fatalf("Each(): evicted %v, expected idle, stoppable and timer", evicted)
+	}
+	for _, name := range []string{"idle", "stoppable", "timer"} {
+		if r.Get(name) != nil {
+			t.Errorf("%s: still registered", name)
+		}
+	}
+	for _, name := range []string{"busy", "retrieved", "info"} {
+		if r.Get(name) == nil {
+			t.Errorf("%s: evicted", name)
+		}
+	}
+	if !stoppable.stopped {
+		t.Error("stoppable: not stopped on eviction")
+	}
+	if c := r.Evictions().Count(); c != 3 {
+		t.Errorf("Evictions(): 3 != %d", c)
+	}
+
+	// A re-registered metric starts afresh.
+	if c := GetOrRegisterCounter("idle", r); c == idle || c.Count() != 0 {
+		t.Error("idle: expected a new counter after eviction")
+	}
+}
+
+func TestRegistryTTLUnchangedValue(t *testing.T) {
+	r := NewRegistryWithTTL(time.Minute, nil)
+	now := time.Unix(1700000000, 0)
+	r.now = func() time.Time { return now }
+
+	g := GetOrRegisterGauge("gauge", r)
+	f := GetOrRegisterGaugeFloat64("float", r)
+	c := GetOrRegisterCounter("counter", r)
+	for i := 0; i < 4; i++ {
+		now = now.Add(45 * time.Second)
+		g.Update(0)
+		f.Update(1.5)
+		c.Inc(0)
+		r.Expire()
+	}
+	for _, name := range []string{"gauge", "float", "counter"} {
+		if r.Get(name) == nil {
+			t.Errorf("%s: evicted while updated with an unchanged value", name)
+		}
+	}
+
+	now = now.Add(2 * time.Minute)
+	r.Expire()
+	if c := r.Evictions().Count(); c != 3 {
+		t.Errorf("Evictions(): 3 != %d", c)
+	}
+}
+
+func TestRegistryTTLExpireReadLocked(t *testing.T) {
+	r := NewRegistryWithTTL(time.Minute, nil)
+	GetOrRegisterCounter("foo", r).Inc(1)
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	done := make(chan struct{})
+	go func() {
+		r.Expire()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expire(): took the write lock without expiring metrics")
+	}
+}
+
+func TestRegistryTTLRegisteredCounter(t *testing.T) {
+	r := NewRegistryWithTTL(time.Minute, nil)
+	c := NewCounter()
+	if err := r.Register("foo", c); err != nil {
+		t.Fatal(err)
+	}
+	c.Inc(2)
+	if got := GetOrRegisterCounter("foo", r); got.Count() != 2 {
+		t.Errorf("GetOrRegisterCounter(): %v != 2", got.Count())
+	}
+}
+
+func TestRegistryWithoutTTL(t *testing.T) {
+	r := NewRegistry().(*StandardRegistry)
+	GetOrRegisterCounter("foo", r)
+	r.Expire()
+	if r.Get("foo") == nil {
+		t.Error("Expire(): evicted from a registry without a TTL")
+	}
+	if r.Evictions() != nil {
+		t.Error("Evictions(): expected nil without a TTL")
+	}
+}
+
+type stoppableCounter struct {
+	Counter
+	stopped bool
+}
+
+func (c *stoppableCounter) Stop() { c.stopped = true }
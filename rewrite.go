@@ -0,0 +1,307 @@
+package metrics
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// NameCase is a case conversion applied by a RewriteRule.
+type NameCase int
+
+const (
+	// KeepCase leaves the case of names unchanged.
+	KeepCase NameCase = iota
+
+	// LowerCase converts names to lower case.
+	LowerCase
+
+	// UpperCase converts names to upper case.
+	UpperCase
+
+	// SnakeCase converts camel case words to lower case words separated by
+	// underscores, i.e MemStats.HeapAlloc to mem_stats.heap_alloc.
+	SnakeCase
+)
+
+// RewriteRule is a step of the rewriting of names by a RewriteRegistry. The
+// steps of a rule are applied in the order of its fields; empty fields are
+// skipped.
+type RewriteRule struct {
+	// Match is a pattern, as in RegistryFilter, of the names which the rule
+	// rewrites, or empty to rewrite every name. It is matched against the
+	// name as rewritten by the previous rules.
+	Match string
+
+	// Template extracts labels from the dot-separated segments of names,
+	// i.e http.{method}.{status} rewrites http.GET.200 to http with the
+	// labels method=GET and status=200. Other segments must be equal to
+	// the name's, or *. Names with a different number of segments are not
+	// changed.
+	Template string
+
+	// Regexp is a regular expression replaced by Replacement in names,
+	// which may refer to its submatches, i.e ${1}.
+	Regexp      string
+	Replacement string
+
+	Case   NameCase
+	Prefix string // Prepended to names.
+	Suffix string // Appended to names.
+}
+
+// RewriteRegistry is a view of a Registry which renames its metrics and
+// attaches labels to them with a pipeline of RewriteRules, so that each
+// exporter can be given names in the convention of its backend, i.e
+// underscores for Prometheus.
+//
+// Each, GetAll, Snapshot and Subscribe report the rewritten names, and the
+// labels extracted by the rules as the metrics' MetricLabels. Every other
+// method is passed to the underlying registry unchanged. Names which are
+// rewritten to the same name and labels are reported separately. To filter
+// the metrics, prefer rewriting a FilteredRegistry to filtering a
+// RewriteRegistry, since looking up a rewritten name searches every name of
+// the underlying registry.
+type RewriteRegistry struct {
+	underlying Registry
+	rules      []rewriteRule
+}
+
+// A compiled RewriteRule.
+type rewriteRule struct {
+	RewriteRule
+	match    *regexp.Regexp
+	template []string
+	regexp   *regexp.Regexp
+}
+
+// NewRewriteRegistry creates a new RewriteRegistry over r, or DefaultRegistry
+// if r is nil, which applies the rules in order. Returns an error if a
+// pattern or regular expression of a rule is invalid.
+func NewRewriteRegistry(r Registry, rules []RewriteRule) (*RewriteRegistry, error) {
+	if r == nil {
+		r = DefaultRegistry
+	}
+	compiled := make([]rewriteRule, 0, len(rules))
+	for _, rule := range rules {
+		c := rewriteRule{RewriteRule: rule}
+		var err error
+		if rule.Match != "" {
+			if c.match, err = compilePattern(rule.Match); err != nil {
+				return nil, err
+			}
+		}
+		if rule.Template != "" {
+			c.template = strings.Split(rule.Template, ".")
+		}
+		if rule.Regexp != "" {
+			if c.regexp, err = regexp.Compile(rule.Regexp); err != nil {
+				return nil, err
+			}
+		}
+		compiled = append(compiled, c)
+	}
+	return &RewriteRegistry{underlying: r, rules: compiled}, nil
+}
+
+// Rewrite returns the rewritten name and the extracted labels of a metric
+// named name in the underlying registry. The labels are nil if none were
+// extracted.
+func (r *RewriteRegistry) Rewrite(name string) (string, map[string]string) {
+	var labels map[string]string
+	for _, rule := range r.rules {
+		if rule.match != nil && !rule.match.MatchString(name) {
+			continue
+		}
+		if rule.template != nil {
+			name, labels = extractLabels(rule.template, name, labels)
+		}
+		if rule.regexp != nil {
+			name = rule.regexp.ReplaceAllString(name, rule.Replacement)
+		}
+		switch rule.Case {
+		case LowerCase:
+			name = strings.ToLower(name)
+		case UpperCase:
+			name = strings.ToUpper(name)
+		case SnakeCase:
+			name = snakeCase(name)
+		}
+		name = rule.Prefix + name + rule.Suffix
+	}
+	return name, labels
+}
+
+// Each calls the given function for each registered metric, with its
+// rewritten name.
+func (r *RewriteRegistry) Each(f func(string, interface{})) {
+	r.underlying.Each(func(name string, i interface{}) {
+		name, labels := r.Rewrite(name)
+		f(name, WithLabels(i, labels))
+	})
+}
+
+// Get the metric by the given name in the underlying registry, or nil if none
+// is registered.
+func (r *RewriteRegistry) Get(name string) interface{} {
+	return r.underlying.Get(name)
+}
+
+// GetAll metrics in the Registry, with their rewritten names. Metrics with
+// labels are keyed by their name followed by their labels, i.e
+// http{method="GET"}, and their values include the labels.
+func (r *RewriteRegistry) GetAll() map[string]map[string]interface{} {
+	data := make(map[string]map[string]interface{})
+	for name, values := range r.underlying.GetAll() {
+		name, labels := r.Rewrite(name)
+		if len(labels) > 0 {
+			existing, _ := values["labels"].(map[string]string)
+			values["labels"] = mergeLabels(existing, labels)
+			name += formatLabels(labels)
+		}
+		data[name] = values
+	}
+	return data
+}
+
+// GetOrRegister gets an existing metric or registers the given one in the
+// underlying registry.
+func (r *RewriteRegistry) GetOrRegister(name string, i interface{}) interface{} {
+	return r.underlying.GetOrRegister(name, i)
+}
+
+// Register the given metric under the given name in the underlying registry.
+func (r *RewriteRegistry) Register(name string, i interface{}) error {
+	return r.underlying.Register(name, i)
+}
+
+// SinkOnce enqueues the given metric in the underlying registry.
+func (r *RewriteRegistry) SinkOnce(name string, i interface{}) {
+	r.underlying.SinkOnce(name, i)
+}
+
+// RunHealthchecks runs all registered healthchecks.
+func (r *RewriteRegistry) RunHealthchecks() {
+	r.underlying.RunHealthchecks()
+}
+
+// Unregister the metric with the given name from the underlying registry.
+func (r *RewriteRegistry) Unregister(name string) {
+	r.underlying.Unregister(name)
+}
+
+// UnregisterAll unregisters all metrics.  (Mostly for testing.)
+func (r *RewriteRegistry) UnregisterAll() {
+	r.underlying.UnregisterAll()
+}
+
+// Snapshot returns a RegistrySnapshot of the underlying registry, with the
+// rewritten names.
+func (r *RewriteRegistry) Snapshot() RegistrySnapshot {
+	s := r.underlying.Snapshot()
+	rewritten := make(RegistrySnapshot, 0, len(s))
+	for _, m := range s {
+		name, labels := r.Rewrite(m.Name)
+		rewritten = append(rewritten, MetricSnapshot{Name: name, Metric: WithLabels(m.Metric, labels)})
+	}
+	sort.SliceStable(rewritten, func(i, j int) bool { return rewritten[i].Name < rewritten[j].Name })
+	return rewritten
+}
+
+// Subscribe calls f with every subsequent registration and unregistration of
+// a metric, with its rewritten name.
+func (r *RewriteRegistry) Subscribe(f func(RegistryEvent)) func() {
+	return r.underlying.Subscribe(func(e RegistryEvent) {
+		var labels map[string]string
+		e.Name, labels = r.Rewrite(e.Name)
+		e.Metric = WithLabels(e.Metric, labels)
+		f(e)
+	})
+}
+
+// Rewritten names cannot be reversed, so the names of the underlying registry
+// are searched for one which is rewritten to name. Names rewritten to the same
+// name resolve to any of them.
+func (r *RewriteRegistry) underlyingRegistry(name string) (Registry, string) {
+	if original, ok := r.originalNames()[name]; ok {
+		return r.underlying, original
+	}
+	return nil, ""
+}
+
+// Returns the names of the underlying registry by their rewritten names.
+func (r *RewriteRegistry) originalNames() map[string]string {
+	names := make(map[string]string)
+	for key, values := range r.underlying.GetAll() {
+		original := getAllName(key, values)
+		rewritten, _ := r.Rewrite(original)
+		names[rewritten] = original
+	}
+	return names
+}
+
+// Matches name against the segments of a template, and returns the name
+// without the label segments and the labels added to labels.
+func extractLabels(template []string, name string, labels map[string]string) (string, map[string]string) {
+	segments := strings.Split(name, ".")
+	if len(segments) != len(template) {
+		return name, labels
+	}
+	extracted := map[string]string{}
+	kept := make([]string, 0, len(segments))
+	for i, t := range template {
+		switch {
+		case len(t) > 2 && t[0] == '{' && t[len(t)-1] == '}':
+			extracted[t[1:len(t)-1]] = segments[i]
+		case t == "*" || t == segments[i]:
+			kept = append(kept, segments[i])
+		default:
+			return name, labels
+		}
+	}
+	return strings.Join(kept, "."), mergeLabels(labels, extracted)
+}
+
+// Converts the camel case words of name to lower case words separated by
+// underscores.
+func snakeCase(name string) string {
+	var b strings.Builder
+	runes := []rune(name)
+	for i, c := range runes {
+		if unicode.IsUpper(c) && i > 0 {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) ||
+				(unicode.IsUpper(prev) && nextLower) {
+				b.WriteRune('_')
+			}
+		}
+		b.WriteRune(unicode.ToLower(c))
+	}
+	return b.String()
+}
+
+// Formats labels as {k="v",...}, sorted by name.
+func formatLabels(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = fmt.Sprintf("%s=%q", k, labels[k])
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// Returns the name under which Each reports the metric whose values GetAll
+// returned under key, i.e http for http{method="GET"}.
+func getAllName(key string, values map[string]interface{}) string {
+	if labels, _ := values["labels"].(map[string]string); len(labels) > 0 {
+		return strings.TrimSuffix(key, formatLabels(labels))
+	}
+	return key
+}
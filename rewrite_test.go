@@ -0,0 +1,98 @@
+package metrics
+
+import "testing"
+
+func TestRewriteRegistryRewrite(t *testing.T) {
+	r, err := NewRewriteRegistry(nil, []RewriteRule{
+		{Match: "http.**", Template: "http.{method}.{status}.*"},
+		{Match: "runtime.**", Case: SnakeCase},
+		{Regexp: `\.`, Replacement: "_"},
+		{Prefix: "app_", Suffix: "_total", Match: "/^http/"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name, want string
+		labels     map[string]string
+	}{
+		{"http.GET.200.latency", "app_http_latency_total", map[string]string{"method": "GET", "status": "200"}},
+		{"http.GET.latency", "app_http_GET_latency_total", nil},
+		{"runtime.MemStats.HeapAlloc", "runtime_mem_stats_heap_alloc", nil},
+		{"runtime.HTTPServer", "runtime_http_server", nil},
+	}
+	for _, tt := range tests {
+		name, labels := r.Rewrite(tt.name)
+		if name != tt.want {
+			t.Errorf("Rewrite(%q): %q != %q", tt.name, name, tt.want)
+		}
+		if len(labels) != len(tt.labels) {
+			t.Errorf("Rewrite(%q): labels %v != %v", tt.name, labels, tt.labels)
+		}
+		for k, v := range tt.labels {
+			if labels[k] != v {
+				t.Errorf("Rewrite(%q): labels %v != %v", tt.name, labels, tt.labels)
+			}
+		}
+	}
+}
+
+func TestRewriteRegistry(t *testing.T) {
+	parent := NewRegistry()
+	GetOrRegisterCounter("http.GET.count", parent).Inc(1)
+	GetOrRegisterCounter("http.POST.count", parent).Inc(2)
+	r, err := NewRewriteRegistry(parent, []RewriteRule{{Template: "http.{method}.count"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var events []string
+	defer r.Subscribe(func(e RegistryEvent) {
+		events = append(events, e.Name+formatLabels(MetricLabels(e.Metric)))
+	})()
+
+	s := r.Snapshot()
+	if len(s) != 2 || s[0].Name != "http.count" || s[1].Name != "http.count" {
+		t.Fatalf("Snapshot(): %v", s)
+	}
+	c := s[0].Metric.(Counter)
+	if c.Count() != 1 || MetricLabels(c)["method"] != "GET" {
+		t.Errorf("Snapshot(): %d %v", c.Count(), MetricLabels(c))
+	}
+	if MetricLabels(c.Snapshot())["method"] != "GET" {
+		t.Error("Snapshot(): labels lost by Snapshot")
+	}
+
+	all := r.GetAll()
+	if v := all[`http.count{method="POST"}`]; v == nil || v["count"] != int64(2) {
+		t.Errorf("GetAll(): %v", all)
+	}
+
+	GetOrRegisterCounter("http.PUT.count", r)
+	if len(events) != 1 || events[0] != `http.count{method="PUT"}` {
+		t.Errorf("Subscribe(): %v", events)
+	}
+}
+
+func TestWithLabels(t *testing.T) {
+	labels := map[string]string{"a": "b"}
+	metrics := []interface{}{
+		NewCounter(), NewGauge(), NewGaugeFloat64(), NewHealthcheck(nil),
+		NewHistogram(NewUniformSample(10)), NewMeter(), NewTimer(),
+		NewInfo(map[string]string{"c": "d"}),
+	}
+	for _, m := range metrics {
+		labeled := WithLabels(m, labels)
+		if metricKind(labeled) != metricKind(m) {
+			t.Errorf("WithLabels(%T): %s != %s", m, metricKind(labeled), metricKind(m))
+		}
+		if MetricLabels(labeled)["a"] != "b" {
+			t.Errorf("WithLabels(%T): %v", m, MetricLabels(labeled))
+		}
+		if MetricLabels(snapshotMetric(labeled))["a"] != "b" {
+			t.Errorf("WithLabels(%T): labels lost by snapshot", m)
+		}
+	}
+	if MetricLabels(NewCounter()) != nil {
+		t.Error("MetricLabels(): expected nil")
+	}
+}
@@ -1,6 +1,8 @@
 package metrics
 
 import (
+	"context"
+	"errors"
 	"runtime"
 	"runtime/pprof"
 	"sync"
@@ -8,8 +10,20 @@ import (
 )
 
 var (
-	memStats       runtime.MemStats
-	runtimeMetrics struct {
+	runtimeCollectors = map[Registry]*RuntimeCollector{}
+	runtimeMutex      sync.Mutex
+
+	threadCreateProfile = pprof.Lookup("threadcreate")
+)
+
+// RuntimeCollector captures the Go runtime statistics exported in
+// runtime.MemStats into the metrics of a single registry. Each collector
+// tracks its own deltas, so collectors for different registries are
+// independent of each other.
+type RuntimeCollector struct {
+	mutex    sync.Mutex
+	memStats runtime.MemStats
+	metrics  struct {
 		MemStats struct {
 			Alloc         Gauge
 			BuckHashSys   Gauge
@@ -49,171 +63,190 @@ var (
 	mallocs     uint64
 	numGC       uint32
 	numCgoCalls int64
+}
 
-	threadCreateProfile        = pprof.Lookup("threadcreate")
-	registerRuntimeMetricsOnce = sync.Once{}
-)
+// NewRuntimeCollector constructs a new RuntimeCollector and registers its
+// metrics in r. The metrics are named by their fully-qualified Go symbols,
+// i.e. runtime.MemStats.Alloc. Metrics that already exist in r are reused.
+func NewRuntimeCollector(r Registry) *RuntimeCollector {
+	if r == nil {
+		r = DefaultRegistry
+	}
+	c := &RuntimeCollector{}
+	m := &c.metrics
+	m.MemStats.Alloc = GetOrRegisterGauge("runtime.MemStats.Alloc", r)
+	m.MemStats.BuckHashSys = GetOrRegisterGauge("runtime.MemStats.BuckHashSys", r)
+	m.MemStats.DebugGC = GetOrRegisterGauge("runtime.MemStats.DebugGC", r)
+	m.MemStats.EnableGC = GetOrRegisterGauge("runtime.MemStats.EnableGC", r)
+	m.MemStats.Frees = GetOrRegisterGauge("runtime.MemStats.Frees", r)
+	m.MemStats.HeapAlloc = GetOrRegisterGauge("runtime.MemStats.HeapAlloc", r)
+	m.MemStats.HeapIdle = GetOrRegisterGauge("runtime.MemStats.HeapIdle", r)
+	m.MemStats.HeapInuse = GetOrRegisterGauge("runtime.MemStats.HeapInuse", r)
+	m.MemStats.HeapObjects = GetOrRegisterGauge("runtime.MemStats.HeapObjects", r)
+	m.MemStats.HeapReleased = GetOrRegisterGauge("runtime.MemStats.HeapReleased", r)
+	m.MemStats.HeapSys = GetOrRegisterGauge("runtime.MemStats.HeapSys", r)
+	m.MemStats.LastGC = GetOrRegisterGauge("runtime.MemStats.LastGC", r)
+	m.MemStats.Lookups = GetOrRegisterGauge("runtime.MemStats.Lookups", r)
+	m.MemStats.Mallocs = GetOrRegisterGauge("runtime.MemStats.Mallocs", r)
+	m.MemStats.MCacheInuse = GetOrRegisterGauge("runtime.MemStats.MCacheInuse", r)
+	m.MemStats.MCacheSys = GetOrRegisterGauge("runtime.MemStats.MCacheSys", r)
+	m.MemStats.MSpanInuse = GetOrRegisterGauge("runtime.MemStats.MSpanInuse", r)
+	m.MemStats.MSpanSys = GetOrRegisterGauge("runtime.MemStats.MSpanSys", r)
+	m.MemStats.NextGC = GetOrRegisterGauge("runtime.MemStats.NextGC", r)
+	m.MemStats.NumGC = GetOrRegisterGauge("runtime.MemStats.NumGC", r)
+	m.MemStats.GCCPUFraction = GetOrRegisterGaugeFloat64("runtime.MemStats.GCCPUFraction", r)
+	m.MemStats.PauseNs = GetOrRegisterHistogram("runtime.MemStats.PauseNs", r,
+		NewExpDecaySample(1028, 0.015))
+	m.MemStats.PauseTotalNs = GetOrRegisterGauge("runtime.MemStats.PauseTotalNs", r)
+	m.MemStats.StackInuse = GetOrRegisterGauge("runtime.MemStats.StackInuse", r)
+	m.MemStats.StackSys = GetOrRegisterGauge("runtime.MemStats.StackSys", r)
+	m.MemStats.Sys = GetOrRegisterGauge("runtime.MemStats.Sys", r)
+	m.MemStats.TotalAlloc = GetOrRegisterGauge("runtime.MemStats.TotalAlloc", r)
+	m.NumCgoCall = GetOrRegisterGauge("runtime.NumCgoCall", r)
+	m.NumGoroutine = GetOrRegisterGauge("runtime.NumGoroutine", r)
+	m.NumThread = GetOrRegisterGauge("runtime.NumThread", r)
+	m.ReadMemStats = GetOrRegisterTimer("runtime.ReadMemStats", r)
+	return c
+}
 
 // CaptureRuntimeMemStats captures new values for the Go runtime statistics
 // exported in runtime.MemStats. This is designed to be called as a goroutine.
 func CaptureRuntimeMemStats(r Registry, d time.Duration) {
 	for range time.Tick(d) {
-		CaptureRuntimeMemStatsOnce(r)
+		handleCollectorError(CaptureRuntimeMemStatsOnce(r))
 	}
 }
 
 // CaptureRuntimeMemStatsOnce captures new values for the Go runtime statistics
-// exported in runtime.MemStats. This is designed to be called in a background
-// goroutine. Giving a registry which has not been given to RegisterRuntimeMemStats
-// will panic.
+// exported in runtime.MemStats into the metrics of r. This is designed to be
+// called in a background goroutine. Giving a registry which has not been given
+// to RegisterRuntimeMemStats returns a *CollectorError, which is counted by the
+// metrics registered with RegisterCollectorErrors.
+func CaptureRuntimeMemStatsOnce(r Registry) error {
+	if r == nil {
+		r = DefaultRegistry
+	}
+	runtimeMutex.Lock()
+	c, ok := runtimeCollectors[r]
+	runtimeMutex.Unlock()
+	if !ok {
+		return collected("runtime", errors.New("stats not registered"))
+	}
+	c.Capture()
+	return collected("runtime", nil)
+}
+
+// RegisterRuntimeMemStats registers runtime metrics for the Go runtime statistics
+// exported in runtime and specifically runtime.MemStats. The metrics are named by
+// their fully-qualified Go symbols, i.e. runtime.MemStats.Alloc. Registering the
+// same registry twice is a no-op. The registry is held until it is given to
+// UnregisterRuntimeMemStats.
+func RegisterRuntimeMemStats(r Registry) {
+	if r == nil {
+		r = DefaultRegistry
+	}
+	runtimeMutex.Lock()
+	defer runtimeMutex.Unlock()
+	if _, ok := runtimeCollectors[r]; !ok {
+		runtimeCollectors[r] = NewRuntimeCollector(r)
+	}
+}
+
+// UnregisterRuntimeMemStats releases a registry given to
+// RegisterRuntimeMemStats, after which it may no longer be given to
+// CaptureRuntimeMemStatsOnce. Its metrics are left registered.
+func UnregisterRuntimeMemStats(r Registry) {
+	if r == nil {
+		r = DefaultRegistry
+	}
+	runtimeMutex.Lock()
+	defer runtimeMutex.Unlock()
+	delete(runtimeCollectors, r)
+}
+
+// Capture captures new values for the Go runtime statistics.
 //
 // Be very careful with this because runtime.ReadMemStats calls the C
 // functions runtime·semacquire(&runtime·worldsema) and runtime·stoptheworld()
 // and that last one does what it says on the tin.
-func CaptureRuntimeMemStatsOnce(r Registry) {
+func (c *RuntimeCollector) Capture() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
 	t := time.Now()
-	runtime.ReadMemStats(&memStats) // This takes 50-200us.
-	runtimeMetrics.ReadMemStats.UpdateSince(t)
+	runtime.ReadMemStats(&c.memStats) // This takes 50-200us.
+	c.metrics.ReadMemStats.UpdateSince(t)
 
-	runtimeMetrics.MemStats.Alloc.Update(int64(memStats.Alloc))
-	runtimeMetrics.MemStats.BuckHashSys.Update(int64(memStats.BuckHashSys))
-	if memStats.DebugGC {
-		runtimeMetrics.MemStats.DebugGC.Update(1)
+	c.metrics.MemStats.Alloc.Update(int64(c.memStats.Alloc))
+	c.metrics.MemStats.BuckHashSys.Update(int64(c.memStats.BuckHashSys))
+	if c.memStats.DebugGC {
+		c.metrics.MemStats.DebugGC.Update(1)
 	} else {
-		runtimeMetrics.MemStats.DebugGC.Update(0)
+		c.metrics.MemStats.DebugGC.Update(0)
 	}
-	if memStats.EnableGC {
-		runtimeMetrics.MemStats.EnableGC.Update(1)
+	if c.memStats.EnableGC {
+		c.metrics.MemStats.EnableGC.Update(1)
 	} else {
-		runtimeMetrics.MemStats.EnableGC.Update(0)
+		c.metrics.MemStats.EnableGC.Update(0)
 	}
 
-	runtimeMetrics.MemStats.Frees.Update(int64(memStats.Frees - frees))
-	runtimeMetrics.MemStats.HeapAlloc.Update(int64(memStats.HeapAlloc))
-	runtimeMetrics.MemStats.HeapIdle.Update(int64(memStats.HeapIdle))
-	runtimeMetrics.MemStats.HeapInuse.Update(int64(memStats.HeapInuse))
-	runtimeMetrics.MemStats.HeapObjects.Update(int64(memStats.HeapObjects))
-	runtimeMetrics.MemStats.HeapReleased.Update(int64(memStats.HeapReleased))
-	runtimeMetrics.MemStats.HeapSys.Update(int64(memStats.HeapSys))
-	runtimeMetrics.MemStats.LastGC.Update(int64(memStats.LastGC))
-	runtimeMetrics.MemStats.Lookups.Update(int64(memStats.Lookups - lookups))
-	runtimeMetrics.MemStats.Mallocs.Update(int64(memStats.Mallocs - mallocs))
-	runtimeMetrics.MemStats.MCacheInuse.Update(int64(memStats.MCacheInuse))
-	runtimeMetrics.MemStats.MCacheSys.Update(int64(memStats.MCacheSys))
-	runtimeMetrics.MemStats.MSpanInuse.Update(int64(memStats.MSpanInuse))
-	runtimeMetrics.MemStats.MSpanSys.Update(int64(memStats.MSpanSys))
-	runtimeMetrics.MemStats.NextGC.Update(int64(memStats.NextGC))
-	runtimeMetrics.MemStats.NumGC.Update(int64(memStats.NumGC - numGC))
-	runtimeMetrics.MemStats.GCCPUFraction.Update(gcCPUFraction(&memStats))
+	c.metrics.MemStats.Frees.Update(int64(c.memStats.Frees - c.frees))
+	c.metrics.MemStats.HeapAlloc.Update(int64(c.memStats.HeapAlloc))
+	c.metrics.MemStats.HeapIdle.Update(int64(c.memStats.HeapIdle))
+	c.metrics.MemStats.HeapInuse.Update(int64(c.memStats.HeapInuse))
+	c.metrics.MemStats.HeapObjects.Update(int64(c.memStats.HeapObjects))
+	c.metrics.MemStats.HeapReleased.Update(int64(c.memStats.HeapReleased))
+	c.metrics.MemStats.HeapSys.Update(int64(c.memStats.HeapSys))
+	c.metrics.MemStats.LastGC.Update(int64(c.memStats.LastGC))
+	c.metrics.MemStats.Lookups.Update(int64(c.memStats.Lookups - c.lookups))
+	c.metrics.MemStats.Mallocs.Update(int64(c.memStats.Mallocs - c.mallocs))
+	c.metrics.MemStats.MCacheInuse.Update(int64(c.memStats.MCacheInuse))
+	c.metrics.MemStats.MCacheSys.Update(int64(c.memStats.MCacheSys))
+	c.metrics.MemStats.MSpanInuse.Update(int64(c.memStats.MSpanInuse))
+	c.metrics.MemStats.MSpanSys.Update(int64(c.memStats.MSpanSys))
+	c.metrics.MemStats.NextGC.Update(int64(c.memStats.NextGC))
+	c.metrics.MemStats.NumGC.Update(int64(c.memStats.NumGC - c.numGC))
+	c.metrics.MemStats.GCCPUFraction.Update(gcCPUFraction(&c.memStats))
 
 	// <https://code.google.com/p/go/source/browse/src/pkg/runtime/mgc0.c>
-	i := numGC % uint32(len(memStats.PauseNs))
-	ii := memStats.NumGC % uint32(len(memStats.PauseNs))
-	if memStats.NumGC-numGC >= uint32(len(memStats.PauseNs)) {
-		for i = 0; i < uint32(len(memStats.PauseNs)); i++ {
-			runtimeMetrics.MemStats.PauseNs.Update(int64(memStats.PauseNs[i]))
+	i := c.numGC % uint32(len(c.memStats.PauseNs))
+	ii := c.memStats.NumGC % uint32(len(c.memStats.PauseNs))
+	if c.memStats.NumGC-c.numGC >= uint32(len(c.memStats.PauseNs)) {
+		for i = 0; i < uint32(len(c.memStats.PauseNs)); i++ {
+			c.metrics.MemStats.PauseNs.Update(int64(c.memStats.PauseNs[i]))
 		}
 	} else {
 		if i > ii {
-			for ; i < uint32(len(memStats.PauseNs)); i++ {
-				runtimeMetrics.MemStats.PauseNs.Update(int64(memStats.PauseNs[i]))
+			for ; i < uint32(len(c.memStats.PauseNs)); i++ {
+				c.metrics.MemStats.PauseNs.Update(int64(c.memStats.PauseNs[i]))
 			}
 			i = 0
 		}
 		for ; i < ii; i++ {
-			runtimeMetrics.MemStats.PauseNs.Update(int64(memStats.PauseNs[i]))
+			c.metrics.MemStats.PauseNs.Update(int64(c.memStats.PauseNs[i]))
 		}
 	}
-	frees = memStats.Frees
-	lookups = memStats.Lookups
-	mallocs = memStats.Mallocs
-	numGC = memStats.NumGC
+	c.frees = c.memStats.Frees
+	c.lookups = c.memStats.Lookups
+	c.mallocs = c.memStats.Mallocs
+	c.numGC = c.memStats.NumGC
 
-	runtimeMetrics.MemStats.PauseTotalNs.Update(int64(memStats.PauseTotalNs))
-	runtimeMetrics.MemStats.StackInuse.Update(int64(memStats.StackInuse))
-	runtimeMetrics.MemStats.StackSys.Update(int64(memStats.StackSys))
-	runtimeMetrics.MemStats.Sys.Update(int64(memStats.Sys))
-	runtimeMetrics.MemStats.TotalAlloc.Update(int64(memStats.TotalAlloc))
+	c.metrics.MemStats.PauseTotalNs.Update(int64(c.memStats.PauseTotalNs))
+	c.metrics.MemStats.StackInuse.Update(int64(c.memStats.StackInuse))
+	c.metrics.MemStats.StackSys.Update(int64(c.memStats.StackSys))
+	c.metrics.MemStats.Sys.Update(int64(c.memStats.Sys))
+	c.metrics.MemStats.TotalAlloc.Update(int64(c.memStats.TotalAlloc))
 
 	currentNumCgoCalls := numCgoCall()
-	runtimeMetrics.NumCgoCall.Update(currentNumCgoCalls - numCgoCalls)
-	numCgoCalls = currentNumCgoCalls
+	c.metrics.NumCgoCall.Update(currentNumCgoCalls - c.numCgoCalls)
+	c.numCgoCalls = currentNumCgoCalls
 
-	runtimeMetrics.NumGoroutine.Update(int64(runtime.NumGoroutine()))
+	c.metrics.NumGoroutine.Update(int64(runtime.NumGoroutine()))
 
-	runtimeMetrics.NumThread.Update(int64(threadCreateProfile.Count()))
+	c.metrics.NumThread.Update(int64(threadCreateProfile.Count()))
 }
 
-// RegisterRuntimeMemStats registers runtime metrics for the Go runtime statistics
-// exported in runtime and specifically runtime.MemStats. The runtimeMetrics are
-// named by their fully-qualified Go symbols, i.e. runtime.MemStats.Alloc.
-func RegisterRuntimeMemStats(r Registry) {
-	if r == nil {
-		r = DefaultRegistry
-	}
-	registerRuntimeMetricsOnce.Do(func() {
-		runtimeMetrics.MemStats.Alloc = NewGauge()
-		runtimeMetrics.MemStats.BuckHashSys = NewGauge()
-		runtimeMetrics.MemStats.DebugGC = NewGauge()
-		runtimeMetrics.MemStats.EnableGC = NewGauge()
-		runtimeMetrics.MemStats.Frees = NewGauge()
-		runtimeMetrics.MemStats.HeapAlloc = NewGauge()
-		runtimeMetrics.MemStats.HeapIdle = NewGauge()
-		runtimeMetrics.MemStats.HeapInuse = NewGauge()
-		runtimeMetrics.MemStats.HeapObjects = NewGauge()
-		runtimeMetrics.MemStats.HeapReleased = NewGauge()
-		runtimeMetrics.MemStats.HeapSys = NewGauge()
-		runtimeMetrics.MemStats.LastGC = NewGauge()
-		runtimeMetrics.MemStats.Lookups = NewGauge()
-		runtimeMetrics.MemStats.Mallocs = NewGauge()
-		runtimeMetrics.MemStats.MCacheInuse = NewGauge()
-		runtimeMetrics.MemStats.MCacheSys = NewGauge()
-		runtimeMetrics.MemStats.MSpanInuse = NewGauge()
-		runtimeMetrics.MemStats.MSpanSys = NewGauge()
-		runtimeMetrics.MemStats.NextGC = NewGauge()
-		runtimeMetrics.MemStats.NumGC = NewGauge()
-		runtimeMetrics.MemStats.GCCPUFraction = NewGaugeFloat64()
-		runtimeMetrics.MemStats.PauseNs = NewHistogram(NewExpDecaySample(1028, 0.015))
-		runtimeMetrics.MemStats.PauseTotalNs = NewGauge()
-		runtimeMetrics.MemStats.StackInuse = NewGauge()
-		runtimeMetrics.MemStats.StackSys = NewGauge()
-		runtimeMetrics.MemStats.Sys = NewGauge()
-		runtimeMetrics.MemStats.TotalAlloc = NewGauge()
-		runtimeMetrics.NumCgoCall = NewGauge()
-		runtimeMetrics.NumGoroutine = NewGauge()
-		runtimeMetrics.NumThread = NewGauge()
-		runtimeMetrics.ReadMemStats = NewTimer()
-
-		r.Register("runtime.MemStats.Alloc", runtimeMetrics.MemStats.Alloc)
-		r.Register("runtime.MemStats.BuckHashSys", runtimeMetrics.MemStats.BuckHashSys)
-		r.Register("runtime.MemStats.DebugGC", runtimeMetrics.MemStats.DebugGC)
-		r.Register("runtime.MemStats.EnableGC", runtimeMetrics.MemStats.EnableGC)
-		r.Register("runtime.MemStats.Frees", runtimeMetrics.MemStats.Frees)
-		r.Register("runtime.MemStats.HeapAlloc", runtimeMetrics.MemStats.HeapAlloc)
-		r.Register("runtime.MemStats.HeapIdle", runtimeMetrics.MemStats.HeapIdle)
-		r.Register("runtime.MemStats.HeapInuse", runtimeMetrics.MemStats.HeapInuse)
-		r.Register("runtime.MemStats.HeapObjects", runtimeMetrics.MemStats.HeapObjects)
-		r.Register("runtime.MemStats.HeapReleased", runtimeMetrics.MemStats.HeapReleased)
-		r.Register("runtime.MemStats.HeapSys", runtimeMetrics.MemStats.HeapSys)
-		r.Register("runtime.MemStats.LastGC", runtimeMetrics.MemStats.LastGC)
-		r.Register("runtime.MemStats.Lookups", runtimeMetrics.MemStats.Lookups)
-		r.Register("runtime.MemStats.Mallocs", runtimeMetrics.MemStats.Mallocs)
-		r.Register("runtime.MemStats.MCacheInuse", runtimeMetrics.MemStats.MCacheInuse)
-		r.Register("runtime.MemStats.MCacheSys", runtimeMetrics.MemStats.MCacheSys)
-		r.Register("runtime.MemStats.MSpanInuse", runtimeMetrics.MemStats.MSpanInuse)
-		r.Register("runtime.MemStats.MSpanSys", runtimeMetrics.MemStats.MSpanSys)
-		r.Register("runtime.MemStats.NextGC", runtimeMetrics.MemStats.NextGC)
-		r.Register("runtime.MemStats.NumGC", runtimeMetrics.MemStats.NumGC)
-		r.Register("runtime.MemStats.GCCPUFraction", runtimeMetrics.MemStats.GCCPUFraction)
-		r.Register("runtime.MemStats.PauseNs", runtimeMetrics.MemStats.PauseNs)
-		r.Register("runtime.MemStats.PauseTotalNs", runtimeMetrics.MemStats.PauseTotalNs)
-		r.Register("runtime.MemStats.StackInuse", runtimeMetrics.MemStats.StackInuse)
-		r.Register("runtime.MemStats.StackSys", runtimeMetrics.MemStats.StackSys)
-		r.Register("runtime.MemStats.Sys", runtimeMetrics.MemStats.Sys)
-		r.Register("runtime.MemStats.TotalAlloc", runtimeMetrics.MemStats.TotalAlloc)
-		r.Register("runtime.NumCgoCall", runtimeMetrics.NumCgoCall)
-		r.Register("runtime.NumGoroutine", runtimeMetrics.NumGoroutine)
-		r.Register("runtime.NumThread", runtimeMetrics.NumThread)
-		r.Register("runtime.ReadMemStats", runtimeMetrics.ReadMemStats)
-	})
+// Collect implements Collector.
+func (c *RuntimeCollector) Collect(ctx context.Context) error {
+	c.Capture()
+	return nil
 }
@@ -0,0 +1,135 @@
+package metrics
+
+import (
+	"context"
+	rm "runtime/metrics"
+	"strings"
+	"sync"
+)
+
+// RuntimeMetricsCollector captures the samples of the runtime/metrics package
+// into the metrics of a single registry. Unlike RuntimeCollector it does not
+// stop the world, and it exports every metric supported by the running Go
+// version, such as the scheduler latency and GC pause histograms.
+//
+// Samples are named "runtime." followed by their runtime/metrics name with
+// "/" and ":" replaced by ".", i.e /sched/goroutines:goroutines becomes
+// runtime.sched.goroutines.goroutines. Cumulative integer samples are
+// exported as Counters, other integer samples as Gauges, floating point
+// samples as GaugeFloat64s and distributions as Histograms backed by a
+// BucketSample. Histograms in seconds are converted to nanoseconds and their
+// names end in .nanoseconds instead.
+type RuntimeMetricsCollector struct {
+	mutex   sync.Mutex
+	samples []rm.Sample
+	metrics []interface{}
+}
+
+// NewRuntimeMetricsCollector constructs a new RuntimeMetricsCollector and
+// registers its metrics in r. If allow is non-empty, only the runtime/metrics
+// names it lists are collected; an entry ending in "/" allows every name
+// under it, i.e "/gc/". Metrics that already exist in r are reused.
+func NewRuntimeMetricsCollector(r Registry, allow ...string) *RuntimeMetricsCollector {
+	if r == nil {
+		r = DefaultRegistry
+	}
+	c := &RuntimeMetricsCollector{}
+	var hists []rm.Sample
+	for _, d := range rm.All() {
+		if !runtimeMetricAllowed(d.Name, allow) {
+			continue
+		}
+		switch d.Kind {
+		case rm.KindUint64:
+			name := RuntimeMetricName(d.Name)
+			if d.Cumulative {
+				c.metrics = append(c.metrics, GetOrRegisterCounter(name, r))
+			} else {
+				c.metrics = append(c.metrics, GetOrRegisterGauge(name, r))
+			}
+		case rm.KindFloat64:
+			name := RuntimeMetricName(d.Name)
+			c.metrics = append(c.metrics, GetOrRegisterGaugeFloat64(name, r))
+		case rm.KindFloat64Histogram:
+			hists = append(hists, rm.Sample{Name: d.Name})
+			c.metrics = append(c.metrics, nil)
+		default:
+			continue
+		}
+		c.samples = append(c.samples, rm.Sample{Name: d.Name})
+	}
+
+	// Bucket boundaries of histograms are only known once they are read.
+	rm.Read(hists)
+	for i, j := 0, 0; i < len(c.samples); i++ {
+		if c.metrics[i] != nil {
+			continue
+		}
+		h := hists[j].Value.Float64Histogram()
+		j++
+		bounds := h.Buckets
+		name := RuntimeMetricName(c.samples[i].Name)
+		if strings.HasSuffix(c.samples[i].Name, ":seconds") {
+			bounds = make([]float64, len(h.Buckets))
+			for k, b := range h.Buckets {
+				bounds[k] = b * 1e9
+			}
+			name = strings.TrimSuffix(name, "seconds") + "nanoseconds"
+		}
+		c.metrics[i] = GetOrRegisterHistogram(name, r, NewBucketSample(bounds))
+	}
+	return c
+}
+
+// RuntimeMetricName returns the name under which a RuntimeMetricsCollector
+// registers the runtime/metrics sample with the given name.
+func RuntimeMetricName(name string) string {
+	name = strings.TrimPrefix(name, "/")
+	return "runtime." + strings.NewReplacer("/", ".", ":", ".").Replace(name)
+}
+
+// Capture reads the runtime/metrics samples and updates their metrics.
+func (c *RuntimeMetricsCollector) Capture() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	rm.Read(c.samples)
+	for i, s := range c.samples {
+		switch metric := c.metrics[i].(type) {
+		case Counter:
+			if s.Value.Kind() == rm.KindUint64 {
+				metric.Inc(int64(s.Value.Uint64()) - metric.Count())
+			}
+		case Gauge:
+			if s.Value.Kind() == rm.KindUint64 {
+				metric.Update(int64(s.Value.Uint64()))
+			}
+		case GaugeFloat64:
+			if s.Value.Kind() == rm.KindFloat64 {
+				metric.Update(s.Value.Float64())
+			}
+		case Histogram:
+			sample, ok := metric.Sample().(*BucketSample)
+			if ok && s.Value.Kind() == rm.KindFloat64Histogram {
+				sample.SetCounts(s.Value.Float64Histogram().Counts)
+			}
+		}
+	}
+}
+
+// Collect implements Collector.
+func (c *RuntimeMetricsCollector) Collect(ctx context.Context) error {
+	c.Capture()
+	return nil
+}
+
+func runtimeMetricAllowed(name string, allow []string) bool {
+	if len(allow) == 0 {
+		return true
+	}
+	for _, a := range allow {
+		if a == name || (strings.HasSuffix(a, "/") && strings.HasPrefix(name, a)) {
+			return true
+		}
+	}
+	return false
+}
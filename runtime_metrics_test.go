@@ -0,0 +1,56 @@
+package metrics
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestRuntimeMetricName(t *testing.T) {
+	if name := RuntimeMetricName("/sched/goroutines:goroutines"); name != "runtime.sched.goroutines.goroutines" {
+		t.Errorf("RuntimeMetricName(): %s", name)
+	}
+}
+
+func TestRuntimeMetricsCollector(t *testing.T) {
+	r := NewRegistry()
+	c := NewRuntimeMetricsCollector(r)
+	runtime.GC()
+	c.Capture()
+
+	if g, ok := r.Get("runtime.sched.goroutines.goroutines").(Gauge); !ok || g.Value() < 1 {
+		t.Errorf("runtime.sched.goroutines.goroutines: %v", r.Get("runtime.sched.goroutines.goroutines"))
+	}
+	if c, ok := r.Get("runtime.gc.cycles.total.gc-cycles").(Counter); !ok || c.Count() < 1 {
+		t.Errorf("runtime.gc.cycles.total.gc-cycles: %v", r.Get("runtime.gc.cycles.total.gc-cycles"))
+	}
+	h, ok := r.Get("runtime.sched.latencies.nanoseconds").(Histogram)
+	if !ok {
+		t.Fatal("runtime.sched.latencies.nanoseconds: missing histogram")
+	}
+	if h.Count() < 1 || h.Max() <= 0 {
+		t.Errorf("runtime.sched.latencies.nanoseconds: count %d, max %d", h.Count(), h.Max())
+	}
+}
+
+func TestRuntimeMetricsCollectorAllowlist(t *testing.T) {
+	r := NewRegistry()
+	NewRuntimeMetricsCollector(r, "/gc/", "/sched/goroutines:goroutines").Capture()
+	r.Each(func(name string, _ interface{}) {
+		if name != "runtime.sched.goroutines.goroutines" &&
+			!strings.HasPrefix(name, "runtime.gc.") {
+			t.Errorf("unexpected metric %s", name)
+		}
+	})
+	if r.Get("runtime.sched.goroutines.goroutines") == nil {
+		t.Error("missing runtime.sched.goroutines.goroutines")
+	}
+}
+
+func BenchmarkRuntimeMetrics(b *testing.B) {
+	c := NewRuntimeMetricsCollector(NewRegistry())
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.Capture()
+	}
+}
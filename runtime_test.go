@@ -1,6 +1,7 @@
 package metrics
 
 import (
+	"errors"
 	"runtime"
 	"testing"
 	"time"
@@ -29,6 +30,23 @@ func TestRuntimeMemStatsDoubleRegister(t *testing.T) {
 	}
 }
 
+func TestUnregisterRuntimeMemStats(t *testing.T) {
+	r := NewRegistry()
+	RegisterRuntimeMemStats(r)
+	UnregisterRuntimeMemStats(r)
+	runtimeMutex.Lock()
+	_, ok := runtimeCollectors[r]
+	runtimeMutex.Unlock()
+	if ok {
+		t.Error("UnregisterRuntimeMemStats(): registry still held")
+	}
+	var err *CollectorError
+	if !errors.As(CaptureRuntimeMemStatsOnce(r), &err) || err.Collector != "runtime" {
+		t.Errorf("CaptureRuntimeMemStatsOnce(): %v for an unregistered registry", err)
+	}
+	collected("runtime", nil)
+}
+
 func BenchmarkRuntimeMemStats(b *testing.B) {
 	r := NewRegistry()
 	RegisterRuntimeMemStats(r)
@@ -42,30 +60,31 @@ func TestRuntimeMemStats(t *testing.T) {
 	r := NewRegistry()
 	RegisterRuntimeMemStats(r)
 	CaptureRuntimeMemStatsOnce(r)
-	zero := runtimeMetrics.MemStats.PauseNs.Count() // Get a "zero" since GC may have run before these tests.
+	pauseNs := r.Get("runtime.MemStats.PauseNs").(Histogram)
+	zero := pauseNs.Count() // Get a "zero" since GC may have run before these tests.
 	runtime.GC()
 	CaptureRuntimeMemStatsOnce(r)
-	if count := runtimeMetrics.MemStats.PauseNs.Count(); count-zero != 1 {
+	if count := pauseNs.Count(); count-zero != 1 {
 		t.Fatal(count - zero)
 	}
 	runtime.GC()
 	runtime.GC()
 	CaptureRuntimeMemStatsOnce(r)
-	if count := runtimeMetrics.MemStats.PauseNs.Count(); count-zero != 3 {
+	if count := pauseNs.Count(); count-zero != 3 {
 		t.Fatal(count - zero)
 	}
 	for i := 0; i < 256; i++ {
 		runtime.GC()
 	}
 	CaptureRuntimeMemStatsOnce(r)
-	if count := runtimeMetrics.MemStats.PauseNs.Count(); count-zero != 259 {
+	if count := pauseNs.Count(); count-zero != 259 {
 		t.Fatal(count - zero)
 	}
 	for i := 0; i < 257; i++ {
 		runtime.GC()
 	}
 	CaptureRuntimeMemStatsOnce(r)
-	if count := runtimeMetrics.MemStats.PauseNs.Count(); count-zero != 515 { // We lost one because there were too many GCs between captures.
+	if count := pauseNs.Count(); count-zero != 515 { // We lost one because there were too many GCs between captures.
 		t.Fatal(count - zero)
 	}
 }
@@ -75,11 +94,38 @@ func TestRuntimeMemStatsNumThread(t *testing.T) {
 	RegisterRuntimeMemStats(r)
 	CaptureRuntimeMemStatsOnce(r)
 
-	if value := runtimeMetrics.NumThread.Value(); value < 1 {
+	if value := r.Get("runtime.NumThread").(Gauge).Value(); value < 1 {
 		t.Fatalf("got NumThread: %d, wanted at least 1", value)
 	}
 }
 
+func TestRuntimeCollectorPerRegistry(t *testing.T) {
+	r1, r2 := NewRegistry(), NewRegistry()
+	RegisterRuntimeMemStats(r1)
+	RegisterRuntimeMemStats(r2)
+	c := NewRuntimeCollector(NewRegistry())
+
+	CaptureRuntimeMemStatsOnce(r1)
+	runtime.GC()
+	CaptureRuntimeMemStatsOnce(r2)
+	c.Capture()
+	CaptureRuntimeMemStatsOnce(r1)
+
+	// Every collector tracks its own deltas, so r1 only sees the GCs since its
+	// last capture and r2 sees every GC since the start of the process.
+	numGC1 := r1.Get("runtime.MemStats.NumGC").(Gauge).Value()
+	numGC2 := r2.Get("runtime.MemStats.NumGC").(Gauge).Value()
+	if numGC1 < 1 {
+		t.Errorf("r1: NumGC %d < 1", numGC1)
+	}
+	if numGC2 < numGC1 {
+		t.Errorf("r2: NumGC %d < %d", numGC2, numGC1)
+	}
+	if c.metrics.MemStats.Alloc.Value() == 0 {
+		t.Error("collector did not capture into its own registry")
+	}
+}
+
 func TestRuntimeMemStatsBlocking(t *testing.T) {
 	if g := runtime.GOMAXPROCS(0); g < 2 {
 		t.Skipf("skipping TestRuntimeMemStatsBlocking with GOMAXPROCS=%d\n", g)
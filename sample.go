@@ -29,6 +29,315 @@ type Sample interface {
 	Variance() float64
 }
 
+// BucketSample is a sample which counts values into fixed buckets instead of
+// keeping them, such as the histograms reported by the runtime/metrics
+// package. Statistics are estimated from the bucket boundaries, so they are
+// only as precise as the buckets are narrow.
+type BucketSample struct {
+	mutex  sync.Mutex
+	bounds []float64
+	counts []int64
+}
+
+// NewBucketSample constructs a new bucket sample. Bucket i counts the values
+// in [bounds[i], bounds[i+1]), so there are len(bounds)-1 buckets. The first
+// and last bounds may be -Inf and +Inf. Values outside of the bounds are
+// counted in the first or last bucket.
+func NewBucketSample(bounds []float64) Sample {
+	if UseNilMetrics {
+		return NilSample{}
+	}
+	b := make([]float64, len(bounds))
+	copy(b, bounds)
+	n := len(b) - 1
+	if n < 0 {
+		n = 0
+	}
+	return &BucketSample{bounds: b, counts: make([]int64, n)}
+}
+
+// Bounds returns a copy of the bucket boundaries.
+func (s *BucketSample) Bounds() []float64 {
+	bounds := make([]float64, len(s.bounds))
+	copy(bounds, s.bounds)
+	return bounds
+}
+
+// Clear clears all samples.
+func (s *BucketSample) Clear() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for i := range s.counts {
+		s.counts[i] = 0
+	}
+}
+
+// Count returns the number of samples recorded.
+func (s *BucketSample) Count() int64 {
+	return s.Snapshot().Count()
+}
+
+// Counts returns a copy of the bucket counts.
+func (s *BucketSample) Counts() []int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	counts := make([]int64, len(s.counts))
+	copy(counts, s.counts)
+	return counts
+}
+
+// Max returns the upper bound of the highest non-empty bucket.
+func (s *BucketSample) Max() int64 {
+	return s.Snapshot().Max()
+}
+
+// Mean returns the estimated mean of the values in the sample.
+func (s *BucketSample) Mean() float64 {
+	return s.Snapshot().Mean()
+}
+
+// Min returns the lower bound of the lowest non-empty bucket.
+func (s *BucketSample) Min() int64 {
+	return s.Snapshot().Min()
+}
+
+// Percentile returns an estimate of an arbitrary percentile of values in the
+// sample, interpolated within its bucket.
+func (s *BucketSample) Percentile(p float64) float64 {
+	return s.Snapshot().Percentile(p)
+}
+
+// Percentiles returns a slice of estimates of arbitrary percentiles of values
+// in the sample.
+func (s *BucketSample) Percentiles(ps []float64) []float64 {
+	return s.Snapshot().Percentiles(ps)
+}
+
+// SetCounts replaces the bucket counts, i.e with a cumulative histogram read
+// from elsewhere. Surplus counts are ignored.
+func (s *BucketSample) SetCounts(counts []uint64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for i := range s.counts {
+		if i < len(counts) {
+			s.counts[i] = int64(counts[i])
+		} else {
+			s.counts[i] = 0
+		}
+	}
+}
+
+// Size returns the number of samples recorded, as no values are kept.
+func (s *BucketSample) Size() int {
+	return int(s.Count())
+}
+
+// Snapshot returns a read-only copy of the sample.
+func (s *BucketSample) Snapshot() Sample {
+	return &BucketSampleSnapshot{bounds: s.bounds, counts: s.Counts()}
+}
+
+// StdDev returns the estimated standard deviation of the values in the sample.
+func (s *BucketSample) StdDev() float64 {
+	return s.Snapshot().StdDev()
+}
+
+// Sum returns the estimated sum of the values in the sample.
+func (s *BucketSample) Sum() int64 {
+	return s.Snapshot().Sum()
+}
+
+// Update counts a new value in its bucket.
+func (s *BucketSample) Update(v int64) {
+	if len(s.counts) == 0 {
+		return
+	}
+	i := sort.Search(len(s.bounds), func(i int) bool {
+		return s.bounds[i] > float64(v)
+	}) - 1
+	if i < 0 {
+		i = 0
+	} else if i >= len(s.counts) {
+		i = len(s.counts) - 1
+	}
+	s.mutex.Lock()
+	s.counts[i]++
+	s.mutex.Unlock()
+}
+
+// Values returns an empty slice, as a BucketSample does not keep values.
+func (s *BucketSample) Values() []int64 { return []int64{} }
+
+// Variance returns the estimated variance of the values in the sample.
+func (s *BucketSample) Variance() float64 {
+	return s.Snapshot().Variance()
+}
+
+// BucketSampleSnapshot is a read-only copy of a BucketSample.
+type BucketSampleSnapshot struct {
+	bounds []float64
+	counts []int64
+}
+
+// Clear panics.
+func (*BucketSampleSnapshot) Clear() {
+	panic("Clear called on a BucketSampleSnapshot")
+}
+
+// Count returns the number of samples at the time the snapshot was taken.
+func (s *BucketSampleSnapshot) Count() int64 {
+	var n int64
+	for _, c := range s.counts {
+		n += c
+	}
+	return n
+}
+
+// Max returns the upper bound of the highest non-empty bucket at the time the
+// snapshot was taken.
+func (s *BucketSampleSnapshot) Max() int64 {
+	for i := len(s.counts) - 1; i >= 0; i-- {
+		if s.counts[i] > 0 {
+			if math.IsInf(s.bounds[i+1], 1) {
+				return int64(s.bounds[i])
+			}
+			return int64(s.bounds[i+1])
+		}
+	}
+	return 0
+}
+
+// Mean returns the estimated mean value at the time the snapshot was taken.
+func (s *BucketSampleSnapshot) Mean() float64 {
+	n := s.Count()
+	if n == 0 {
+		return 0.0
+	}
+	var sum float64
+	for i, c := range s.counts {
+		sum += float64(c) * s.midpoint(i)
+	}
+	return sum / float64(n)
+}
+
+// Min returns the lower bound of the lowest non-empty bucket at the time the
+// snapshot was taken.
+func (s *BucketSampleSnapshot) Min() int64 {
+	for i, c := range s.counts {
+		if c > 0 {
+			if math.IsInf(s.bounds[i], -1) {
+				return int64(s.bounds[i+1])
+			}
+			return int64(s.bounds[i])
+		}
+	}
+	return 0
+}
+
+// Percentile returns an estimate of an arbitrary percentile of values at the
+// time the snapshot was taken.
+func (s *BucketSampleSnapshot) Percentile(p float64) float64 {
+	return s.Percentiles([]float64{p})[0]
+}
+
+// Percentiles returns a slice of estimates of arbitrary percentiles of values
+// at the time the snapshot was taken.
+func (s *BucketSampleSnapshot) Percentiles(ps []float64) []float64 {
+	scores := make([]float64, len(ps))
+	n := s.Count()
+	if n == 0 {
+		return scores
+	}
+	for i, p := range ps {
+		rank := p * float64(n)
+		var cum float64
+		for j, c := range s.counts {
+			if c == 0 {
+				continue
+			}
+			if cum+float64(c) < rank && j < len(s.counts)-1 {
+				cum += float64(c)
+				continue
+			}
+			lo, hi := s.bounds[j], s.bounds[j+1]
+			switch {
+			case math.IsInf(lo, -1):
+				scores[i] = hi
+			case math.IsInf(hi, 1):
+				scores[i] = lo
+			default:
+				frac := (rank - cum) / float64(c)
+				if frac < 0 {
+					frac = 0
+				} else if frac > 1 {
+					frac = 1
+				}
+				scores[i] = lo + frac*(hi-lo)
+			}
+			break
+		}
+	}
+	return scores
+}
+
+// Size returns the number of samples at the time the snapshot was taken.
+func (s *BucketSampleSnapshot) Size() int { return int(s.Count()) }
+
+// Snapshot returns the snapshot.
+func (s *BucketSampleSnapshot) Snapshot() Sample { return s }
+
+// StdDev returns the estimated standard deviation of values at the time the
+// snapshot was taken.
+func (s *BucketSampleSnapshot) StdDev() float64 {
+	return math.Sqrt(s.Variance())
+}
+
+// Sum returns the estimated sum of values at the time the snapshot was taken.
+func (s *BucketSampleSnapshot) Sum() int64 {
+	var sum float64
+	for i, c := range s.counts {
+		sum += float64(c) * s.midpoint(i)
+	}
+	return int64(sum)
+}
+
+// Update panics.
+func (*BucketSampleSnapshot) Update(int64) {
+	panic("Update called on a BucketSampleSnapshot")
+}
+
+// Values returns an empty slice, as a BucketSample does not keep values.
+func (s *BucketSampleSnapshot) Values() []int64 { return []int64{} }
+
+// Variance returns the estimated variance of values at the time the snapshot
+// was taken.
+func (s *BucketSampleSnapshot) Variance() float64 {
+	n := s.Count()
+	if n == 0 {
+		return 0.0
+	}
+	m := s.Mean()
+	var sum float64
+	for i, c := range s.counts {
+		d := s.midpoint(i) - m
+		sum += float64(c) * d * d
+	}
+	return sum / float64(n)
+}
+
+// Returns the value representing bucket i: its midpoint, or its finite bound
+// if the other one is infinite.
+func (s *BucketSampleSnapshot) midpoint(i int) float64 {
+	lo, hi := s.bounds[i], s.bounds[i+1]
+	switch {
+	case math.IsInf(lo, -1):
+		return hi
+	case math.IsInf(hi, 1):
+		return lo
+	}
+	return (lo + hi) / 2
+}
+
 // ExpDecaySample is an exponentially-decaying sample using a forward-decaying
 // priority reservoir.  See Cormode et al's "Forward Decay: A Practical Time
 // Decay Model for Streaming Systems".
@@ -1,6 +1,7 @@
 package metrics
 
 import (
+	"math"
 	"math/rand"
 	"runtime"
 	"testing"
@@ -352,3 +353,38 @@ func TestUniformSampleConcurrentUpdateCount(t *testing.T) {
 	}
 	quit <- struct{}{}
 }
+
+func TestBucketSample(t *testing.T) {
+	s := NewBucketSample([]float64{math.Inf(-1), 0, 10, 20, 30, math.Inf(1)})
+	for _, v := range []int64{5, 5, 15, 25} {
+		s.Update(v)
+	}
+	if n := s.Count(); n != 4 {
+		t.Errorf("s.Count(): 4 != %v\n", n)
+	}
+	if min := s.Min(); min != 0 {
+		t.Errorf("s.Min(): 0 != %v\n", min)
+	}
+	if max := s.Max(); max != 30 {
+		t.Errorf("s.Max(): 30 != %v\n", max)
+	}
+	if mean := s.Mean(); mean != 12.5 {
+		t.Errorf("s.Mean(): 12.5 != %v\n", mean)
+	}
+	if sum := s.Sum(); sum != 50 {
+		t.Errorf("s.Sum(): 50 != %v\n", sum)
+	}
+	ps := s.Percentiles([]float64{0.5, 0.75, 1})
+	if ps[0] != 10 || ps[1] != 20 || ps[2] != 30 {
+		t.Errorf("s.Percentiles(): unexpected %v\n", ps)
+	}
+
+	snapshot := s.Snapshot()
+	s.(*BucketSample).SetCounts([]uint64{1, 0, 0, 0, 2})
+	if n := snapshot.Count(); n != 4 {
+		t.Errorf("snapshot.Count(): 4 != %v\n", n)
+	}
+	if min, max := s.Min(), s.Max(); min != 0 || max != 30 {
+		t.Errorf("s.Min(), s.Max(): 0, 30 != %v, %v\n", min, max)
+	}
+}
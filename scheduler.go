@@ -0,0 +1,174 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Collector is a task which captures statistics into a registry, such as
+// CaptureCPUStatsOnce or WriteJSONOnce. Collectors are run periodically by a
+// Scheduler.
+type Collector interface {
+	Collect(ctx context.Context) error
+}
+
+// CollectorFunc is an adapter which allows the use of ordinary functions as
+// Collectors.
+type CollectorFunc func(ctx context.Context) error
+
+// Collect calls f(ctx).
+func (f CollectorFunc) Collect(ctx context.Context) error { return f(ctx) }
+
+// ErrSchedulerRunning is returned by Scheduler.Start when the scheduler has
+// already been started.
+var ErrSchedulerRunning = errors.New("metrics: scheduler already running")
+
+// Scheduler runs collectors on intervals under a context.Context. Each
+// collector runs in its own goroutine, so a slow collector does not delay the
+// others, and a collector never overlaps with itself: ticks that elapse while
+// it is still running are dropped. Errors are counted like those of the
+// Capture* loops and passed to the handler set by SetCollectorErrorHandler.
+type Scheduler struct {
+	mutex  sync.Mutex
+	tasks  map[string]*scheduledTask
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+type scheduledTask struct {
+	name      string
+	interval  time.Duration
+	collector Collector
+	cancel    context.CancelFunc
+}
+
+// NewScheduler constructs a new Scheduler.
+func NewScheduler() *Scheduler {
+	return &Scheduler{tasks: map[string]*scheduledTask{}}
+}
+
+// Add schedules c to be run every d duration under the given name, replacing
+// any collector previously added with that name. If the scheduler is running,
+// the collector is started immediately.
+func (s *Scheduler) Add(name string, d time.Duration, c Collector) {
+	if d <= 0 {
+		panic("non-positive interval for Scheduler.Add")
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if t, ok := s.tasks[name]; ok && t.cancel != nil {
+		t.cancel()
+	}
+	t := &scheduledTask{name: name, interval: d, collector: c}
+	s.tasks[name] = t
+	if s.ctx != nil && s.ctx.Err() == nil {
+		s.start(t)
+	}
+}
+
+// Remove stops and removes the collector with the given name.
+func (s *Scheduler) Remove(name string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if t, ok := s.tasks[name]; ok {
+		if t.cancel != nil {
+			t.cancel()
+		}
+		delete(s.tasks, name)
+	}
+}
+
+// Names returns the sorted names of the scheduled collectors.
+func (s *Scheduler) Names() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	names := make([]string, 0, len(s.tasks))
+	for name := range s.tasks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Start runs the scheduled collectors until ctx is done or Stop is called.
+// It does not block. A stopped scheduler may be started again.
+func (s *Scheduler) Start(ctx context.Context) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.ctx != nil {
+		if s.ctx.Err() == nil {
+			return ErrSchedulerRunning
+		}
+		s.cancel()
+	}
+	s.ctx, s.cancel = context.WithCancel(ctx)
+	for _, t := range s.tasks {
+		s.start(t)
+	}
+	return nil
+}
+
+// Stop stops the scheduler and waits for running collectors to return.
+func (s *Scheduler) Stop() {
+	s.mutex.Lock()
+	if s.ctx == nil {
+		s.mutex.Unlock()
+		return
+	}
+	s.cancel()
+	s.ctx, s.cancel = nil, nil
+	for _, t := range s.tasks {
+		t.cancel = nil
+	}
+	s.mutex.Unlock()
+	s.wg.Wait()
+}
+
+// Running reports whether the scheduler has been started and has neither
+// been stopped nor had its context canceled.
+func (s *Scheduler) Running() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.ctx != nil && s.ctx.Err() == nil
+}
+
+// Starts t under the scheduler's context. The caller must hold the mutex.
+func (s *Scheduler) start(t *scheduledTask) {
+	var ctx context.Context
+	ctx, t.cancel = context.WithCancel(s.ctx)
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(t.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				// Both cases may be ready at once; don't run after cancellation.
+				if ctx.Err() != nil {
+					return
+				}
+				collect(ctx, t.name, t.collector)
+			}
+		}
+	}()
+}
+
+// Runs c once, recording and handling its error.
+func collect(ctx context.Context, name string, c Collector) {
+	err := c.Collect(ctx)
+	if ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+		return
+	}
+	var collectorErr *CollectorError
+	if !errors.As(err, &collectorErr) {
+		err = collected(name, err)
+	}
+	handleCollectorError(err)
+}
@@ -0,0 +1,136 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func ExampleScheduler() {
+	RegisterCPUStats(DefaultRegistry)
+	RegisterDebugGCStats(DefaultRegistry)
+
+	s := NewScheduler()
+	s.Add("cpu", 5*time.Second, CollectorFunc(func(context.Context) error {
+		return CaptureCPUStatsOnce()
+	}))
+	s.Add("gc", 5*time.Second, CollectorFunc(func(context.Context) error {
+		CaptureDebugGCStatsOnce(DefaultRegistry)
+		return nil
+	}))
+	s.Start(context.Background())
+	defer s.Stop()
+}
+
+func TestSchedulerStartStop(t *testing.T) {
+	var runs int32
+	s := NewScheduler()
+	s.Add("foo", time.Millisecond, CollectorFunc(func(context.Context) error {
+		atomic.AddInt32(&runs, 1)
+		return nil
+	}))
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatalf("Start(): %s", err)
+	}
+	if err := s.Start(context.Background()); err != ErrSchedulerRunning {
+		t.Errorf("Start(): expected ErrSchedulerRunning, got %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	s.Stop()
+	if s.Running() {
+		t.Error("Running(): true after Stop")
+	}
+	n := atomic.LoadInt32(&runs)
+	if n == 0 {
+		t.Fatal("collector never ran")
+	}
+	time.Sleep(10 * time.Millisecond)
+	if m := atomic.LoadInt32(&runs); m != n {
+		t.Errorf("collector ran %d times after Stop", m-n)
+	}
+
+	// Restart.
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatalf("Start(): %s", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	s.Stop()
+	if atomic.LoadInt32(&runs) == n {
+		t.Error("collector did not run after restart")
+	}
+}
+
+func TestSchedulerContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := NewScheduler()
+	done := make(chan struct{})
+	var once sync.Once
+	s.Add("foo", time.Millisecond, CollectorFunc(func(ctx context.Context) error {
+		<-ctx.Done()
+		once.Do(func() { close(done) })
+		return ctx.Err()
+	}))
+	s.Start(ctx)
+	time.Sleep(5 * time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("collector context was not canceled")
+	}
+	if s.Running() {
+		t.Error("Running(): true after context was canceled")
+	}
+	s.Stop()
+}
+
+func TestSchedulerNoOverlap(t *testing.T) {
+	var running, overlaps int32
+	s := NewScheduler()
+	s.Add("slow", time.Millisecond, CollectorFunc(func(context.Context) error {
+		if atomic.AddInt32(&running, 1) > 1 {
+			atomic.AddInt32(&overlaps, 1)
+		}
+		time.Sleep(5 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		return nil
+	}))
+	s.Start(context.Background())
+	time.Sleep(30 * time.Millisecond)
+	s.Stop()
+	if n := atomic.LoadInt32(&overlaps); n != 0 {
+		t.Errorf("collector overlapped %d times", n)
+	}
+}
+
+func TestSchedulerErrors(t *testing.T) {
+	defer SetCollectorErrorHandler(nil)
+	errs := make(chan error, 100)
+	SetCollectorErrorHandler(func(err error) { errs <- err })
+
+	errFoo := errors.New("foo")
+	s := NewScheduler()
+	s.Add("foo", time.Millisecond, CollectorFunc(func(context.Context) error {
+		return errFoo
+	}))
+	s.Start(context.Background())
+	defer collected("foo", nil)
+	defer s.Stop()
+	select {
+	case err := <-errs:
+		var collectorErr *CollectorError
+		if !errors.As(err, &collectorErr) || collectorErr.Collector != "foo" ||
+			!errors.Is(err, errFoo) {
+			t.Errorf("unexpected error %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("error handler was not called")
+	}
+	s.Remove("foo")
+	if names := s.Names(); len(names) != 0 {
+		t.Errorf("Names(): %v after Remove", names)
+	}
+}
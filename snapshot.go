@@ -0,0 +1,182 @@
+package metrics
+
+import (
+	"sort"
+	"strings"
+)
+
+// MetricSnapshot is a read-only copy of a named metric.
+type MetricSnapshot struct {
+	Name string
+
+	// The snapshot of the metric, i.e a CounterSnapshot for a Counter, or a
+	// HealthcheckSnapshot for a Healthcheck. It still implements the
+	// metric's interface, but its mutators panic.
+	Metric interface{}
+}
+
+// RegistrySnapshot is an immutable collection of metric snapshots taken from
+// a registry in a single pass, sorted by name. Exporters should export a
+// snapshot rather than iterate over a registry with Each, so that one flush
+// sees consistent values and each metric is copied only once.
+type RegistrySnapshot []MetricSnapshot
+
+// Each calls the given function for each metric snapshot, in order.
+func (s RegistrySnapshot) Each(f func(string, interface{})) {
+	for _, m := range s {
+		f(m.Name, m.Metric)
+	}
+}
+
+// Get the metric snapshot by the given name or nil if there is none.
+func (s RegistrySnapshot) Get(name string) interface{} {
+	i := sort.Search(len(s), func(i int) bool { return s[i].Name >= name })
+	if i < len(s) && s[i].Name == name {
+		return s[i].Metric
+	}
+	return nil
+}
+
+// GetAll returns the values of every metric snapshot, in the format of
+// Registry.GetAll. Metrics with labels other than an Info are keyed by their
+// name followed by their labels, i.e http{method="GET"}.
+func (s RegistrySnapshot) GetAll() map[string]map[string]interface{} {
+	data := make(map[string]map[string]interface{})
+	for _, m := range s {
+		name := m.Name
+		if _, ok := m.Metric.(Info); !ok {
+			if labels := MetricLabels(m.Metric); len(labels) > 0 {
+				name += formatLabels(labels)
+			}
+		}
+		data[name] = m.Values()
+	}
+	return data
+}
+
+// Values returns the values of the metric snapshot, in the format of
+// Registry.GetAll. The labels of the metric, if any, are included.
+func (m MetricSnapshot) Values() map[string]interface{} {
+	values := make(map[string]interface{})
+	switch metric := m.Metric.(type) {
+	case Counter:
+		values["count"] = metric.Count()
+	case Gauge:
+		values["value"] = metric.Value()
+	case GaugeFloat64:
+		values["value"] = metric.Value()
+	case Healthcheck:
+		values["error"] = nil
+		if err := metric.Error(); nil != err {
+			values["error"] = err.Error()
+		}
+	case Info:
+		values["value"] = metric.Value()
+	case Histogram:
+		ps := metric.Percentiles([]float64{0.5, 0.75, 0.95, 0.99, 0.999})
+		values["count"] = metric.Count()
+		values["min"] = metric.Min()
+		values["max"] = metric.Max()
+		values["mean"] = metric.Mean()
+		values["stddev"] = metric.StdDev()
+		values["median"] = ps[0]
+		values["75%"] = ps[1]
+		values["95%"] = ps[2]
+		values["99%"] = ps[3]
+		values["99.9%"] = ps[4]
+	case Meter:
+		values["count"] = metric.Count()
+		values["1m.rate"] = metric.Rate1()
+		values["5m.rate"] = metric.Rate5()
+		values["15m.rate"] = metric.Rate15()
+		values["mean.rate"] = metric.RateMean()
+	case Timer:
+		ps := metric.Percentiles([]float64{0.5, 0.75, 0.95, 0.99, 0.999})
+		values["count"] = metric.Count()
+		values["min"] = metric.Min()
+		values["max"] = metric.Max()
+		values["mean"] = metric.Mean()
+		values["stddev"] = metric.StdDev()
+		values["median"] = ps[0]
+		values["75%"] = ps[1]
+		values["95%"] = ps[2]
+		values["99%"] = ps[3]
+		values["99.9%"] = ps[4]
+		values["1m.rate"] = metric.Rate1()
+		values["5m.rate"] = metric.Rate5()
+		values["15m.rate"] = metric.Rate15()
+		values["mean.rate"] = metric.RateMean()
+	}
+	if labels := MetricLabels(m.Metric); len(labels) > 0 {
+		values["labels"] = labels
+	}
+	return values
+}
+
+// Snapshot returns a RegistrySnapshot of every registered metric. Like Each,
+// it includes and dequeues the metrics stored with SinkOnce. Healthchecks are
+// not run; their snapshot holds the status set by their last check.
+func (r *StandardRegistry) Snapshot() RegistrySnapshot {
+	return r.snapshot(true)
+}
+
+// Takes a snapshot of the registered metrics, and of the metrics stored with
+// SinkOnce if sink is true. The metrics are copied after releasing the
+// registry's lock, since each of them is copied under its own lock anyway.
+func (r *StandardRegistry) snapshot(sink bool) RegistrySnapshot {
+	r.Expire()
+	metrics := r.registered()
+	if sink {
+		r.mutex.Lock()
+		metrics = append(metrics, r.tempQueue...)
+		r.tempQueue = []metricKV{}
+		r.mutex.Unlock()
+	}
+	s := make(RegistrySnapshot, 0, len(metrics))
+	for _, kv := range metrics {
+		s = append(s, MetricSnapshot{Name: kv.name, Metric: snapshotMetric(kv.value)})
+	}
+	sort.SliceStable(s, func(i, j int) bool { return s[i].Name < s[j].Name })
+	return s
+}
+
+// Snapshot returns a RegistrySnapshot of the metrics with the registry's
+// prefix. Names are reported as in Each.
+func (r *PrefixedRegistry) Snapshot() RegistrySnapshot {
+	var s RegistrySnapshot
+	for _, m := range r.underlying.Snapshot() {
+		if strings.HasPrefix(m.Name, r.scope) {
+			s = append(s, MetricSnapshot{Name: r.report(m.Name), Metric: m.Metric})
+		}
+	}
+	return s
+}
+
+// Snapshot returns a RegistrySnapshot of the underlying registry.
+func (r *LimitedRegistry) Snapshot() RegistrySnapshot {
+	return r.underlying.Snapshot()
+}
+
+// Returns a read-only copy of a metric. Unsupported values are returned as
+// is.
+func snapshotMetric(i interface{}) interface{} {
+	switch metric := i.(type) {
+	case Counter:
+		return metric.Snapshot()
+	case Gauge:
+		return metric.Snapshot()
+	case GaugeFloat64:
+		return metric.Snapshot()
+	case Healthcheck:
+		return WithLabels(HealthcheckSnapshot{err: metric.Error()}, MetricLabels(metric))
+	case Histogram:
+		return metric.Snapshot()
+	case Info:
+		return metric.Snapshot()
+	case Meter:
+		return metric.Snapshot()
+	case Timer:
+		return metric.Snapshot()
+	}
+	return i
+}
@@ -0,0 +1,103 @@
+package metrics
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRegistrySnapshot(t *testing.T) {
+	r := NewRegistry()
+	c := GetOrRegisterCounter("b", r)
+	c.Inc(1)
+	GetOrRegisterTimer("c", r).Update(10)
+	checks := 0
+	h := NewHealthcheck(func(h Healthcheck) { checks++ })
+	h.Unhealthy(errors.New("down"))
+	r.Register("a", h)
+	r.SinkOnce("d", NewGauge())
+
+	s := r.Snapshot()
+	c.Inc(1)
+	names := ""
+	s.Each(func(name string, i interface{}) { names += name })
+	if names != "abcd" {
+		t.Errorf("Snapshot(): unsorted names %q", names)
+	}
+	if v := s.Get("b").(Counter).Count(); v != 1 {
+		t.Errorf("b: 1 != %d", v)
+	}
+	if _, ok := s.Get("c").(*TimerSnapshot); !ok {
+		t.Errorf("c: expected *TimerSnapshot, got %T", s.Get("c"))
+	}
+	if err := s.Get("a").(Healthcheck).Error(); err == nil || err.Error() != "down" {
+		t.Errorf("a: unexpected status %v", err)
+	}
+	if checks != 0 {
+		t.Error("Snapshot(): ran a healthcheck")
+	}
+	if s.Get("missing") != nil {
+		t.Error("Get(): expected nil for a missing name")
+	}
+	if r.Snapshot().Get("d") != nil {
+		t.Error("Snapshot(): SinkOnce metric returned twice")
+	}
+
+	r.SinkOnce("e", NewGauge())
+	values := r.GetAll()
+	if _, ok := values["e"]; ok {
+		t.Error("GetAll(): returned a SinkOnce metric")
+	}
+	if r.Snapshot().Get("e") == nil {
+		t.Error("GetAll(): dequeued a SinkOnce metric")
+	}
+	if values["a"]["error"] != "down" || values["b"]["count"] != int64(2) {
+		t.Errorf("GetAll(): unexpected values %v", values)
+	}
+}
+
+// A Counter which registers a metric when it is copied.
+type registeringCounter struct {
+	Counter
+	r Registry
+}
+
+func (c registeringCounter) Snapshot() Counter {
+	GetOrRegisterCounter("other", c.r)
+	return c.Counter.Snapshot()
+}
+
+func TestRegistrySnapshotUnlocked(t *testing.T) {
+	r := NewRegistry()
+	r.Register("foo", registeringCounter{NewCounter(), r})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		r.Snapshot()
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Snapshot(): registry locked while copying the metrics")
+	}
+}
+
+func TestHealthcheckSnapshotPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Unhealthy(): expected panic on a HealthcheckSnapshot")
+		}
+	}()
+	HealthcheckSnapshot{}.Unhealthy(errors.New("down"))
+}
+
+func TestPrefixedRegistrySnapshot(t *testing.T) {
+	parent := NewRegistry()
+	r := NewPrefixedChildRegistry(parent, "prefix.")
+	GetOrRegisterCounter("foo", r)
+	GetOrRegisterCounter("bar", parent)
+	s := r.Snapshot()
+	if len(s) != 1 || s[0].Name != "prefix.foo" {
+		t.Errorf("Snapshot(): %v", s)
+	}
+}
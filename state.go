@@ -0,0 +1,366 @@
+package metrics
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// StateVersion is the version of the format written by SaveState. LoadState
+// rejects states with a newer version.
+const StateVersion = 1
+
+// The state of a registry, as written by SaveState.
+type registryState struct {
+	Version int                    `json:"version"`
+	Saved   time.Time              `json:"saved"`
+	Metrics map[string]metricState `json:"metrics"`
+}
+
+// The state of a metric. Fields are set according to its type.
+type metricState struct {
+	Type   string       `json:"type"`
+	Count  int64        `json:"count,omitempty"`  // Counter.
+	Value  int64        `json:"value,omitempty"`  // Gauge.
+	Float  float64      `json:"float,omitempty"`  // GaugeFloat64.
+	Meter  *meterState  `json:"meter,omitempty"`  // Meter and Timer.
+	Sample *sampleState `json:"sample,omitempty"` // Histogram and Timer.
+}
+
+type meterState struct {
+	Count int64       `json:"count"`
+	Start time.Time   `json:"start"`
+	Rates []ewmaState `json:"rates"` // One-, five- and fifteen-minute.
+}
+
+type ewmaState struct {
+	Rate      float64   `json:"rate"`
+	Uncounted int64     `json:"uncounted"`
+	Timestamp time.Time `json:"timestamp"`
+	Init      bool      `json:"init"`
+}
+
+type sampleState struct {
+	Kind          string    `json:"kind"` // uniform or exp_decay.
+	Count         int64     `json:"count,omitempty"`
+	ReservoirSize int       `json:"reservoir_size,omitempty"`
+	Alpha         float64   `json:"alpha,omitempty"`
+	Values        []int64   `json:"values,omitempty"`
+	Priorities    []float64 `json:"priorities,omitempty"` // Of exp_decay values.
+	T0            time.Time `json:"t0"`
+}
+
+// SaveState writes the state of the metrics of r to w as JSON, so that it can
+// be restored by LoadState after a restart: the counts of counters, the
+// values of gauges, the counts and moving averages of meters and the samples
+// of histograms and timers. Healthchecks and Infos are not saved, and neither
+// are the histograms which do not use a UniformSample or an ExpDecaySample,
+// nor gauges which are not finite. Like Each, it dequeues the metrics stored
+// with SinkOnce.
+func SaveState(r Registry, w io.Writer) error {
+	state := registryState{
+		Version: StateVersion,
+		Saved:   time.Now(),
+		Metrics: map[string]metricState{},
+	}
+	r.Each(func(name string, i interface{}) {
+		if s, ok := saveMetric(unlabeled(i)); ok {
+			state.Metrics[name] = s
+		}
+	})
+	return json.NewEncoder(w).Encode(state)
+}
+
+// LoadState restores the state written by SaveState into r. Metrics which
+// are not registered are registered, and the state of those which are is
+// replaced, so it should be called on startup before the metrics are updated.
+// Returns an error if the state has an unsupported version, or, once every
+// other metric is restored, if some metrics could not be restored, i.e
+// because a metric of another type holds their name.
+func LoadState(r Registry, rd io.Reader) error {
+	var state registryState
+	if err := json.NewDecoder(rd).Decode(&state); err != nil {
+		return err
+	}
+	if state.Version < 1 || state.Version > StateVersion {
+		return fmt.Errorf("unsupported state version %d", state.Version)
+	}
+	var errs []error
+	for name, s := range state.Metrics {
+		if err := loadMetric(r, name, s); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// SaveStateFile writes the state of the metrics of r to the file at path, as
+// SaveState. The file is replaced atomically, so that a crash while saving
+// does not lose the previous state. To save the state periodically, add
+// SaveStateFile to a Scheduler with a CollectorFunc.
+func SaveStateFile(r Registry, path string) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if err := SaveState(r, f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// LoadStateFile restores the state saved in the file at path into r, as
+// LoadState. A missing file is not an error, since there is no state to
+// restore on the first start.
+func LoadStateFile(r Registry, path string) error {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return LoadState(r, f)
+}
+
+// Returns the state of a metric, or false if its state cannot be saved.
+func saveMetric(i interface{}) (metricState, bool) {
+	switch metric := i.(type) {
+	case Counter:
+		return metricState{Type: "counter", Count: metric.Count()}, true
+	case Gauge:
+		return metricState{Type: "gauge", Value: metric.Value()}, true
+	case GaugeFloat64:
+		v := metric.Value()
+		return metricState{Type: "gauge_float64", Float: v}, !math.IsNaN(v) && !math.IsInf(v, 0)
+	case *StandardHistogram:
+		s, ok := saveSample(metric.sample)
+		return metricState{Type: "histogram", Sample: s}, ok
+	case *StandardMeter:
+		return metricState{Type: "meter", Meter: metric.state()}, true
+	case *StandardTimer:
+		s, ok := saveSample(metric.histogram.Sample())
+		m, isStandard := metric.meter.(*StandardMeter)
+		if !ok || !isStandard {
+			return metricState{}, false
+		}
+		return metricState{Type: "timer", Meter: m.state(), Sample: s}, true
+	}
+	return metricState{}, false
+}
+
+// Restores the state of a metric reported under name by r, registering it if
+// needed.
+func loadMetric(r Registry, name string, s metricState) error {
+	base, name := resolve(r, name)
+	if base == nil {
+		return errors.New("name not found in registry")
+	}
+	metric := base.Get(name)
+	if metric == nil {
+		var err error
+		if metric, err = newMetric(s); err != nil {
+			return err
+		}
+		if err := base.Register(name, metric); err != nil {
+			return err
+		}
+	}
+	if metricKind(metric) != s.Type {
+		return fmt.Errorf("cannot restore a %s into a %s", s.Type, metricKind(metric))
+	}
+	switch metric := metric.(type) {
+	case Counter:
+		metric.Inc(s.Count - metric.Count())
+	case Gauge:
+		metric.Update(s.Value)
+	case GaugeFloat64:
+		metric.Update(s.Float)
+	case *StandardHistogram:
+		return loadSample(metric.sample, s.Sample)
+	case *StandardMeter:
+		return metric.restore(s.Meter)
+	case *StandardTimer:
+		if m, ok := metric.meter.(*StandardMeter); ok {
+			if err := m.restore(s.Meter); err != nil {
+				return err
+			}
+		}
+		if h, ok := metric.histogram.(*StandardHistogram); ok {
+			return loadSample(h.sample, s.Sample)
+		}
+	}
+	return nil
+}
+
+// Constructs an empty metric for a saved state.
+func newMetric(s metricState) (interface{}, error) {
+	switch s.Type {
+	case "counter":
+		return NewCounter(), nil
+	case "gauge":
+		return NewGauge(), nil
+	case "gauge_float64":
+		return NewGaugeFloat64(), nil
+	case "meter":
+		return NewMeter(), nil
+	case "histogram", "timer":
+		if s.Sample == nil {
+			return nil, fmt.Errorf("missing sample of %s", s.Type)
+		}
+		var sample Sample
+		switch s.Sample.Kind {
+		case "uniform":
+			sample = NewUniformSample(s.Sample.ReservoirSize)
+		case "exp_decay":
+			sample = NewExpDecaySample(s.Sample.ReservoirSize, s.Sample.Alpha)
+		default:
+			return nil, fmt.Errorf("unknown sample kind %q", s.Sample.Kind)
+		}
+		if s.Type == "timer" {
+			return NewCustomTimer(NewHistogram(sample), NewMeter()), nil
+		}
+		return NewHistogram(sample), nil
+	}
+	return nil, fmt.Errorf("unknown metric type %q", s.Type)
+}
+
+func (m *StandardMeter) state() *meterState {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return &meterState{
+		Count: m.Count(),
+		Start: m.startTime,
+		Rates: []ewmaState{ewmaStateOf(m.a1), ewmaStateOf(m.a5), ewmaStateOf(m.a15)},
+	}
+}
+
+func (m *StandardMeter) restore(s *meterState) error {
+	if s == nil || len(s.Rates) != 3 {
+		return errors.New("invalid meter state")
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.count.Store(s.Count)
+	m.startTime = s.Start
+	for i, a := range []EWMA{m.a1, m.a5, m.a15} {
+		if a, ok := a.(*StandardEWMA); ok {
+			a.restore(s.Rates[i])
+		}
+	}
+	return nil
+}
+
+func ewmaStateOf(a EWMA) ewmaState {
+	s, ok := a.(*StandardEWMA)
+	if !ok {
+		return ewmaState{}
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return ewmaState{
+		Rate:      s.ewma,
+		Uncounted: s.uncounted,
+		Timestamp: s.timestamp,
+		Init:      s.init,
+	}
+}
+
+func (s *StandardEWMA) restore(state ewmaState) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if state.Timestamp.IsZero() {
+		return
+	}
+	s.ewma = state.Rate
+	s.uncounted = state.Uncounted
+	s.timestamp = state.Timestamp
+	s.init = state.Init
+}
+
+// Returns the state of a sample, or false if it is not one of the samples of
+// this package.
+func saveSample(sample Sample) (*sampleState, bool) {
+	switch s := sample.(type) {
+	case *UniformSample:
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		return &sampleState{
+			Kind:          "uniform",
+			Count:         s.count,
+			ReservoirSize: s.reservoirSize,
+			Values:        append([]int64{}, s.values...),
+		}, true
+	case *ExpDecaySample:
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		state := &sampleState{
+			Kind:          "exp_decay",
+			Count:         s.count,
+			ReservoirSize: s.reservoirSize,
+			Alpha:         s.alpha,
+			T0:            s.t0,
+		}
+		for _, v := range s.values.Values() {
+			// A priority is infinite if its random number was zero.
+			k := math.Min(v.k, math.MaxFloat64)
+			state.Values = append(state.Values, v.v)
+			state.Priorities = append(state.Priorities, k)
+		}
+		return state, true
+	}
+	return nil, false
+}
+
+// Replaces the contents of a sample with a saved state of the same kind.
+func loadSample(sample Sample, state *sampleState) error {
+	if state == nil {
+		return errors.New("missing sample")
+	}
+	switch s := sample.(type) {
+	case *UniformSample:
+		if state.Kind != "uniform" {
+			break
+		}
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		values := state.Values
+		if len(values) > s.reservoirSize {
+			values = values[:s.reservoirSize]
+		}
+		s.count = state.Count
+		s.values = append(make([]int64, 0, s.reservoirSize), values...)
+		return nil
+	case *ExpDecaySample:
+		if state.Kind != "exp_decay" || len(state.Priorities) != len(state.Values) {
+			break
+		}
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		s.values.Clear()
+		for i, v := range state.Values {
+			if s.values.Size() == s.reservoirSize {
+				s.values.Pop()
+			}
+			s.values.Push(expDecaySample{k: state.Priorities[i], v: v})
+		}
+		s.count = state.Count
+		s.t0 = state.T0
+		s.t1 = s.t0.Add(rescaleThreshold)
+		return nil
+	default:
+		return nil
+	}
+	return fmt.Errorf("cannot restore a %s sample into a %T", state.Kind, sample)
+}
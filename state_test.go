@@ -0,0 +1,168 @@
+package metrics
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSaveLoadState(t *testing.T) {
+	r := NewRegistry()
+	GetOrRegisterCounter("counter", r).Inc(5)
+	GetOrRegisterGauge("gauge", r).Update(7)
+	GetOrRegisterGaugeFloat64("gauge_float64", r).Update(1.5)
+	GetOrRegisterGaugeFloat64("nan", r).Update(math.NaN())
+	m := GetOrRegisterMeter("meter", r)
+	m.Mark(3)
+	m.(*StandardMeter).a1.(*StandardEWMA).addToTimestamp(-5e9)
+	h := GetOrRegisterHistogram("histogram", r, NewUniformSample(10))
+	e := GetOrRegisterHistogram("exp_decay", r, NewExpDecaySample(10, 0.015))
+	for i := int64(1); i <= 20; i++ {
+		h.Update(i)
+		e.Update(i)
+	}
+	timer := GetOrRegisterTimer("timer", r)
+	timer.Update(42)
+	r.Register("health", NewHealthcheck(nil))
+
+	var buf bytes.Buffer
+	if err := SaveState(r, &buf); err != nil {
+		t.Fatal(err)
+	}
+	r2 := NewRegistry()
+	GetOrRegisterCounter("counter", r2).Inc(1)
+	if err := LoadState(r2, &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if c := GetOrRegisterCounter("counter", r2).Count(); c != 5 {
+		t.Errorf("counter: 5 != %d", c)
+	}
+	if v := GetOrRegisterGauge("gauge", r2).Value(); v != 7 {
+		t.Errorf("gauge: 7 != %d", v)
+	}
+	if v := GetOrRegisterGaugeFloat64("gauge_float64", r2).Value(); v != 1.5 {
+		t.Errorf("gauge_float64: 1.5 != %v", v)
+	}
+	if r2.Get("nan") != nil || r2.Get("health") != nil {
+		t.Error("LoadState(): restored metrics which should not be saved")
+	}
+	m2 := GetOrRegisterMeter("meter", r2)
+	if m2.Count() != 3 || m2.Rate1() != m.Rate1() || m2.Rate1() == 0 {
+		t.Errorf("meter: %d %v != 3 %v", m2.Count(), m2.Rate1(), m.Rate1())
+	}
+	for _, name := range []string{"histogram", "exp_decay"} {
+		want, got := r.Get(name).(Histogram), r2.Get(name).(Histogram)
+		if got.Count() != 20 || got.Sum() != want.Sum() || got.Sample().Size() != 10 {
+			t.Errorf("%s: %d %d != 20 %d", name, got.Count(), got.Sum(), want.Sum())
+		}
+	}
+	if _, ok := r2.Get("exp_decay").(*StandardHistogram).sample.(*ExpDecaySample); !ok {
+		t.Error("exp_decay: sample not restored as an ExpDecaySample")
+	}
+	if tm := GetOrRegisterTimer("timer", r2); tm.Count() != 1 || tm.Max() != 42 {
+		t.Errorf("timer: %d %d != 1 42", tm.Count(), tm.Max())
+	}
+}
+
+func TestSaveStateLabeled(t *testing.T) {
+	r := NewRegistry()
+	c := NewCounter()
+	c.Inc(3)
+	r.Register("requests", WithLabels(c, map[string]string{"method": "GET"}))
+
+	var buf bytes.Buffer
+	if err := SaveState(r, &buf); err != nil {
+		t.Fatal(err)
+	}
+	r2 := NewRegistry()
+	if err := LoadState(r2, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if c := GetOrRegisterCounter("requests", r2).Count(); c != 3 {
+		t.Errorf("requests: 3 != %d", c)
+	}
+}
+
+func TestLoadStateErrors(t *testing.T) {
+	r := NewRegistry()
+	err := LoadState(r, strings.NewReader(`{"version":2,"metrics":{}}`))
+	if err == nil || err.Error() != "unsupported state version 2" {
+		t.Errorf("LoadState(): %v", err)
+	}
+
+	GetOrRegisterGauge("foo", r)
+	state := `{"version":1,"metrics":{"foo":{"type":"counter","count":1},"bar":{"type":"counter","count":2}}}`
+	if err := LoadState(r, strings.NewReader(state)); err == nil {
+		t.Error("LoadState(): expected an error for a mismatched type")
+	}
+	if c := GetOrRegisterCounter("bar", r).Count(); c != 2 {
+		t.Errorf("bar: 2 != %d", c)
+	}
+}
+
+func TestSaveLoadStateFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.json")
+	r := NewPrefixedChildRegistry(NewRegistry(), "prefix.")
+	if err := LoadStateFile(r, path); err != nil {
+		t.Fatal(err)
+	}
+	GetOrRegisterCounter("foo", r).Inc(3)
+	if err := SaveStateFile(r, path); err != nil {
+		t.Fatal(err)
+	}
+	parent := NewRegistry()
+	r2 := NewPrefixedChildRegistry(parent, "prefix.")
+	if err := LoadStateFile(r2, path); err != nil {
+		t.Fatal(err)
+	}
+	if c, ok := parent.Get("prefix.foo").(Counter); !ok || c.Count() != 3 {
+		t.Errorf("LoadStateFile(): %v", parent.Get("prefix.foo"))
+	}
+	if matches, _ := filepath.Glob(path + ".*.tmp"); len(matches) != 0 {
+		t.Errorf("SaveStateFile(): left %v", matches)
+	}
+}
+
+func TestLoadStateMarkedMeter(t *testing.T) {
+	r := NewRegistry()
+	GetOrRegisterMeter("meter", r).Mark(100)
+	var buf bytes.Buffer
+	if err := SaveState(r, &buf); err != nil {
+		t.Fatal(err)
+	}
+	state := buf.String()
+
+	r2 := NewRegistry()
+	m := GetOrRegisterMeter("meter", r2)
+	done := make(chan struct{})
+	marked := make(chan struct{})
+	go func() {
+		defer close(marked)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				m.Mark(1)
+				m.RateMean()
+			}
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		if err := LoadState(r2, strings.NewReader(state)); err != nil {
+			t.Fatal(err)
+		}
+		if err := SaveState(r2, io.Discard); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(done)
+	<-marked
+	if c := m.Count(); c < 100 {
+		t.Errorf("meter: %d < 100", c)
+	}
+}
@@ -89,8 +89,15 @@ func Once(c Config) error {
 }
 
 func statsd(w *bufio.Writer, c *Config) {
-	c.Registry.Each(func(name string, i interface{}) {
-		logging.EncodeStatsd(w, name, c.Prefix, i)
+	c.Registry.Snapshot().Each(func(name string, i interface{}) {
+		logging.EncodeStatsdSnapshot(w, name, c.Prefix, i)
 		w.Flush()
+		// Statsd counts are deltas. The sent count is subtracted rather than
+		// cleared to keep the increments made since the snapshot.
+		if sent, ok := i.(metrics.Counter); ok {
+			if live, ok := metrics.Lookup(c.Registry, name).(metrics.Counter); ok {
+				live.Dec(sent.Count())
+			}
+		}
 	})
 }
@@ -2,6 +2,7 @@ package statsd
 
 import (
 	"bufio"
+	"bytes"
 	"github.com/zeim839/go-metrics-plus"
 	"net"
 	"strings"
@@ -75,7 +76,6 @@ func TestWrites(t *testing.T) {
 	metrics.GetOrRegisterCounter("foo", nil).Inc(2)
 	metrics.GetOrRegisterGauge("bar", nil).Update(1)
 
-	ctx.Store(false)
 	wg.Add(1)
 	err := Once(c)
 	if err != nil {
@@ -84,6 +84,16 @@ func TestWrites(t *testing.T) {
 	}
 	wg.Wait()
 
+	// The server checks ctx after each connection.
+	ctx.Store(false)
+	wg.Add(1)
+	conn, err := net.Dial("tcp", "127.0.0.1:9999")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	wg.Wait()
+
 	expect := "p.bar:1|g\n"
 	if str := res["p.bar"]; expect != str {
 		t.Errorf("%v != %v", expect, str)
@@ -93,4 +103,26 @@ func TestWrites(t *testing.T) {
 	if str := res["p.foo"]; expect != str {
 		t.Errorf("%v != %v", expect, str)
 	}
+	if count := metrics.GetOrRegisterCounter("foo", nil).Count(); count != 0 {
+		t.Errorf("foo: %d != 0 after flush", count)
+	}
+}
+
+func TestCounterResetThroughViews(t *testing.T) {
+	prefixed := metrics.NewPrefixedChildRegistry(metrics.NewRegistry(), "svc.")
+	rewritten, _ := metrics.NewRewriteRegistry(metrics.NewRegistry(),
+		[]metrics.RewriteRule{{Prefix: "svc."}})
+	for _, r := range []metrics.Registry{prefixed, rewritten} {
+		c := metrics.GetOrRegisterCounter("hits", r)
+		c.Inc(3)
+		var buf bytes.Buffer
+		w := bufio.NewWriter(&buf)
+		statsd(w, &Config{Registry: r, Prefix: "p"})
+		if expect := "p.svc.hits:3|c\n"; buf.String() != expect {
+			t.Errorf("%q != %q", buf.String(), expect)
+		}
+		if count := c.Count(); count != 0 {
+			t.Errorf("hits: %d != 0 after flush", count)
+		}
+	}
 }
@@ -0,0 +1,439 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DeviceFilter reports whether the system collectors should export the
+// network interface or block device with the given name.
+type DeviceFilter func(device string) bool
+
+// NewDeviceFilter returns a DeviceFilter which accepts devices matching the
+// include regular expression, unless they also match exclude. Empty
+// expressions are ignored, i.e NewDeviceFilter("", "^(lo|loop[0-9]+)$")
+// excludes loopback devices.
+func NewDeviceFilter(include, exclude string) (DeviceFilter, error) {
+	var in, ex *regexp.Regexp
+	var err error
+	if include != "" {
+		if in, err = regexp.Compile(include); err != nil {
+			return nil, err
+		}
+	}
+	if exclude != "" {
+		if ex, err = regexp.Compile(exclude); err != nil {
+			return nil, err
+		}
+	}
+	return func(device string) bool {
+		return (in == nil || in.MatchString(device)) &&
+			(ex == nil || !ex.MatchString(device))
+	}, nil
+}
+
+// Lazily registered metrics of a system collector, whose set of metrics
+// depends on the devices or fields present at capture time.
+type systemMetrics struct {
+	mutex    sync.Mutex
+	registry Registry
+	counters map[string]Counter
+	gauges   map[string]Gauge
+	floats   map[string]GaugeFloat64
+	seen     map[string]bool // Names updated since the last sweep.
+}
+
+func newSystemMetrics(r Registry) systemMetrics {
+	if r == nil {
+		r = DefaultRegistry
+	}
+	return systemMetrics{
+		registry: r,
+		counters: map[string]Counter{},
+		gauges:   map[string]Gauge{},
+		floats:   map[string]GaugeFloat64{},
+		seen:     map[string]bool{},
+	}
+}
+
+// Unregisters the metrics which were not updated since the last sweep, i.e
+// those of devices which disappeared.
+func (m *systemMetrics) sweep() {
+	for name := range m.counters {
+		if !m.seen[name] {
+			m.registry.Unregister(name)
+			delete(m.counters, name)
+		}
+	}
+	for name := range m.gauges {
+		if !m.seen[name] {
+			m.registry.Unregister(name)
+			delete(m.gauges, name)
+		}
+	}
+	for name := range m.floats {
+		if !m.seen[name] {
+			m.registry.Unregister(name)
+			delete(m.floats, name)
+		}
+	}
+	m.seen = map[string]bool{}
+}
+
+// Sets the counter with the given name to the cumulative value v.
+func (m *systemMetrics) counter(name string, v int64) {
+	c, ok := m.counters[name]
+	if !ok {
+		c = GetOrRegisterCounter(name, m.registry)
+		m.counters[name] = c
+	}
+	c.Inc(v - c.Count())
+	m.seen[name] = true
+}
+
+func (m *systemMetrics) gauge(name string, v int64) {
+	g, ok := m.gauges[name]
+	if !ok {
+		g = GetOrRegisterGauge(name, m.registry)
+		m.gauges[name] = g
+	}
+	g.Update(v)
+	m.seen[name] = true
+}
+
+func (m *systemMetrics) float(name string, v float64) {
+	g, ok := m.floats[name]
+	if !ok {
+		g = GetOrRegisterGaugeFloat64(name, m.registry)
+		m.floats[name] = g
+	}
+	g.Update(v)
+	m.seen[name] = true
+}
+
+// NetDevCollector captures per interface traffic from /proc/net/dev. For each
+// interface it exports the counters system.net.<interface>.rx.bytes,
+// rx.packets, rx.errors and rx.drops, and their tx equivalents. The metrics of
+// interfaces which disappear are unregistered.
+type NetDevCollector struct {
+	root    string
+	filter  DeviceFilter
+	metrics systemMetrics
+}
+
+// NewNetDevCollector constructs a new NetDevCollector which registers its
+// metrics in r. The proc filesystem is read from root, or DefaultProcRoot if
+// root is empty. A nil filter exports every interface.
+func NewNetDevCollector(r Registry, root string, filter DeviceFilter) *NetDevCollector {
+	if root == "" {
+		root = DefaultProcRoot
+	}
+	return &NetDevCollector{root: root, filter: filter, metrics: newSystemMetrics(r)}
+}
+
+// Capture reads /proc/net/dev and updates the metrics of every interface.
+func (c *NetDevCollector) Capture() error {
+	data, err := os.ReadFile(filepath.Join(c.root, "net", "dev"))
+	if err != nil {
+		return collected("netdev", err)
+	}
+	c.metrics.mutex.Lock()
+	defer c.metrics.mutex.Unlock()
+	// The first two lines are headers. Receive fields are bytes, packets,
+	// errs, drop, fifo, frame, compressed and multicast, followed by the
+	// transmit fields bytes, packets, errs, drop, fifo, colls, carrier and
+	// compressed.
+	lines := strings.Split(string(data), "\n")
+	if len(lines) < 2 {
+		return collected("netdev", errors.New("net/dev: missing header"))
+	}
+	for _, line := range lines[2:] {
+		name, rest, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		name = strings.TrimSpace(name)
+		if c.filter != nil && !c.filter(name) {
+			continue
+		}
+		v, err := parseInts(strings.Fields(rest), 16)
+		if err != nil {
+			return collected("netdev", fmt.Errorf("net/dev: %s: %s", name, err))
+		}
+		prefix := "system.net." + name
+		c.metrics.counter(prefix+".rx.bytes", v[0])
+		c.metrics.counter(prefix+".rx.packets", v[1])
+		c.metrics.counter(prefix+".rx.errors", v[2])
+		c.metrics.counter(prefix+".rx.drops", v[3])
+		c.metrics.counter(prefix+".tx.bytes", v[8])
+		c.metrics.counter(prefix+".tx.packets", v[9])
+		c.metrics.counter(prefix+".tx.errors", v[10])
+		c.metrics.counter(prefix+".tx.drops", v[11])
+	}
+	c.metrics.sweep()
+	return collected("netdev", nil)
+}
+
+// Collect implements Collector.
+func (c *NetDevCollector) Collect(ctx context.Context) error {
+	return c.Capture()
+}
+
+// DiskStatsCollector captures per device IO from /proc/diskstats. For each
+// device it exports the counters system.disk.<device>.reads, writes,
+// read.bytes, write.bytes, read.time, write.time, io.time and
+// io.weighted_time, and the gauge io.in_progress. Times are in milliseconds;
+// io.weighted_time is the time requests spent queued or in flight. The metrics
+// of devices which disappear are unregistered.
+type DiskStatsCollector struct {
+	root    string
+	filter  DeviceFilter
+	metrics systemMetrics
+}
+
+// NewDiskStatsCollector constructs a new DiskStatsCollector which registers
+// its metrics in r. The proc filesystem is read from root, or DefaultProcRoot
+// if root is empty. A nil filter exports every device.
+func NewDiskStatsCollector(r Registry, root string, filter DeviceFilter) *DiskStatsCollector {
+	if root == "" {
+		root = DefaultProcRoot
+	}
+	return &DiskStatsCollector{root: root, filter: filter, metrics: newSystemMetrics(r)}
+}
+
+// Capture reads /proc/diskstats and updates the metrics of every device.
+func (c *DiskStatsCollector) Capture() error {
+	data, err := os.ReadFile(filepath.Join(c.root, "diskstats"))
+	if err != nil {
+		return collected("diskstats", err)
+	}
+	c.metrics.mutex.Lock()
+	defer c.metrics.mutex.Unlock()
+	// Fields after major, minor and name are reads completed, reads merged,
+	// sectors read, ms reading, writes completed, writes merged, sectors
+	// written, ms writing, IOs in progress, ms doing IO and weighted ms doing
+	// IO. Newer kernels append discard and flush fields.
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 14 {
+			continue
+		}
+		name := fields[2]
+		if c.filter != nil && !c.filter(name) {
+			continue
+		}
+		v, err := parseInts(fields[3:], 11)
+		if err != nil {
+			return collected("diskstats", fmt.Errorf("diskstats: %s: %s", name, err))
+		}
+		// Sectors are always 512 bytes in diskstats.
+		prefix := "system.disk." + name
+		c.metrics.counter(prefix+".reads", v[0])
+		c.metrics.counter(prefix+".read.bytes", v[2]*512)
+		c.metrics.counter(prefix+".read.time", v[3])
+		c.metrics.counter(prefix+".writes", v[4])
+		c.metrics.counter(prefix+".write.bytes", v[6]*512)
+		c.metrics.counter(prefix+".write.time", v[7])
+		c.metrics.gauge(prefix+".io.in_progress", v[8])
+		c.metrics.counter(prefix+".io.time", v[9])
+		c.metrics.counter(prefix+".io.weighted_time", v[10])
+	}
+	c.metrics.sweep()
+	return collected("diskstats", nil)
+}
+
+// Collect implements Collector.
+func (c *DiskStatsCollector) Collect(ctx context.Context) error {
+	return c.Capture()
+}
+
+// LoadAvgCollector captures /proc/loadavg into the gauges system.load.1min,
+// system.load.5min, system.load.15min, system.load.procs.running and
+// system.load.procs.total.
+type LoadAvgCollector struct {
+	root    string
+	metrics systemMetrics
+}
+
+// NewLoadAvgCollector constructs a new LoadAvgCollector which registers its
+// metrics in r. The proc filesystem is read from root, or DefaultProcRoot if
+// root is empty.
+func NewLoadAvgCollector(r Registry, root string) *LoadAvgCollector {
+	if root == "" {
+		root = DefaultProcRoot
+	}
+	return &LoadAvgCollector{root: root, metrics: newSystemMetrics(r)}
+}
+
+// Capture reads /proc/loadavg and updates its metrics.
+func (c *LoadAvgCollector) Capture() error {
+	data, err := os.ReadFile(filepath.Join(c.root, "loadavg"))
+	if err != nil {
+		return collected("loadavg", err)
+	}
+	// i.e "0.15 0.25 0.18 1/73 14684".
+	fields := strings.Fields(string(data))
+	if len(fields) < 4 {
+		return collected("loadavg", fmt.Errorf("loadavg: malformed %q", data))
+	}
+	var loads [3]float64
+	for i := range loads {
+		if loads[i], err = strconv.ParseFloat(fields[i], 64); err != nil {
+			return collected("loadavg", fmt.Errorf("loadavg: %s", err))
+		}
+	}
+	running, total, _ := strings.Cut(fields[3], "/")
+	procs, err := parseInts([]string{running, total}, 2)
+	if err != nil {
+		return collected("loadavg", fmt.Errorf("loadavg: %s", err))
+	}
+	c.metrics.mutex.Lock()
+	defer c.metrics.mutex.Unlock()
+	c.metrics.float("system.load.1min", loads[0])
+	c.metrics.float("system.load.5min", loads[1])
+	c.metrics.float("system.load.15min", loads[2])
+	c.metrics.gauge("system.load.procs.running", procs[0])
+	c.metrics.gauge("system.load.procs.total", procs[1])
+	return collected("loadavg", nil)
+}
+
+// Collect implements Collector.
+func (c *LoadAvgCollector) Collect(ctx context.Context) error {
+	return c.Capture()
+}
+
+// MemInfoCollector captures every field of /proc/meminfo into gauges named
+// system.memory.<field>, i.e system.memory.MemAvailable. Sizes are converted
+// to bytes, and parentheses in field names are replaced, i.e Active(anon)
+// becomes system.memory.Active_anon.
+type MemInfoCollector struct {
+	root    string
+	metrics systemMetrics
+}
+
+// NewMemInfoCollector constructs a new MemInfoCollector which registers its
+// metrics in r. The proc filesystem is read from root, or DefaultProcRoot if
+// root is empty.
+func NewMemInfoCollector(r Registry, root string) *MemInfoCollector {
+	if root == "" {
+		root = DefaultProcRoot
+	}
+	return &MemInfoCollector{root: root, metrics: newSystemMetrics(r)}
+}
+
+var memInfoReplacer = strings.NewReplacer("(", "_", ")", "")
+
+// Capture reads /proc/meminfo and updates its metrics.
+func (c *MemInfoCollector) Capture() error {
+	c.metrics.mutex.Lock()
+	defer c.metrics.mutex.Unlock()
+	err := scanProcFile(filepath.Join(c.root, "meminfo"), func(key, value string) error {
+		scale := int64(1)
+		if strings.HasSuffix(value, " kB") {
+			value, scale = strings.TrimSuffix(value, " kB"), 1024
+		}
+		v, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		name := memInfoReplacer.Replace(strings.TrimSuffix(key, ":"))
+		c.metrics.gauge("system.memory."+name, v*scale)
+		return nil
+	})
+	return collected("meminfo", err)
+}
+
+// Collect implements Collector.
+func (c *MemInfoCollector) Collect(ctx context.Context) error {
+	return c.Capture()
+}
+
+// NetSNMPCollector captures the TCP statistics of /proc/net/snmp into
+// counters named system.tcp.<field>, i.e system.tcp.RetransSegs, and the
+// gauge system.tcp.CurrEstab. The static RtoAlgorithm, RtoMin, RtoMax and
+// MaxConn fields are skipped.
+type NetSNMPCollector struct {
+	root    string
+	metrics systemMetrics
+}
+
+// NewNetSNMPCollector constructs a new NetSNMPCollector which registers its
+// metrics in r. The proc filesystem is read from root, or DefaultProcRoot if
+// root is empty.
+func NewNetSNMPCollector(r Registry, root string) *NetSNMPCollector {
+	if root == "" {
+		root = DefaultProcRoot
+	}
+	return &NetSNMPCollector{root: root, metrics: newSystemMetrics(r)}
+}
+
+// Capture reads /proc/net/snmp and updates its metrics.
+func (c *NetSNMPCollector) Capture() error {
+	data, err := os.ReadFile(filepath.Join(c.root, "net", "snmp"))
+	if err != nil {
+		return collected("snmp", err)
+	}
+	// Every protocol has a line of field names followed by a line of values,
+	// both prefixed with the protocol name, i.e "Tcp:".
+	var names []string
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || fields[0] != "Tcp:" {
+			continue
+		}
+		if names == nil {
+			names = fields[1:]
+			continue
+		}
+		values := fields[1:]
+		if len(values) != len(names) {
+			return collected("snmp", fmt.Errorf("net/snmp: malformed Tcp values"))
+		}
+		c.metrics.mutex.Lock()
+		defer c.metrics.mutex.Unlock()
+		for i, name := range names {
+			switch name {
+			case "RtoAlgorithm", "RtoMin", "RtoMax", "MaxConn":
+				continue
+			}
+			v, err := strconv.ParseInt(values[i], 10, 64)
+			if err != nil {
+				return collected("snmp", fmt.Errorf("net/snmp: %s: %s", name, err))
+			}
+			if name == "CurrEstab" {
+				c.metrics.gauge("system.tcp."+name, v)
+			} else {
+				c.metrics.counter("system.tcp."+name, v)
+			}
+		}
+		return collected("snmp", nil)
+	}
+	return collected("snmp", fmt.Errorf("net/snmp: missing Tcp statistics"))
+}
+
+// Collect implements Collector.
+func (c *NetSNMPCollector) Collect(ctx context.Context) error {
+	return c.Capture()
+}
+
+// Parses the first n fields as integers.
+func parseInts(fields []string, n int) ([]int64, error) {
+	if len(fields) < n {
+		return nil, fmt.Errorf("expected %d fields, got %d", n, len(fields))
+	}
+	v := make([]int64, n)
+	for i := range v {
+		var err error
+		if v[i], err = strconv.ParseInt(fields[i], 10, 64); err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
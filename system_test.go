@@ -0,0 +1,202 @@
+package metrics
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewDeviceFilter(t *testing.T) {
+	filter, err := NewDeviceFilter("^(eth|vd)", "[0-9]$")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for device, expect := range map[string]bool{
+		"eth0": false,
+		"ethx": true,
+		"vda":  true,
+		"vda1": false,
+		"lo":   false,
+	} {
+		if filter(device) != expect {
+			t.Errorf("filter(%q): %v != %v", device, !expect, expect)
+		}
+	}
+	if _, err := NewDeviceFilter("(", ""); err == nil {
+		t.Error("NewDeviceFilter(): expected error for invalid regexp")
+	}
+}
+
+func TestNetDevCollector(t *testing.T) {
+	r := NewRegistry()
+	c := NewNetDevCollector(r, "testdata/proc", func(device string) bool {
+		return device != "lo"
+	})
+	if err := c.Capture(); err != nil {
+		t.Fatalf("Capture(): %s", err)
+	}
+	for name, expect := range map[string]int64{
+		"system.net.eth0.rx.bytes":   1516390,
+		"system.net.eth0.rx.packets": 1050,
+		"system.net.eth0.rx.errors":  2,
+		"system.net.eth0.rx.drops":   3,
+		"system.net.eth0.tx.bytes":   85230,
+		"system.net.eth0.tx.packets": 912,
+		"system.net.eth0.tx.errors":  4,
+		"system.net.eth0.tx.drops":   5,
+	} {
+		if v := r.Get(name).(Counter).Count(); v != expect {
+			t.Errorf("%s: %d != %d", name, v, expect)
+		}
+	}
+	if r.Get("system.net.lo.rx.bytes") != nil {
+		t.Error("system.net.lo.rx.bytes: expected filtered interface")
+	}
+
+	// Counters must not accumulate across captures.
+	if err := c.Capture(); err != nil {
+		t.Fatalf("Capture(): %s", err)
+	}
+	if v := r.Get("system.net.eth0.rx.bytes").(Counter).Count(); v != 1516390 {
+		t.Errorf("system.net.eth0.rx.bytes: %d != 1516390", v)
+	}
+}
+
+func TestNetDevCollectorRemovedInterface(t *testing.T) {
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, "net"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(root, "net", "dev")
+	header := "Inter-|   Receive\n face |bytes\n"
+	line := ": 1 2 3 4 0 0 0 0 5 6 7 8 0 0 0 0\n"
+	if err := os.WriteFile(path, []byte(header+"eth0"+line+"eth1"+line), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	r := NewRegistry()
+	c := NewNetDevCollector(r, root, nil)
+	if err := c.Capture(); err != nil {
+		t.Fatalf("Capture(): %s", err)
+	}
+	if err := os.WriteFile(path, []byte(header+"eth0"+line), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Capture(); err != nil {
+		t.Fatalf("Capture(): %s", err)
+	}
+	if r.Get("system.net.eth1.rx.bytes") != nil {
+		t.Error("system.net.eth1.rx.bytes: expected removed interface to be unregistered")
+	}
+	if r.Get("system.net.eth0.rx.bytes") == nil {
+		t.Error("system.net.eth0.rx.bytes: unregistered")
+	}
+
+	if err := os.WriteFile(path, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Capture(); err == nil {
+		t.Error("Capture(): expected error for empty net/dev")
+	}
+	collected("netdev", nil)
+}
+
+func TestDiskStatsCollector(t *testing.T) {
+	r := NewRegistry()
+	c := NewDiskStatsCollector(r, "testdata/proc", nil)
+	if err := c.Capture(); err != nil {
+		t.Fatalf("Capture(): %s", err)
+	}
+	for name, expect := range map[string]int64{
+		"system.disk.vda.reads":            10428,
+		"system.disk.vda.read.bytes":       829150 * 512,
+		"system.disk.vda.read.time":        4521,
+		"system.disk.vda.writes":           6402,
+		"system.disk.vda.write.bytes":      280688 * 512,
+		"system.disk.vda.write.time":       9870,
+		"system.disk.vda.io.time":          11800,
+		"system.disk.vda.io.weighted_time": 14391,
+		"system.disk.loop0.reads":          48,
+	} {
+		if v := r.Get(name).(Counter).Count(); v != expect {
+			t.Errorf("%s: %d != %d", name, v, expect)
+		}
+	}
+	if v := r.Get("system.disk.vda.io.in_progress").(Gauge).Value(); v != 2 {
+		t.Errorf("system.disk.vda.io.in_progress: %d != 2", v)
+	}
+}
+
+func TestLoadAvgCollector(t *testing.T) {
+	r := NewRegistry()
+	if err := NewLoadAvgCollector(r, "testdata/proc").Capture(); err != nil {
+		t.Fatalf("Capture(): %s", err)
+	}
+	for name, expect := range map[string]float64{
+		"system.load.1min":  0.15,
+		"system.load.5min":  0.25,
+		"system.load.15min": 0.18,
+	} {
+		if v := r.Get(name).(GaugeFloat64).Value(); v != expect {
+			t.Errorf("%s: %v != %v", name, v, expect)
+		}
+	}
+	if v := r.Get("system.load.procs.running").(Gauge).Value(); v != 1 {
+		t.Errorf("system.load.procs.running: %d != 1", v)
+	}
+	if v := r.Get("system.load.procs.total").(Gauge).Value(); v != 73 {
+		t.Errorf("system.load.procs.total: %d != 73", v)
+	}
+}
+
+func TestMemInfoCollector(t *testing.T) {
+	r := NewRegistry()
+	if err := NewMemInfoCollector(r, "testdata/proc").Capture(); err != nil {
+		t.Fatalf("Capture(): %s", err)
+	}
+	for name, expect := range map[string]int64{
+		"system.memory.MemTotal":        6147400 * 1024,
+		"system.memory.MemAvailable":    5456392 * 1024,
+		"system.memory.Active_anon":     412880 * 1024,
+		"system.memory.HugePages_Total": 0,
+	} {
+		g, ok := r.Get(name).(Gauge)
+		if !ok {
+			t.Errorf("%s: not registered", name)
+			continue
+		}
+		if v := g.Value(); v != expect {
+			t.Errorf("%s: %d != %d", name, v, expect)
+		}
+	}
+}
+
+func TestNetSNMPCollector(t *testing.T) {
+	r := NewRegistry()
+	if err := NewNetSNMPCollector(r, "testdata/proc").Capture(); err != nil {
+		t.Fatalf("Capture(): %s", err)
+	}
+	for name, expect := range map[string]int64{
+		"system.tcp.ActiveOpens": 310,
+		"system.tcp.InSegs":      98765,
+		"system.tcp.RetransSegs": 123,
+		"system.tcp.OutRsts":     45,
+	} {
+		if v := r.Get(name).(Counter).Count(); v != expect {
+			t.Errorf("%s: %d != %d", name, v, expect)
+		}
+	}
+	if v := r.Get("system.tcp.CurrEstab").(Gauge).Value(); v != 5 {
+		t.Errorf("system.tcp.CurrEstab: %d != 5", v)
+	}
+	if r.Get("system.tcp.MaxConn") != nil {
+		t.Error("system.tcp.MaxConn: expected static field to be skipped")
+	}
+}
+
+func TestSystemCollectorMissingFile(t *testing.T) {
+	r := NewRegistry()
+	if err := NewLoadAvgCollector(r, "testdata/missing").Capture(); err == nil {
+		t.Error("Capture(): expected error for missing loadavg")
+	}
+	collected("loadavg", nil)
+}
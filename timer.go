@@ -29,7 +29,8 @@ type Timer interface {
 // GetOrRegisterTimer returns an existing Timer or constructs and registers a
 // new StandardTimer.
 // Be sure to unregister the meter from the registry once it is of no use to
-// allow for garbage collection.
+// allow for garbage collection, or use a registry created with
+// NewRegistryWithTTL.
 func GetOrRegisterTimer(name string, r Registry) Timer {
 	if r == nil {
 		r = DefaultRegistry
@@ -50,7 +51,8 @@ func NewCustomTimer(h Histogram, m Meter) Timer {
 
 // NewRegisteredTimer constructs and registers a new StandardTimer.
 // Be sure to unregister the meter from the registry once it is of no use to
-// allow for garbage collection.
+// allow for garbage collection, or use a registry created with
+// NewRegistryWithTTL.
 func NewRegisteredTimer(name string, r Registry) Timer {
 	c := NewTimer()
 	if nil == r {